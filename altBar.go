@@ -0,0 +1,318 @@
+package ats
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// BarKind ... kind of non-time bars built from ticks
+type BarKind int
+
+const (
+	// TickBars - bar of Size ticks
+	TickBars BarKind = iota + 1
+	// VolumeBars - bar of Size volume
+	VolumeBars
+	// DollarBars - bar of Size traded value, price * volume * lotSize
+	DollarBars
+	// RangeBars - bar closed while high - low reach Size
+	RangeBars
+	// RenkoBars - brick of Size price, reversal after 2 bricks move
+	RenkoBars
+)
+
+// BarSpec ... spec of non-time bars
+//	Period of spec used as period of Context.GetBars and OnBar
+//	Size decimal of at most 7 significant digits
+type BarSpec struct {
+	Kind BarKind
+	Size float64
+}
+
+func (bs BarSpec) String() string {
+	var kind string
+	switch bs.Kind {
+	case TickBars:
+		kind = "Tick"
+	case VolumeBars:
+		kind = "Volume"
+	case DollarBars:
+		kind = "Dollar"
+	case RangeBars:
+		kind = "Range"
+	case RenkoBars:
+		kind = "Renko"
+	default:
+		return "Inv BarSpec"
+	}
+	return fmt.Sprintf("%s%g", kind, bs.Size)
+}
+
+func (bs BarSpec) valid() bool {
+	return bs.Period() != 0
+}
+
+var errInvalidBarSpec = errors.New("Invalid BarSpec")
+
+// period id of BarSpec, above all time periods
+//	bits 27-29 Kind, bits 23-26 decimal exponent of Size biased by 8,
+//	bits 0-22 mantissa of Size, Size = mantissa * 10^exponent
+const (
+	altPeriodBase Period = 1 << 30
+	altExpBias           = 8
+	altMaxMant           = 1<<23 - 1
+)
+
+var pow10Tab = [...]float64{1, 1e1, 1e2, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8}
+
+func altSize(mant, exp int) float64 {
+	if exp < 0 {
+		return float64(mant) / pow10Tab[-exp]
+	}
+	return float64(mant) * pow10Tab[exp]
+}
+
+// Period ... period id of spec, for Context.GetBars, Periods and OnBar
+//		same id for same spec, 0 for invalid spec or Size not
+//		decimal of 7 significant digits within 1e-8 to 1e14
+func (bs BarSpec) Period() Period {
+	if bs.Kind < TickBars || bs.Kind > RenkoBars || !(bs.Size > 0) {
+		return 0
+	}
+	// largest exponent, shortest mantissa of exact Size
+	for exp := altExpBias - 1; exp >= -altExpBias; exp-- {
+		var mant float64
+		if exp < 0 {
+			mant = math.Round(bs.Size * pow10Tab[-exp])
+		} else {
+			mant = math.Round(bs.Size / pow10Tab[exp])
+		}
+		if mant < 1 || mant > altMaxMant || altSize(int(mant), exp) != bs.Size {
+			continue
+		}
+		return altPeriodBase | Period(bs.Kind)<<27 |
+			Period(exp+altExpBias)<<23 | Period(mant)
+	}
+	return 0
+}
+
+// BarSpec ... spec of non-time bars period, false for time period
+func (per Period) BarSpec() (BarSpec, bool) {
+	if !per.isAlt() {
+		return BarSpec{}, false
+	}
+	kind := BarKind(per>>27) & 7
+	exp := int(per>>23&0xf) - altExpBias
+	mant := int(per & altMaxMant)
+	if kind < TickBars || kind > RenkoBars || mant == 0 {
+		return BarSpec{}, false
+	}
+	return BarSpec{kind, altSize(mant, exp)}, true
+}
+
+func (per Period) isAlt() bool {
+	return per >= altPeriodBase
+}
+
+// appendAltBar ... append closed bar, bars of same date kept
+func (b *Bars) appendAltBar(fb *formBar, endT int64) {
+	b.Date = append(b.Date, timeT64FromInt64(fb.date))
+	b.Open = append(b.Open, fb.open)
+	b.High = append(b.High, fb.high)
+	b.Low = append(b.Low, fb.low)
+	b.Close = append(b.Close, fb.close)
+	b.Volume = append(b.Volume, fb.volume)
+	if b.startDt.Unix() == 0 {
+		b.startDt = b.Date[0]
+	}
+	b.endDt = timeT64FromInt64(endT)
+}
+
+// altBarBuilder ... build bars of BarSpec from ticks
+type altBarBuilder struct {
+	spec   BarSpec
+	lotVal float64 // value of price * volume
+	bars   Bars
+	cur    formBar
+	acc    float64 // ticks/volume/value of forming bar
+	brick  [2]float64
+}
+
+func newAltBarBuilder(si *SymbolInfo, spec BarSpec) *altBarBuilder {
+	ab := &altBarBuilder{spec: spec, lotVal: 1}
+	ab.bars.symKey = si.fKey
+	ab.bars.period = spec.Period()
+	if si.symbolBase != nil {
+		ab.lotVal = si.CalcProfit(0, 1, 1)
+	}
+	return ab
+}
+
+// update ... add tick, return number of bars closed
+func (ab *altBarBuilder) update(t int64, price, vol float64) (res int) {
+	if price == 0 {
+		return
+	}
+	if ab.spec.Kind == RenkoBars {
+		return ab.renko(t, price, vol)
+	}
+	ab.cur.update(t, price, vol)
+	switch ab.spec.Kind {
+	case TickBars:
+		ab.acc++
+	case VolumeBars:
+		ab.acc += vol
+	case DollarBars:
+		ab.acc += price * vol * ab.lotVal
+	case RangeBars:
+		ab.acc = ab.cur.high - ab.cur.low
+	}
+	// small tolerance for range of float price
+	if ab.acc >= ab.spec.Size*(1-1e-9) {
+		ab.bars.appendAltBar(&ab.cur, t)
+		ab.cur = formBar{}
+		ab.acc = 0
+		res++
+	}
+	return
+}
+
+// renko ... bricks from low/high of last brick, up brick while price
+//		reach high + Size, down brick while reach low - Size
+func (ab *altBarBuilder) renko(t int64, price, vol float64) (res int) {
+	size := ab.spec.Size
+	if len(ab.bars.Date) == 0 && ab.cur.date == 0 {
+		ab.brick = [2]float64{price, price}
+	}
+	ab.cur.update(t, price, vol)
+	for {
+		var open, close float64
+		if lo, hi := ab.brick[0], ab.brick[1]; price >= hi+size*(1-1e-9) {
+			open, close = hi, hi+size
+		} else if price <= lo-size*(1-1e-9) {
+			open, close = lo, lo-size
+		} else {
+			return
+		}
+		fb := ab.cur
+		if fb.date == 0 {
+			// more bricks of same tick
+			fb.date = t
+		}
+		fb.open, fb.close = open, close
+		fb.high, fb.low = math.Max(open, close), math.Min(open, close)
+		ab.bars.appendAltBar(&fb, t)
+		ab.brick = [2]float64{fb.low, fb.high}
+		ab.cur = formBar{}
+		res++
+	}
+}
+
+// altBarSet ... builders of BarSpec for one symbol
+type altBarSet struct {
+	symKey   SymbolKey
+	lastVol  int64
+	builders []*altBarBuilder
+}
+
+var altBarsLock sync.RWMutex
+var altBarSets = map[SymbolKey]*altBarSet{}
+
+// getAltBarSet ... builders of symbol, builders of specs added
+func getAltBarSet(si *SymbolInfo, specs []BarSpec) *altBarSet {
+	altBarsLock.Lock()
+	defer altBarsLock.Unlock()
+	as, ok := altBarSets[si.fKey]
+	if !ok {
+		as = &altBarSet{symKey: si.fKey}
+		altBarSets[si.fKey] = as
+	}
+	for _, spec := range specs {
+		found := false
+		for _, ab := range as.builders {
+			if ab.spec == spec {
+				found = true
+				break
+			}
+		}
+		if !found && spec.valid() {
+			as.builders = append(as.builders, newAltBarBuilder(si, spec))
+		}
+	}
+	return as
+}
+
+// onTick ... add tick to builders, return periods of bars closed,
+//		once for every bar closed
+func (as *altBarSet) onTick(t int64, price, vol float64) (res []Period) {
+	altBarsLock.Lock()
+	defer altBarsLock.Unlock()
+	for _, ab := range as.builders {
+		for n := ab.update(t, price, vol); n > 0; n-- {
+			res = append(res, ab.bars.period)
+		}
+	}
+	return
+}
+
+// onQuote ... add quotes as tick, Volume of quotes accumulated
+func (as *altBarSet) onQuote(q *Quotes, t int64) []Period {
+	vol := q.Volume - as.lastVol
+	if vol < 0 {
+		// volume reset for new trading day
+		vol = q.Volume
+	}
+	as.lastVol = q.Volume
+	return as.onTick(t, q.Last, float64(vol))
+}
+
+// getAltBars ... closed bars of BarSpec period for symbol
+func getAltBars(fKey SymbolKey, period Period) (*Bars, error) {
+	altBarsLock.RLock()
+	defer altBarsLock.RUnlock()
+	if as, ok := altBarSets[fKey]; ok {
+		for _, ab := range as.builders {
+			if ab.bars.period == period {
+				// closed bars never modified, copy of slices safe
+				res := ab.bars
+				return &res, nil
+			}
+		}
+	}
+	return nil, errNoCacheBase
+}
+
+// BarsFromTicks ... build bars of spec from ticks of symbol
+func BarsFromTicks(sym string, spec BarSpec, ticks []Tick) (*Bars, error) {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return nil, err
+	}
+	if !spec.valid() {
+		return nil, errInvalidBarSpec
+	}
+	ab := newAltBarBuilder(&si, spec)
+	for _, tk := range ticks {
+		ab.update(tk.Time.Unix(), float64(tk.Last)*si.Divi(), float64(tk.Volume))
+	}
+	return &ab.bars, nil
+}
+
+// BarsFromTicksFX ... build bars of spec from forex ticks, price of Bid
+//		no volume of forex ticks, only Tick/Range/Renko bars
+func BarsFromTicksFX(sym string, spec BarSpec, ticks []TickFX) (*Bars, error) {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return nil, err
+	}
+	if !spec.valid() {
+		return nil, errInvalidBarSpec
+	}
+	ab := newAltBarBuilder(&si, spec)
+	for _, tk := range ticks {
+		ab.update(tk.Time.Unix(), float64(tk.Bid)*si.Divi(), 0)
+	}
+	return &ab.bars, nil
+}
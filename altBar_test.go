@@ -0,0 +1,108 @@
+package ats
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBarSpecPeriod(t *testing.T) {
+	spec := BarSpec{RenkoBars, 0.5}
+	p := spec.Period()
+	if !p.isAlt() || p != spec.Period() || p.String() != "Renko0.5" {
+		t.Error("BarSpec Period diff", int(p), p.String())
+	}
+	if got, ok := p.BarSpec(); !ok || got != spec {
+		t.Error("Period BarSpec diff", got)
+	}
+	if _, ok := Daily.BarSpec(); ok {
+		t.Error("Daily should not be BarSpec")
+	}
+	if (BarSpec{TickBars, 0}).Period() != 0 {
+		t.Error("invalid BarSpec should be 0")
+	}
+	if res := addPeriod(nil, p); len(res) != 0 {
+		t.Error("addPeriod should ignore BarSpec period")
+	}
+	// period derived from spec, independent of order of use
+	if want := altPeriodBase | Period(RenkoBars)<<27 | Period(7)<<23 | 5; p != want {
+		t.Errorf("Renko0.5 period %#x, want %#x", int(p), int(want))
+	}
+	specs := []BarSpec{{TickBars, 1}, {TickBars, 233}, {VolumeBars, 1e4},
+		{DollarBars, 2.5e9}, {RangeBars, 0.0003}, {RenkoBars, 12.75}}
+	seen := map[Period]bool{}
+	for _, spec := range specs {
+		p := spec.Period()
+		if seen[p] || !p.isAlt() {
+			t.Error("BarSpec period not unique", spec, int(p))
+		}
+		seen[p] = true
+		if got, ok := p.BarSpec(); !ok || got != spec {
+			t.Error("Period BarSpec round trip diff", spec, got)
+		}
+	}
+	// Size not decimal of 7 digits
+	if (BarSpec{RangeBars, 1.0 / 3}).Period() != 0 {
+		t.Error("BarSpec of 1/3 should be 0")
+	}
+}
+
+func TestBarsFromTicks(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh600600")
+	si, err := GetSymbolInfo("sh600600")
+	if err != nil {
+		t.Skip("no sh600600", err)
+	}
+	prices := []float64{10, 10.1, 10.3, 10.2, 10.6, 11.1, 10.4, 10.0}
+	var ticks []Tick
+	for i, p := range prices {
+		ticks = append(ticks, Tick{Time: timeT32(1552000000 + i),
+			Last: int32(p*si.Multi() + 0.5), Volume: 100})
+	}
+	tests := []struct {
+		name  string
+		spec  BarSpec
+		close []float64
+		vol   []float64
+	}{
+		{"tick3", BarSpec{TickBars, 3}, []float64{10.3, 11.1}, []float64{300, 300}},
+		{"volume250", BarSpec{VolumeBars, 250}, []float64{10.3, 11.1},
+			[]float64{300, 300}},
+		{"range0.3", BarSpec{RangeBars, 0.3}, []float64{10.3, 10.6, 10.4},
+			[]float64{300, 200, 200}},
+		{"renko0.5", BarSpec{RenkoBars, 0.5}, []float64{10.5, 11, 10},
+			[]float64{500, 100, 200}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := BarsFromTicks("sh600600", tt.spec, ticks)
+			if err != nil {
+				t.Error("BarsFromTicks", err)
+				return
+			}
+			var cl []float64
+			for _, v := range b.Close {
+				cl = append(cl, round(v))
+			}
+			if !reflect.DeepEqual(cl, tt.close) || !reflect.DeepEqual(b.Volume, tt.vol) {
+				t.Errorf("%s close %v vol %v, want %v %v", b.period, cl, b.Volume,
+					tt.close, tt.vol)
+			}
+		})
+	}
+	// live builder served by Context.GetBars
+	spec := BarSpec{TickBars, 2}
+	as := getAltBarSet(&si, []BarSpec{spec})
+	var closed []Period
+	for _, tk := range ticks {
+		closed = append(closed, as.onTick(tk.Time.Unix(),
+			float64(tk.Last)*si.Divi(), float64(tk.Volume))...)
+	}
+	if len(closed) != 4 || closed[0] != spec.Period() {
+		t.Error("onTick closed", closed)
+	}
+	c := newContext(timeBroker{})
+	if b, err := c.GetBars("sh600600", spec.Period()); err != nil || b.Len() != 4 {
+		t.Error("GetBars BarSpec", err)
+	}
+}
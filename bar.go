@@ -96,6 +96,9 @@ func (per Period) String() string {
 	case Monthly:
 		return "Monthly"
 	}
+	if spec, ok := per.BarSpec(); ok {
+		return spec.String()
+	}
 	return "Inv Period"
 }
 
@@ -118,13 +121,18 @@ func (b *Bars) RowString(idx int) string {
 	if err != nil {
 		return fmt.Sprintf("Bars with error symKey: %s", err)
 	}
+	// intraday bars in local time of market, date of daily bars as is
+	dt := b.Date[idx].String()
+	if b.period < Daily || b.period.isAlt() {
+		dt = b.Date[idx].Time().In(si.Location()).Format("2006-01-02 15:04:05")
+	}
 	dig := si.Digits()
 	if dig <= 0 {
-		return fmt.Sprintf("%s %d/%d/%d/%d %d", b.Date[idx].String(),
+		return fmt.Sprintf("%s %d/%d/%d/%d %d", dt,
 			int(b.Open[idx]), int(b.High[idx]), int(b.Low[idx]),
 			int(b.Close[idx]), int(b.Volume[idx]))
 	}
-	return fmt.Sprintf("%s %.*f/%.*f/%.*f/%.*f %d", b.Date[idx].String(), dig,
+	return fmt.Sprintf("%s %.*f/%.*f/%.*f/%.*f %d", dt, dig,
 		b.Open[idx], dig, b.High[idx], dig, b.Low[idx], dig, b.Close[idx],
 		int(b.Volume[idx]))
 }
@@ -146,22 +154,7 @@ func (b *Bars) loadBars(sym string, period Period, startDt, endDt timeT64) error
 		return nil
 	}
 	switch period {
-	case Min1, Min5:
-		if cnt := len(minBarsBase); cnt < nInstruments {
-			nb := make([]*Bars, nInstruments)
-			if cnt > 0 {
-				copy(nb, minBarsBase)
-			}
-			minBarsBase = nb
-		}
-	case Daily:
-		if cnt := len(dayBarsBase); cnt < nInstruments {
-			nb := make([]*Bars, nInstruments)
-			if cnt > 0 {
-				copy(nb, dayBarsBase)
-			}
-			dayBarsBase = nb
-		}
+	case Min1, Min5, Daily:
 	default:
 		return errInvalidPeriod
 	}
@@ -176,13 +169,72 @@ func (b *Bars) loadBars(sym string, period Period, startDt, endDt timeT64) error
 	b.period = period
 	b.startDt = startDt
 	b.endDt = endDt
+	setBaseBars(b)
+	return nil
+}
+
+// setBaseBars ... put Bars to base cache, Min1/Min5 or Daily
+func setBaseBars(b *Bars) {
+	if b.symKey <= 0 {
+		return
+	}
+	growBase := func(base []*Bars) []*Bars {
+		if cnt := len(base); cnt < nInstruments {
+			nb := make([]*Bars, nInstruments)
+			if cnt > 0 {
+				copy(nb, base)
+			}
+			return nb
+		}
+		return base
+	}
+	switch b.period {
+	case Min1, Min5:
+		minBarsBase = growBase(minBarsBase)
+		minBarsBase[b.symKey-1] = b
+	case Daily:
+		dayBarsBase = growBase(dayBarsBase)
+		dayBarsBase[b.symKey-1] = b
+	default:
+		return
+	}
+	cacheAdd(baseCacheID(int(b.symKey), b.period), barsSize(b))
+}
+
+// baseCacheID ... cache entry of base Bars, Min1/Min5 share one slot
+func baseCacheID(fKey int, period Period) cacheID {
+	if period == Min5 {
+		period = Min1
+	}
+	return cacheID{kind: cacheKindBaseBars, hash: fKey, period: period}
+}
+
+// clearBaseBars ... drop base Bars evicted by cache manager
+func clearBaseBars(fKey int, period Period) {
 	switch period {
 	case Min1, Min5:
-		minBarsBase[si.fKey-1] = b
+		if fKey > 0 && fKey <= len(minBarsBase) {
+			minBarsBase[fKey-1] = nil
+		}
 	case Daily:
-		dayBarsBase[si.fKey-1] = b
+		if fKey > 0 && fKey <= len(dayBarsBase) {
+			dayBarsBase[fKey-1] = nil
+		}
 	}
+}
 
+// getBaseBars ... base Bars of symbol for period, nil for not cached
+func getBaseBars(fKey int, period Period) *Bars {
+	switch period {
+	case Min1, Min5:
+		if fKey > 0 && fKey <= len(minBarsBase) {
+			return minBarsBase[fKey-1]
+		}
+	case Daily:
+		if fKey > 0 && fKey <= len(dayBarsBase) {
+			return dayBarsBase[fKey-1]
+		}
+	}
 	return nil
 }
 
@@ -191,7 +243,7 @@ func (b *Bars) timeBars(curTime DateTimeMs) *Bars {
 	if cnt == 0 {
 		return b
 	}
-	lastT, _ := periodBaseTime(curTime.Unix(), b.period)
+	lastT := barBaseTime(b.symKey, curTime.Unix(), b.period)
 	if b.Date[cnt-1].Unix() < lastT {
 		return b
 	}
@@ -224,6 +276,9 @@ func (b *Bars) timeBars(curTime DateTimeMs) *Bars {
 
 // Get Bars for symbol with period
 func getBars(sym string, period Period, curTime DateTimeMs) (res *Bars, err error) {
+	if isContSymbol(sym) {
+		return getContBars(sym, period, curTime)
+	}
 	si, err := GetSymbolInfo(sym)
 	if si.fKey <= 0 {
 		err = errInvalidSymbol
@@ -278,16 +333,19 @@ func getBarsByKey(fKey int, period Period, curTime DateTimeMs) (res *Bars, err e
 
 	if period != baseBars.period {
 		bkey := getBarCacheHash(fKey, period)
+		cid := cacheID{kind: cacheKindBars, hash: bkey}
 		if cc, ok := cacheBars[bkey]; ok {
 			res = &cc.Bars
 			if res.endDt.Unix() >= baseBars.endDt.Unix() {
 				cc.lastAccess = timeT64FromTime(time.Now())
+				cacheHit(cid)
 				res = res.timeBars(curTime)
 				return
 			}
 			// baseBars get updated, resample
 			delete(cacheBars, bkey)
 		}
+		cacheMiss(cacheKindBars)
 		if res, err = baseBars.reSample(period); err != nil {
 			return
 		}
@@ -297,6 +355,7 @@ func getBarsByKey(fKey int, period Period, curTime DateTimeMs) (res *Bars, err e
 		cc.loadTime = cc.lastAccess
 		cc.basePeriod = basePeriod
 		cacheBars[bkey] = &cc
+		cacheAdd(cid, barsSize(res))
 	} else {
 		res = baseBars
 	}
@@ -335,6 +394,7 @@ func periodBaseTime(t int64, period Period) (res int64, mon time.Month) {
 }
 
 // resample Bars
+//	bars aligned to session opens and trading day if sessions defined
 func (b *Bars) reSample(newPeriod Period) (res *Bars, err error) {
 	if newPeriod < b.period {
 		err = errInvalidPeriod
@@ -347,72 +407,27 @@ func (b *Bars) reSample(newPeriod Period) (res *Bars, err error) {
 		fallthrough
 	case Hour1, Hour2, Hour4, Hour8:
 		fallthrough
-	case Daily:
-		fallthrough
-	case Weekly:
+	case Daily, Weekly, Monthly:
 		cnt := len(b.Open)
 		res = &Bars{symKey: b.symKey}
 		res.period = newPeriod
 		for i := 0; i < cnt; i++ {
-			if b.Date[i].Unix() >= vDate+int64(newPeriod) {
+			base := barBaseTime(b.symKey, b.Date[i].Unix(), newPeriod)
+			if vDate != 0 && base != vDate {
 				// new Bar
-				if vDate != 0 {
-					res.Date = append(res.Date, timeT64FromInt64(vDate))
-					res.Open = append(res.Open, vOpen)
-					res.High = append(res.High, vHigh)
-					res.Low = append(res.Low, vLow)
-					res.Close = append(res.Close, vClose)
-					res.Volume = append(res.Volume, volume)
-				}
+				res.Date = append(res.Date, timeT64FromInt64(vDate))
+				res.Open = append(res.Open, vOpen)
+				res.High = append(res.High, vHigh)
+				res.Low = append(res.Low, vLow)
+				res.Close = append(res.Close, vClose)
+				res.Volume = append(res.Volume, volume)
 				vDate = 0
 				vHigh = 0
 				vLow = 0
 				volume = 0
 			}
 			if vDate == 0 {
-				vDate, _ = periodBaseTime(b.Date[i].Unix(), newPeriod)
-				vOpen = b.Open[i]
-			}
-			if vHigh == 0 || b.High[i] > vHigh {
-				vHigh = b.High[i]
-			}
-			if vLow == 0 || b.Low[i] < vLow {
-				vLow = b.Low[i]
-			}
-			vClose = b.Close[i]
-			volume += b.Volume[i]
-		}
-		if vDate != 0 {
-			res.Date = append(res.Date, timeT64FromInt64(vDate))
-			res.Open = append(res.Open, vOpen)
-			res.High = append(res.High, vHigh)
-			res.Low = append(res.Low, vLow)
-			res.Close = append(res.Close, vClose)
-			res.Volume = append(res.Volume, volume)
-		}
-	case Monthly:
-		cnt := len(b.Open)
-		res = &Bars{}
-		res.period = newPeriod
-		var mon time.Month
-		for i := 0; i < cnt; i++ {
-			if mon != b.Date[i].Time().Month() {
-				// new Bar
-				if vDate != 0 {
-					res.Date = append(res.Date, timeT64FromInt64(vDate))
-					res.Open = append(res.Open, vOpen)
-					res.High = append(res.High, vHigh)
-					res.Low = append(res.Low, vLow)
-					res.Close = append(res.Close, vClose)
-					res.Volume = append(res.Volume, volume)
-				}
-				vDate = 0
-				vHigh = 0
-				vLow = 0
-				volume = 0
-			}
-			if vDate == 0 {
-				vDate, mon = periodBaseTime(b.Date[i].Unix(), newPeriod)
+				vDate = base
 				vOpen = b.Open[i]
 			}
 			if vHigh == 0 || b.High[i] > vHigh {
@@ -432,6 +447,9 @@ func (b *Bars) reSample(newPeriod Period) (res *Bars, err error) {
 			res.Close = append(res.Close, vClose)
 			res.Volume = append(res.Volume, volume)
 		}
+	default:
+		err = errInvalidPeriod
+		return
 	}
 	res.startDt = b.startDt
 	res.endDt = b.endDt
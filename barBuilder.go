@@ -0,0 +1,212 @@
+package ats
+
+// formBar ... forming bar of one period, date 0 for no tick yet
+//	partial for the first bar after builder started, missing earlier ticks
+type formBar struct {
+	partial bool
+	date    int64
+	open    float64
+	high    float64
+	low     float64
+	close   float64
+	volume  float64
+}
+
+func (fb *formBar) update(date int64, price, vol float64) {
+	if fb.date == 0 {
+		fb.date = date
+		fb.open, fb.high, fb.low = price, price, price
+		fb.volume = 0
+	}
+	if price > fb.high {
+		fb.high = price
+	}
+	if price < fb.low {
+		fb.low = price
+	}
+	fb.close = price
+	fb.volume += vol
+}
+
+// appendBar ... append closed bar, replace last bar with same date
+//	last bar of resampled Bars maybe partial
+func (b *Bars) appendBar(fb *formBar) {
+	cnt := len(b.Date)
+	if cnt > 0 && b.Date[cnt-1].Unix() > fb.date {
+		return
+	}
+	if cnt > 0 && b.Date[cnt-1].Unix() == fb.date {
+		cnt--
+		b.Date = b.Date[:cnt]
+		b.Open = b.Open[:cnt]
+		b.High = b.High[:cnt]
+		b.Low = b.Low[:cnt]
+		b.Close = b.Close[:cnt]
+		b.Volume = b.Volume[:cnt]
+	}
+	b.Date = append(b.Date, timeT64FromInt64(fb.date))
+	b.Open = append(b.Open, fb.open)
+	b.High = append(b.High, fb.high)
+	b.Low = append(b.Low, fb.low)
+	b.Close = append(b.Close, fb.close)
+	b.Volume = append(b.Volume, fb.volume)
+	if b.startDt.Unix() == 0 {
+		b.startDt = b.Date[0]
+	}
+	if endT := barNextTime(b.symKey, fb.date, b.period); endT > b.endDt.Unix() {
+		b.endDt = timeT64FromInt64(endT)
+	}
+}
+
+// barBuilder ... build Bars of periods incrementally from ticks
+//	closed bar of base period (Min1/Min5 and Daily) appended to base Bars
+//	served by getBarsByKey, resampled Bars in cacheBars extended by
+//	closed bars of same period, other resampled Bars invalidated
+type barBuilder struct {
+	symKey  SymbolKey
+	minBase Period
+	periods []Period
+	timer   *barTimer
+	bars    map[Period]*formBar
+	lastVol int64
+}
+
+// newBarBuilder ... build bars of periods for symbol, base periods included
+func newBarBuilder(symKey SymbolKey, periods []Period) *barBuilder {
+	bb := &barBuilder{symKey: symKey, minBase: Min1, bars: map[Period]*formBar{}}
+	if base := getBaseBars(int(symKey), Min1); base != nil {
+		bb.minBase = base.period
+	}
+	bb.periods = addPeriod(bb.periods, Daily)
+	for _, p := range periods {
+		if p < Daily && p < bb.minBase {
+			continue
+		}
+		if p < Daily {
+			bb.periods = addPeriod(bb.periods, bb.minBase)
+		}
+		bb.periods = addPeriod(bb.periods, p)
+	}
+	for _, p := range bb.periods {
+		bb.bars[p] = &formBar{}
+	}
+	return bb
+}
+
+// basePeriod ... base period of Bars resampled to period
+func (bb *barBuilder) basePeriod(p Period) Period {
+	if p < Daily {
+		return bb.minBase
+	}
+	return Daily
+}
+
+// onQuote ... update forming bars with quotes, return periods closed
+//	Volume of quotes accumulated, Last for price
+func (bb *barBuilder) onQuote(q *Quotes, t int64) []Period {
+	vol := q.Volume - bb.lastVol
+	if vol < 0 {
+		// volume reset for new trading day
+		vol = q.Volume
+	}
+	bb.lastVol = q.Volume
+	return bb.update(t, q.Last, float64(vol))
+}
+
+// update ... close bars before t, then update forming bars with tick
+//	return periods closed, ascending order
+func (bb *barBuilder) update(t int64, price, vol float64) (res []Period) {
+	if bb.timer == nil {
+		bb.timer = &barTimer{symKey: bb.symKey, periods: bb.periods}
+		bb.timer.reset(t)
+		for p, fb := range bb.bars {
+			fb.partial = barBaseTime(bb.symKey, t, p) != t
+		}
+	} else if res = bb.timer.closed(t); len(res) > 0 {
+		bb.commit(res)
+	}
+	if price == 0 {
+		return
+	}
+	for p, fb := range bb.bars {
+		fb.update(barBaseTime(bb.symKey, t, p), price, vol)
+	}
+	return
+}
+
+// nextClose ... time of next bar close, 0 before first tick
+func (bb *barBuilder) nextClose() (res int64) {
+	if bb.timer == nil {
+		return 0
+	}
+	for _, t := range bb.timer.next {
+		if res == 0 || t < res {
+			res = t
+		}
+	}
+	return
+}
+
+// closeBars ... close bars ended till t without tick, return periods closed
+func (bb *barBuilder) closeBars(t int64) (res []Period) {
+	if bb.timer == nil {
+		return
+	}
+	if res = bb.timer.closed(t); len(res) > 0 {
+		bb.commit(res)
+	}
+	return
+}
+
+// commit ... append closed bars to base Bars and cached resampled Bars
+func (bb *barBuilder) commit(closed []Period) {
+	fKey := int(bb.symKey)
+	oldEnd := map[Period]int64{}
+	for _, p := range closed {
+		fb := bb.bars[p]
+		if fb.date == 0 {
+			continue
+		}
+		if base := bb.basePeriod(p); p == base {
+			b := getBaseBars(fKey, p)
+			if b == nil || b.period != p {
+				b = &Bars{symKey: bb.symKey, period: p}
+				setBaseBars(b)
+			}
+			oldEnd[p] = b.endDt.Unix()
+			// partial bar never replace loaded history
+			if cnt := len(b.Date); !fb.partial || cnt == 0 ||
+				b.Date[cnt-1].Unix() < fb.date {
+				b.appendBar(fb)
+				cacheAdd(baseCacheID(fKey, p), barsSize(b))
+			}
+		} else if cc, ok := cacheBars[getBarCacheHash(fKey, p)]; ok {
+			cid := cacheID{kind: cacheKindBars, hash: getBarCacheHash(fKey, p)}
+			if fb.partial {
+				delete(cacheBars, cid.hash)
+				cacheRemove(cid)
+			} else {
+				cc.Bars.appendBar(fb)
+				cacheAdd(cid, barsSize(&cc.Bars))
+			}
+		}
+		*fb = formBar{}
+	}
+	// resampled Bars in sync with base Bars extended, others resample
+	for base, endT := range oldEnd {
+		b := getBaseBars(fKey, base)
+		if b == nil {
+			// evicted by cache manager
+			continue
+		}
+		for _, p := range bb.periods {
+			if p == base || bb.basePeriod(p) != base {
+				continue
+			}
+			if cc, ok := cacheBars[getBarCacheHash(fKey, p)]; ok &&
+				cc.endDt.Unix() >= endT {
+				cc.endDt = b.endDt
+			}
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestBarBuilder(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("USDCAD")
+	si, _ := GetSymbolInfo("USDCAD")
+	fKey := int(si.fKey)
+	// isolate cache accounting from other tests
+	oldMgr := cacheMgr
+	cacheMgr = newCacheManager(0)
+	defer func() { cacheMgr = oldMgr }()
+	bb := newBarBuilder(si.fKey, []Period{Min5, Min15})
+	if !reflect.DeepEqual(bb.periods, []Period{Min1, Min5, Min15, Daily}) {
+		t.Error("periods diff", bb.periods)
+	}
+	st := time.Date(2019, 1, 28, 10, 0, 0, 0, time.UTC).Unix()
+	feed := func(from, to int64) {
+		for tt := from; tt < to; tt += 20 {
+			bb.update(tt, 0.95+float64(tt%600)*0.00001, 1)
+		}
+	}
+	feed(st, st+20*60+1)
+	base := getBaseBars(fKey, Min1)
+	if base == nil || len(base.Date) != 20 || base.Volume[0] != 3 {
+		t.Fatal("base Bars diff", base)
+	}
+	curT := timeT64FromInt64(st + 20*60).DateTimeMs()
+	if res, err := getBarsByKey(fKey, Min5, curT); err != nil || len(res.Date) != 4 {
+		t.Fatal("getBarsByKey Min5", err, res)
+	}
+	if _, err := getBarsByKey(fKey, Min15, curT); err != nil {
+		t.Fatal("getBarsByKey Min15", err)
+	}
+	cc := cacheBars[getBarCacheHash(fKey, Min5)]
+	loadT := cc.loadTime
+	feed(st+20*60+20, st+40*60+1)
+	curT = timeT64FromInt64(st + 40*60).DateTimeMs()
+	for _, p := range []Period{Min5, Min15} {
+		res, err := getBarsByKey(fKey, p, curT)
+		if err != nil {
+			t.Error("getBarsByKey", p, err)
+			continue
+		}
+		want, _ := base.reSample(p)
+		want = want.timeBars(curT)
+		if !reflect.DeepEqual(res.Date, want.Date) || !reflect.DeepEqual(res.Close, want.Close) ||
+			!reflect.DeepEqual(res.Volume, want.Volume) {
+			t.Errorf("%s extended bars diff %v, want %v", p, res.Close, want.Close)
+		}
+	}
+	// Min5 cache extended, not resampled
+	if cc2 := cacheBars[getBarCacheHash(fKey, Min5)]; cc2 != cc || cc2.loadTime != loadT ||
+		len(cc2.Date) != 8 {
+		t.Error("Min5 cache not extended", cc2)
+	}
+	// base and cached Bars accounted by appended size
+	if st := getCacheStats(cacheKindBaseBars); st.entries != 1 || st.bytes != barsSize(base) {
+		t.Error("base Bars cache stats diff", st)
+	}
+	cc2 := cacheBars[getBarCacheHash(fKey, Min5)]
+	if st := getCacheStats(cacheKindBars); st.bytes != barsSize(&cc2.Bars)+
+		barsSize(&cacheBars[getBarCacheHash(fKey, Min15)].Bars) {
+		t.Error("cached Bars stats diff", st)
+	}
+}
@@ -70,12 +70,10 @@ func loadMinFX(pair string, startD julian.JulianDay) (res []minDT, err error) {
 	return
 }
 
-var cacheDukasHits int
-var cacheDukasMiss int
-
-// DukasCacheStatus dump cache usage
+// DukasCacheStatus dump cache usage of Min1 and tick data
 func DukasCacheStatus() string {
-	return fmt.Sprintf("DukasCache Status: Hits %d, Miss: %d", cacheDukasHits, cacheDukasMiss)
+	return fmt.Sprintf("DukasCache Status: %s\nDukasTick Status: %s",
+		getCacheStats(cacheKindMinFX), getCacheStats(cacheKindTickDB))
 }
 
 // LoadMinFX DukasCopy forex Min1 data
@@ -89,19 +87,28 @@ func LoadMinFX(pair string, startD, endD julian.JulianDay, maxCnt int) (res []Mi
 		}
 	}
 	startD = startD.Weekbase()
+	cid := cacheID{kind: cacheKindMinFX, name: pair}
 	if cc, ok := cacheMinFX[pair]; ok {
 		if startD >= cc.startD && endD == cc.endD {
 			res = cc.res
-			cacheDukasHits++
+			cacheHit(cid)
 			return
 		}
 	}
-	cacheDukasMiss++
+	cacheMiss(cacheKindMinFX)
 	var cc = cacheMinFXType{startD: startD, endD: endD}
 
+	market := "FX"
+	if si, err := GetSymbolInfo(pair); err == nil {
+		market = si.Market
+	}
 	tCnt := 0
 	var mins []minDT
-	for endD == 0 || startD < endD {
+	for ; endD == 0 || startD < endD; startD += 7 {
+		if TradingDaysBetween(market, startD.Add(-1), startD.Add(6)) == 0 {
+			// whole week of holidays
+			continue
+		}
 		mins, err = loadMinFX(pair, startD)
 		if err != nil {
 			if len(res) > 0 && os.IsNotExist(err) {
@@ -115,11 +122,11 @@ func LoadMinFX(pair string, startD, endD julian.JulianDay, maxCnt int) (res []Mi
 		if maxCnt != 0 && tCnt >= maxCnt {
 			break
 		}
-		startD += 7
 	}
 	cc.res = res
 	if maxCnt == 0 {
 		cacheMinFX[pair] = cc
+		cacheAdd(cid, minFXSize(res))
 	}
 	return
 }
@@ -0,0 +1,192 @@
+package ats
+
+import (
+	"math"
+	"sort"
+)
+
+// Bars as Series/TaSeries/TimeSeries, negative index for reverse order,
+// -1 for last bar. Field Close of Bars taken, Series of column via
+// OpenSeries/HighSeries/LowSeries/CloseSeries/VolumeSeries
+
+// Len ... number of bars
+func (b *Bars) Len() int {
+	return len(b.Date)
+}
+
+// BarValue ... OHLCV of bar i, -1 for last bar
+func (b *Bars) BarValue(i int) (Ti timeT64, Op, Hi, Lo, Cl float64, Vol float64) {
+	if i < 0 {
+		i += len(b.Date)
+	}
+	return b.Date[i], b.Open[i], b.High[i], b.Low[i], b.Close[i], b.Volume[i]
+}
+
+// OpenSeries ... open price as Series
+func (b *Bars) OpenSeries() Series {
+	return FloatSeries(b.Open)
+}
+
+// HighSeries ... high price as Series
+func (b *Bars) HighSeries() Series {
+	return FloatSeries(b.High)
+}
+
+// LowSeries ... low price as Series
+func (b *Bars) LowSeries() Series {
+	return FloatSeries(b.Low)
+}
+
+// CloseSeries ... close price as Series
+func (b *Bars) CloseSeries() Series {
+	return FloatSeries(b.Close)
+}
+
+// VolumeSeries ... volume as Series
+func (b *Bars) VolumeSeries() Series {
+	return FloatSeries(b.Volume)
+}
+
+// Index ... index of last bar with Date not after t, -1 for before first bar
+func (b *Bars) Index(t timeT64) int {
+	tt := t.Unix()
+	return sort.Search(len(b.Date), func(i int) bool {
+		return b.Date[i].Unix() > tt
+	}) - 1
+}
+
+// barsTimeSeries ... column of Bars indexed by time
+type barsTimeSeries struct {
+	b   *Bars
+	col []float64
+}
+
+func (s barsTimeSeries) Len() int {
+	return len(s.col)
+}
+
+// DataAt ... value of last bar not after t, NaN for before first bar
+func (s barsTimeSeries) DataAt(t timeT64) float64 {
+	if i := s.Index(t); i >= 0 {
+		return s.col[i]
+	}
+	return math.NaN()
+}
+
+func (s barsTimeSeries) Index(t timeT64) int {
+	return s.b.Index(t)
+}
+
+// TimeSeries ... close price indexed by time
+func (b *Bars) TimeSeries() TimeSeries {
+	return barsTimeSeries{b: b, col: b.Close}
+}
+
+// BarsSince ... number of bars since cond last true, 0 for last bar,
+//		-1 for never
+func BarsSince(s Series, cond func(v float64) bool) int {
+	cnt := s.Len()
+	for i := cnt - 1; i >= 0; i-- {
+		if cond(s.DataAt(i)) {
+			return cnt - 1 - i
+		}
+	}
+	return -1
+}
+
+// BarsSince ... number of bars since cond of bar index last true,
+//		0 for last bar, -1 for never
+func (b *Bars) BarsSince(cond func(i int) bool) int {
+	cnt := len(b.Date)
+	for i := cnt - 1; i >= 0; i-- {
+		if cond(i) {
+			return cnt - 1 - i
+		}
+	}
+	return -1
+}
+
+// windowSeries ... last n data of Series
+type windowSeries struct {
+	s     Series
+	start int
+	n     int
+}
+
+func (w windowSeries) Len() int {
+	return w.n
+}
+
+func (w windowSeries) DataAt(i int) float64 {
+	if i < 0 {
+		i += w.n
+	}
+	return w.s.DataAt(w.start + i)
+}
+
+// Lookback ... window of last n data, whole Series if less than n
+func Lookback(s Series, n int) Series {
+	cnt := s.Len()
+	if n > cnt {
+		n = cnt
+	}
+	if n < 0 {
+		n = 0
+	}
+	return windowSeries{s: s, start: cnt - n, n: n}
+}
+
+// Lookback ... last n bars share data with b, whole Bars if less than n
+func (b *Bars) Lookback(n int) *Bars {
+	cnt := len(b.Date)
+	if n >= cnt {
+		return b
+	}
+	if n < 0 {
+		n = 0
+	}
+	j := cnt - n
+	res := Bars{symKey: b.symKey, period: b.period, startDt: b.startDt,
+		endDt: b.endDt}
+	res.Date = b.Date[j:]
+	res.Open = b.Open[j:]
+	res.High = b.High[j:]
+	res.Low = b.Low[j:]
+	res.Close = b.Close[j:]
+	res.Volume = b.Volume[j:]
+	return &res
+}
+
+// AlignBars ... align close of Bars to shared timeline, union of bar dates
+//		close forward filled, NaN before first bar of symbol
+func AlignBars(bars ...*Bars) (timeline []timeT64, closes []FloatSeries) {
+	idx := make([]int, len(bars))
+	for {
+		// next date of all bars
+		next := int64(math.MaxInt64)
+		for i, b := range bars {
+			if idx[i] < len(b.Date) && b.Date[idx[i]].Unix() < next {
+				next = b.Date[idx[i]].Unix()
+			}
+		}
+		if next == math.MaxInt64 {
+			break
+		}
+		timeline = append(timeline, timeT64FromInt64(next))
+		for i, b := range bars {
+			if idx[i] < len(b.Date) && b.Date[idx[i]].Unix() == next {
+				idx[i]++
+			}
+		}
+	}
+	closes = make([]FloatSeries, len(bars))
+	for i, b := range bars {
+		ts := b.TimeSeries()
+		res := make(FloatSeries, len(timeline))
+		for j, t := range timeline {
+			res[j] = ts.DataAt(t)
+		}
+		closes[i] = res
+	}
+	return
+}
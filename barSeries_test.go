@@ -0,0 +1,81 @@
+package ats
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+func testBars(dates []int64, closes []float64) *Bars {
+	b := &Bars{period: Daily}
+	for i, d := range dates {
+		b.Date = append(b.Date, timeT64FromInt64(d*86400))
+		b.Open = append(b.Open, closes[i])
+		b.High = append(b.High, closes[i]+1)
+		b.Low = append(b.Low, closes[i]-1)
+		b.Close = append(b.Close, closes[i])
+		b.Volume = append(b.Volume, 10)
+	}
+	return b
+}
+
+func TestBarsSeries(t *testing.T) {
+	b := testBars([]int64{1, 2, 4, 5, 8}, []float64{10, 11, 12, 11, 13})
+	var ta TaSeries = b
+	if ti, _, hi, _, cl, _ := ta.BarValue(-1); ta.Len() != 5 || cl != 13 || hi != 14 ||
+		ti.Unix() != 8*86400 {
+		t.Error("BarValue(-1) diff", ti, hi, cl)
+	}
+	if cs := b.CloseSeries(); cs.DataAt(-2) != 11 || cs.DataAt(0) != 10 {
+		t.Error("CloseSeries diff")
+	}
+	ts := b.TimeSeries()
+	tests := []struct {
+		day  int64
+		idx  int
+		want float64
+	}{
+		{0, -1, math.NaN()},
+		{1, 0, 10},
+		{3, 1, 11},
+		{5, 3, 11},
+		{9, 4, 13},
+	}
+	for _, tt := range tests {
+		t1 := timeT64FromInt64(tt.day * 86400)
+		if got := ts.Index(t1); got != tt.idx {
+			t.Errorf("Index(%d) = %d, want %d", tt.day, got, tt.idx)
+		}
+		if got := ts.DataAt(t1); !sameFloat(got, tt.want) {
+			t.Errorf("DataAt(%d) = %g, want %g", tt.day, got, tt.want)
+		}
+	}
+	if n := BarsSince(b.CloseSeries(), func(v float64) bool { return v == 12 }); n != 2 {
+		t.Error("BarsSince", n)
+	}
+	if n := b.BarsSince(func(i int) bool { return b.Close[i] > 20 }); n != -1 {
+		t.Error("Bars.BarsSince", n)
+	}
+	lb := Lookback(b.CloseSeries(), 3)
+	if !reflect.DeepEqual(NewSlice(lb), []float64{12, 11, 13}) || lb.DataAt(-3) != 12 {
+		t.Error("Lookback diff", NewSlice(lb))
+	}
+	if bl := b.Lookback(2); bl.Len() != 2 || bl.Close[0] != 11 {
+		t.Error("Bars.Lookback diff", bl.Close)
+	}
+	b2 := testBars([]int64{2, 3, 8}, []float64{20, 21, 22})
+	timeline, closes := AlignBars(b, b2)
+	if len(timeline) != 6 || timeline[2].Unix() != 3*86400 {
+		t.Error("timeline diff", timeline)
+	}
+	want := [][]float64{{10, 11, 11, 12, 11, 13},
+		{math.NaN(), 20, 21, 21, 21, 22}}
+	for i := range want {
+		for j, v := range want[i] {
+			if !sameFloat(closes[i][j], v) {
+				t.Errorf("aligned %d diff %v, want %v", i, closes[i], want[i])
+				break
+			}
+		}
+	}
+}
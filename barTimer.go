@@ -0,0 +1,95 @@
+package ats
+
+import (
+	"sort"
+	"time"
+)
+
+// periodNextTime ... start time of next bar, end of bar contains t
+func periodNextTime(t int64, period Period) int64 {
+	res, _ := periodBaseTime(t, period)
+	if period == Monthly {
+		y, mon, _ := timeT64FromInt64(res).Time().Date()
+		return time.Date(y, mon+1, 1, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	return res + int64(period)
+}
+
+// barTimer ... detect bar close of multiple periods
+//	bar closed while time reach start of next bar
+//	symKey	session aligned bars of symbol, 0 for plain period
+//	market	Daily of plain period closed at end of trading day of market
+type barTimer struct {
+	symKey  SymbolKey
+	market  string
+	periods []Period
+	next    []int64
+}
+
+// newBarTimer ... barTimer with periods ascending, bars start from t
+func newBarTimer(periods []Period, t int64) *barTimer {
+	return newMarketBarTimer("", periods, t)
+}
+
+// newMarketBarTimer ... barTimer with Daily by trading days of market
+func newMarketBarTimer(market string, periods []Period, t int64) *barTimer {
+	bt := &barTimer{market: market}
+	for _, p := range periods {
+		bt.add(p)
+	}
+	bt.reset(t)
+	return bt
+}
+
+// addPeriod ... insert p to ascending periods, invalid or duplicated ignored
+//	period of BarSpec ignored
+func addPeriod(periods []Period, p Period) []Period {
+	if p < Min1 || p.isAlt() || p.String() == "Inv Period" {
+		return periods
+	}
+	i := sort.Search(len(periods), func(i int) bool { return periods[i] >= p })
+	if i < len(periods) && periods[i] == p {
+		return periods
+	}
+	periods = append(periods, 0)
+	copy(periods[i+1:], periods[i:])
+	periods[i] = p
+	return periods
+}
+
+// add ... add period to timer, should reset after add
+func (bt *barTimer) add(p Period) {
+	bt.periods = addPeriod(bt.periods, p)
+}
+
+// reset ... bars start from t
+func (bt *barTimer) reset(t int64) {
+	bt.next = make([]int64, len(bt.periods))
+	for i, p := range bt.periods {
+		bt.next[i] = bt.nextTime(t, p)
+	}
+}
+
+// nextTime ... start time of next bar of period p
+//		Daily closed at end of trading day in local time of market
+func (bt *barTimer) nextTime(t int64, p Period) int64 {
+	if p == Daily {
+		market := bt.market
+		if si, err := bt.symKey.SymbolInfo(); err == nil && si.symbolBase != nil {
+			market = si.Market
+		}
+		return dayEndTime(market, t)
+	}
+	return barNextTime(bt.symKey, t, p)
+}
+
+// closed ... periods closed till t, ascending order
+func (bt *barTimer) closed(t int64) (res []Period) {
+	for i, p := range bt.periods {
+		if t >= bt.next[i] {
+			res = append(res, p)
+			bt.next[i] = bt.nextTime(t, p)
+		}
+	}
+	return
+}
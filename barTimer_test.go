@@ -0,0 +1,146 @@
+package ats
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_periodNextTime(t *testing.T) {
+	// 2019-01-31 23:59:30 Thursday
+	tt := time.Date(2019, 1, 31, 23, 59, 30, 0, time.UTC).Unix()
+	tests := []struct {
+		name   string
+		period Period
+		want   time.Time
+	}{
+		{"Min1", Min1, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"Min15", Min15, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"Hour4", Hour4, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"Daily", Daily, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"Weekly", Weekly, time.Date(2019, 2, 3, 0, 0, 0, 0, time.UTC)},
+		{"Monthly", Monthly, time.Date(2019, 2, 1, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tt1 := range tests {
+		t.Run(tt1.name, func(t *testing.T) {
+			if got := periodNextTime(tt, tt1.period); got != tt1.want.Unix() {
+				t.Errorf("periodNextTime() = %v, want %v",
+					timeT64FromInt64(got).Time(), tt1.want)
+			}
+		})
+	}
+}
+
+func TestBarTimer(t *testing.T) {
+	st := time.Date(2019, 1, 28, 0, 0, 30, 0, time.UTC).Unix()
+	bt := newBarTimer([]Period{Weekly, Min15, Min5, Hour4, Min5, 0}, st)
+	if len(bt.periods) != 4 || bt.periods[0] != Min5 || bt.periods[3] != Weekly {
+		t.Error("periods diff", bt.periods)
+	}
+	cnt := map[Period]int{}
+	// one tick every 2 minutes for 7 days
+	for tt := st; tt < st+7*86400; tt += 120 {
+		for _, p := range bt.closed(tt) {
+			cnt[p]++
+			if base, _ := periodBaseTime(tt, p); tt-base >= 120 {
+				t.Errorf("%s bar closed late at %v", p, timeT64FromInt64(tt).Time())
+			}
+		}
+	}
+	// last bars of 7th day not closed yet
+	want := map[Period]int{Min5: 7*288 - 1, Min15: 7*96 - 1, Hour4: 7*6 - 1, Weekly: 1}
+	for p, n := range want {
+		if cnt[p] != n {
+			t.Errorf("%s closed %d bars, want %d", p, cnt[p], n)
+		}
+	}
+}
+
+type barStrat struct {
+	bars map[Period]int
+}
+
+func (b *barStrat) ParamSet() []Parameter               { return nil }
+func (b *barStrat) Init(c *Context) (Strategyer, error) { return b, nil }
+func (b *barStrat) OnTick(sym string)                   {}
+func (b *barStrat) OnBar(sym string, period Period)     { b.bars[period]++ }
+func (b *barStrat) DeInit()                             {}
+func (b *barStrat) Periods() []Period                   { return []Period{Min15, Hour4} }
+
+type timeBroker struct {
+	Broker
+}
+
+func TestStrategyRunnerLiveBars(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("NZDUSD")
+	si, _ := GetSymbolInfo("NZDUSD")
+	br := &timeBroker{}
+	bs := &barStrat{bars: map[Period]int{}}
+	sc := newStrategyRunner()
+	sc.contxt = newContext(br)
+	sc.strats["bars"] = bs
+	sc.assignSymbol("NZDUSD", "bars")
+	sc.stratPeriods["bars"] = bs.Periods()
+	sc.barPeriods = []Period{Min1, Min15, Hour4}
+	sc.barBuilders = map[string]*barBuilder{}
+	st := TimeToDateTimeMs(time.Date(2019, 1, 28, 0, 0, 30, 0, time.UTC))
+	for i := 0; i < 24*60; i++ {
+		si.getQuotesPtr().Store(Quotes{UpdateTime: st.Add(i * 60000),
+			Last: 0.68 + float64(i%10)*0.0001})
+		sc.emitLiveBars(&si)
+	}
+	// Min1 not declared by strategy
+	if len(bs.bars) != 2 || bs.bars[Min15] != 95 || bs.bars[Hour4] != 5 {
+		t.Error("OnBar diff", bs.bars)
+	}
+	if res, err := getBars("NZDUSD", Hour4, st.Add(1439*60000)); err != nil {
+		t.Error("getBars", err)
+	} else if len(res.Date) != 5 {
+		t.Error("live Hour4 bars diff", res)
+	}
+}
+
+func TestStrategyRunnerTimedBars(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("AUDUSD")
+	si, _ := GetSymbolInfo("AUDUSD")
+	br := &timeBroker{}
+	bs := &barStrat{bars: map[Period]int{}}
+	sc := newStrategyRunner()
+	sc.contxt = newContext(br)
+	sc.strats["bars"] = bs
+	sc.assignSymbol("AUDUSD", "bars")
+	sc.stratPeriods["bars"] = bs.Periods()
+	sc.barPeriods = []Period{Min1, Min15, Hour4}
+	sc.barBuilders = map[string]*barBuilder{}
+	if next := sc.nextBarClose(); next != 0 {
+		t.Error("nextBarClose before tick", next)
+	}
+	st := TimeToDateTimeMs(time.Date(2019, 1, 28, 0, 0, 30, 0, time.UTC))
+	for i := 0; i < 14; i++ {
+		si.getQuotesPtr().Store(Quotes{UpdateTime: st.Add(i * 60000), Last: 0.72})
+		sc.emitLiveBars(&si)
+	}
+	// no tick after 00:13:30, Min15 bar closed by timer
+	close15 := time.Date(2019, 1, 28, 0, 15, 0, 0, time.UTC).Unix()
+	if next := sc.nextBarClose(); next != close15-60 {
+		t.Error("nextBarClose diff", next, close15-60)
+	}
+	sc.emitTimedBars(close15 - 1)
+	if bs.bars[Min15] != 0 {
+		t.Error("Min15 closed early", bs.bars)
+	}
+	sc.emitTimedBars(close15)
+	if bs.bars[Min15] != 1 || bs.bars[Hour4] != 0 {
+		t.Error("OnBar by timer diff", bs.bars)
+	}
+	if next := sc.nextBarClose(); next != close15+60 {
+		t.Error("nextBarClose after close diff", next, close15+60)
+	}
+	// first tick after not close again
+	si.getQuotesPtr().Store(Quotes{UpdateTime: st.Add(15 * 60000), Last: 0.72})
+	sc.emitLiveBars(&si)
+	if bs.bars[Min15] != 1 {
+		t.Error("Min15 closed twice", bs.bars)
+	}
+}
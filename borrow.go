@@ -0,0 +1,105 @@
+package ats
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"sync"
+)
+
+// short selling mode of template, "short" of symbols.json
+//	""			short freely, FX and futures
+//	"none"		short selling not allowed
+//	"borrow"	short only shares available in borrow list
+const (
+	ShortFree   = ""
+	ShortNone   = "none"
+	ShortBorrow = "borrow"
+)
+
+var (
+	errShortNotAllowed = errors.New("Short selling not allowed")
+	errNoBorrow        = errors.New("No borrow available for short")
+	errBorrowExceeded  = errors.New("Short over borrow available")
+)
+
+// BorrowAvail ... shares available to borrow for short and annual fee rate
+//	Rate	0 for BorrowRate of template
+type BorrowAvail struct {
+	Qty  int     `json:"qty"`
+	Rate float64 `json:"rate,omitempty"`
+}
+
+var borrowOnce sync.Once
+var borrowLock sync.RWMutex
+var borrows = map[string]BorrowAvail{}
+
+// loadBorrows ... load borrow.json, symbol to borrow available
+//		{"sh600600": {"qty": 100000, "rate": 0.0835}}
+func loadBorrows() {
+	borrowOnce.Do(func() {
+		bb, err := ioutil.ReadFile("borrow.json")
+		if err != nil {
+			return
+		}
+		var recMap map[string]BorrowAvail
+		if err := json.Unmarshal(bb, &recMap); err != nil {
+			log.Warning("Decode borrow.json", err)
+			return
+		}
+		for sym, ba := range recMap {
+			SetBorrow(sym, ba)
+		}
+	})
+}
+
+// SetBorrow ... set borrow available of symbol, Qty 0 to remove
+func SetBorrow(sym string, ba BorrowAvail) {
+	borrowLock.Lock()
+	defer borrowLock.Unlock()
+	if ba.Qty <= 0 {
+		delete(borrows, sym)
+		return
+	}
+	borrows[sym] = ba
+}
+
+// GetBorrow ... borrow available of symbol, false for not in borrow list
+func GetBorrow(sym string) (BorrowAvail, bool) {
+	loadBorrows()
+	borrowLock.RLock()
+	defer borrowLock.RUnlock()
+	ba, ok := borrows[sym]
+	return ba, ok
+}
+
+// checkShort ... verify short of qty for symbol by short mode of template
+func (s *SymbolInfo) checkShort(qty int) error {
+	if s.symbolBase == nil {
+		return nil
+	}
+	switch s.ShortMode {
+	case ShortNone:
+		return errShortNotAllowed
+	case ShortBorrow:
+		ba, ok := GetBorrow(s.Ticker)
+		if !ok {
+			return errNoBorrow
+		}
+		if qty > ba.Qty {
+			return errBorrowExceeded
+		}
+	}
+	return nil
+}
+
+// borrowRate ... annual borrow fee rate of symbol, 0 for no fee
+func (s *SymbolInfo) borrowRate() float64 {
+	if s.symbolBase == nil || s.ShortMode != ShortBorrow {
+		return 0
+	}
+	if ba, ok := GetBorrow(s.Ticker); ok && ba.Rate > 0 {
+		return ba.Rate
+	}
+	return s.BorrowRate
+}
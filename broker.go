@@ -4,18 +4,22 @@ import (
 	"errors"
 )
 
-// OrderDirT current only Buy/Sell, no hedge position
+// OrderDirT Buy/Sell, open/close of long/short leg for hedging account
 type OrderDirT int32
 
 // OrderDirBuy ...	Buy long open
 // OrderDirSell ...	Sell short open
 // OrderDirCover ...	Buy cover short
 // OrderDirClose ...	Sell close long
+// OrderDirCoverToday ...	Buy cover short opened today
+// OrderDirCloseToday ...	Sell close long opened today
 const (
 	OrderDirBuy OrderDirT = iota
 	OrderDirSell
 	OrderDirCover
 	OrderDirClose
+	OrderDirCoverToday
+	OrderDirCloseToday
 )
 
 // Sign ...	for order dir
@@ -30,6 +34,11 @@ func (orDir OrderDirT) IsOffset() bool {
 	return orDir > OrderDirSell
 }
 
+// IsToday ...	return true for close/offset of leg opened today
+func (orDir OrderDirT) IsToday() bool {
+	return orDir > OrderDirClose
+}
+
 func (orDir OrderDirT) String() string {
 	switch orDir {
 	case OrderDirBuy:
@@ -40,6 +49,10 @@ func (orDir OrderDirT) String() string {
 		return "Cover"
 	case OrderDirClose:
 		return "SellClose"
+	case OrderDirCoverToday:
+		return "CoverToday"
+	case OrderDirCloseToday:
+		return "CloseToday"
 	}
 	return "NA"
 }
@@ -55,6 +68,7 @@ const (
 	OrderPartFilled
 	OrderFilled
 	OrderCanceled
+	OrderRejected
 )
 
 func (oSt OrderStatusT) String() string {
@@ -71,6 +85,8 @@ func (oSt OrderStatusT) String() string {
 		return "Filled"
 	case OrderCanceled:
 		return "Canceled"
+	case OrderRejected:
+		return "Rejected"
 	}
 	return "Invalid"
 }
@@ -82,6 +98,7 @@ func (oSt OrderStatusT) String() string {
 //	Dir		OrderBuy, OrderSell
 //	Qty		order quantity
 //	QtyFilled
+//	Magic	magic of strategy sent order, 0 for none
 type OrderType struct {
 	Symbol    string
 	Price     float64
@@ -97,11 +114,54 @@ type OrderType struct {
 }
 
 // PositionType ...		position for symbol of account
+//	Positions	net position, long leg minus short leg for hedging account
+//	Long/Short	legs of hedging account, zero for netting account
+//	Realized	realized P&L of symbol in base currency
+//	Unrealized	unrealized P&L at last quote
+//	OpenTime	time of position opened from flat
+//	MFE/MAE		max favorable/adverse excursion of unrealized since open
+//	Fees		borrow fees and swaps charged, credits negative
 type PositionType struct {
-	fKey      SymbolKey
+	fKey       SymbolKey
+	Positions  int
+	PosFreeze  int
+	AvgPrice   float64 // average price for position
+	Long       PositionLeg
+	Short      PositionLeg
+	Realized   float64
+	Unrealized float64
+	OpenTime   DateTimeMs
+	MFE        float64
+	MAE        float64
+	Fees       float64
+	markPx     float64 // price of last mark, 0 after position changed
+}
+
+// PositionLeg ...	long or short leg of hedging position
+//	Today	opened today, Positions - Today opened before
+type PositionLeg struct {
 	Positions int
-	PosFreeze int
-	AvgPrice  float64 // average price for position
+	Today     int
+	AvgPrice  float64
+}
+
+// DealType ...	fill of order or position adjusted by broker
+//	Oid		-1 for broker generated, like roll of continuous futures
+//	Reason	"" for order fill, "roll" for continuous futures roll,
+//		"expiry" for close of expired contract at settlement price,
+//		"borrow" for daily borrow fee of short, Profit as -fee,
+//		"swap" for rollover swap, Price as points of swap,
+//		"dividend" for cash dividend, Price as dividend per share,
+//		"split" for bonus/split shares, Price as share factor
+type DealType struct {
+	Time   DateTimeMs
+	Symbol string
+	Dir    OrderDirT
+	Qty    int
+	Price  float64
+	Profit float64
+	Oid    int
+	Reason string
 }
 
 // Broker ...	interface for abstract broker
@@ -125,6 +185,62 @@ type Broker interface {
 	TimeCurrent() DateTimeMs // return current time of broker server in millisecond timestamp
 }
 
+// BarBroker ...	optional for Broker, emit bar close events of periods
+//	brokers without BarBroker, bar events built from ticks by strategy runner
+type BarBroker interface {
+	SubscribePeriods(periods []Period) error // emit QuoteEvent for period bar closed
+}
+
+// TradeType ...	round trip of position side, entry from flat till exit flat
+//	Dir		OrderDirBuy for long, OrderDirSell for short
+//	Qty		quantity of entries
+//	EntryPrice/ExitPrice	average price of entries/exits
+//	MFE/MAE		max favorable/adverse excursion of unrealized P&L
+type TradeType struct {
+	Symbol     string
+	Dir        OrderDirT
+	Qty        int
+	EntryTime  DateTimeMs
+	EntryPrice float64
+	ExitTime   DateTimeMs
+	ExitPrice  float64
+	Profit     float64
+	MFE        float64
+	MAE        float64
+	Fees       float64
+	exitQty    int
+}
+
+// TradeBroker ...	optional for Broker, round trips of positions
+type TradeBroker interface {
+	GetTrades() []TradeType // round trips closed, in exit time order
+}
+
+// MagicBroker ...	optional for Broker, orders tagged with magic of strategy
+type MagicBroker interface {
+	SendOrderMagic(sym string, dir OrderDirT, qty int, prc float64, stopL float64,
+		magic int) int
+}
+
+// HedgeBroker ...	optional for Broker, hedging account with long and short
+//	legs per symbol, Buy/Sell open legs and Cover/Close offset legs
+type HedgeBroker interface {
+	SetHedging(on bool) error // switch position mode, no positions
+	Hedging() bool
+}
+
+// JournalBroker ...	optional for Broker, journal of deals
+type JournalBroker interface {
+	GetDeals() []DealType // deals of account, in time order
+}
+
+// AltBarBroker ...	optional for Broker, build non-time bars of BarSpec
+//	from ticks, emit QuoteEvent with EventID of BarSpec period while closed
+//	brokers without AltBarBroker, built from quotes by strategy runner
+type AltBarBroker interface {
+	SubscribeBarSpecs(specs []BarSpec) error
+}
+
 var errBrokerExist = errors.New("Broker registered")
 var errBrokerNotExist = errors.New("Borker not registered")
 var brokers = map[string]Broker{}
@@ -0,0 +1,245 @@
+package ats
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// cacheKind ... kind of data cache managed by cache manager
+type cacheKind int
+
+const (
+	cacheKindBars cacheKind = iota
+	cacheKindBaseBars
+	cacheKindMinFX
+	cacheKindDayTA
+	cacheKindTickDB
+	cacheKindCount
+)
+
+func (k cacheKind) String() string {
+	switch k {
+	case cacheKindBars:
+		return "Bars"
+	case cacheKindBaseBars:
+		return "BaseBars"
+	case cacheKindMinFX:
+		return "MinFX"
+	case cacheKindDayTA:
+		return "DayTA"
+	case cacheKindTickDB:
+		return "TickDB"
+	}
+	return "Inv cacheKind"
+}
+
+// cacheID ... entry of cache, name for symbol/pair keyed caches,
+//	hash for cacheBars, fKey in hash and period for base Bars
+type cacheID struct {
+	kind   cacheKind
+	name   string
+	hash   int
+	period Period
+}
+
+type cacheEntry struct {
+	id   cacheID
+	size int64
+}
+
+// cacheStats ... statistics of one cache kind
+type cacheStats struct {
+	hits      int
+	misses    int
+	evictions int
+	entries   int
+	bytes     int64
+}
+
+// DefCacheBudget ... default byte budget of data caches, 1GiB
+const DefCacheBudget = int64(1) << 30
+
+// cacheManager ... LRU of cacheBars, base Bars, cacheMinFX, cacheDayTA and tickDbMap
+//	total bytes over budget, least recently used entries evicted
+//	budget 0 for unlimited
+type cacheManager struct {
+	lock   sync.Mutex
+	budget int64
+	used   int64
+	lru    *list.List
+	items  map[cacheID]*list.Element
+	stats  [cacheKindCount]cacheStats
+}
+
+var cacheMgr = newCacheManager(DefCacheBudget)
+
+func newCacheManager(budget int64) *cacheManager {
+	return &cacheManager{budget: budget, lru: list.New(),
+		items: map[cacheID]*list.Element{}}
+}
+
+// SetCacheBudget ... set byte budget of data caches, 0 for unlimited
+//		entries over budget evicted immediately
+func SetCacheBudget(budget int64) {
+	if budget < 0 {
+		budget = 0
+	}
+	cm := cacheMgr
+	cm.lock.Lock()
+	cm.budget = budget
+	evicted := cm.shrink(nil)
+	cm.lock.Unlock()
+	cacheEvict(evicted)
+}
+
+// CacheBudget ... byte budget and bytes used of data caches
+func CacheBudget() (budget, used int64) {
+	cm := cacheMgr
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	return cm.budget, cm.used
+}
+
+// shrink ... remove LRU entries until under budget, except keep
+//		return ids removed, caller should evict data after unlock
+func (cm *cacheManager) shrink(keep *list.Element) (res []cacheID) {
+	if cm.budget == 0 {
+		return
+	}
+	for e := cm.lru.Back(); e != nil && cm.used > cm.budget; {
+		prev := e.Prev()
+		if e != keep {
+			ce := e.Value.(*cacheEntry)
+			cm.remove(e)
+			cm.stats[ce.id.kind].evictions++
+			res = append(res, ce.id)
+		}
+		e = prev
+	}
+	return
+}
+
+func (cm *cacheManager) remove(e *list.Element) {
+	ce := e.Value.(*cacheEntry)
+	cm.lru.Remove(e)
+	delete(cm.items, ce.id)
+	cm.used -= ce.size
+	st := &cm.stats[ce.id.kind]
+	st.entries--
+	st.bytes -= ce.size
+}
+
+// cacheEvict ... delete evicted data from caches
+func cacheEvict(ids []cacheID) {
+	for _, id := range ids {
+		switch id.kind {
+		case cacheKindBars:
+			delete(cacheBars, id.hash)
+		case cacheKindBaseBars:
+			clearBaseBars(id.hash, id.period)
+		case cacheKindMinFX:
+			delete(cacheMinFX, id.name)
+		case cacheKindDayTA:
+			delete(cacheDayTA, id.name)
+		case cacheKindTickDB:
+			delete(tickDbMap, id.name)
+		}
+		log.Infof("cache evict %s %s(%d)", id.kind, id.name, id.hash)
+	}
+}
+
+// cacheAdd ... add or update entry as most recently used, evict others
+//		while over budget
+func cacheAdd(id cacheID, size int64) {
+	cm := cacheMgr
+	cm.lock.Lock()
+	e, ok := cm.items[id]
+	if ok {
+		ce := e.Value.(*cacheEntry)
+		cm.used += size - ce.size
+		cm.stats[id.kind].bytes += size - ce.size
+		ce.size = size
+		cm.lru.MoveToFront(e)
+	} else {
+		e = cm.lru.PushFront(&cacheEntry{id: id, size: size})
+		cm.items[id] = e
+		cm.used += size
+		st := &cm.stats[id.kind]
+		st.entries++
+		st.bytes += size
+	}
+	evicted := cm.shrink(e)
+	cm.lock.Unlock()
+	cacheEvict(evicted)
+}
+
+// cacheHit ... count hit, entry as most recently used
+func cacheHit(id cacheID) {
+	cm := cacheMgr
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	cm.stats[id.kind].hits++
+	if e, ok := cm.items[id]; ok {
+		cm.lru.MoveToFront(e)
+	}
+}
+
+// cacheMiss ... count miss of cache kind
+func cacheMiss(kind cacheKind) {
+	cm := cacheMgr
+	cm.lock.Lock()
+	cm.stats[kind].misses++
+	cm.lock.Unlock()
+}
+
+// cacheRemove ... remove entry of data deleted by caller
+func cacheRemove(id cacheID) {
+	cm := cacheMgr
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	if e, ok := cm.items[id]; ok {
+		cm.remove(e)
+	}
+}
+
+func getCacheStats(kind cacheKind) cacheStats {
+	cm := cacheMgr
+	cm.lock.Lock()
+	defer cm.lock.Unlock()
+	return cm.stats[kind]
+}
+
+func (st cacheStats) String() string {
+	return fmt.Sprintf("Hits %d, Miss: %d, Evictions: %d, Entries: %d, Bytes: %d",
+		st.hits, st.misses, st.evictions, st.entries, st.bytes)
+}
+
+// CacheStatus ... dump usage of all data caches
+func CacheStatus() string {
+	budget, used := CacheBudget()
+	res := fmt.Sprintf("Cache Budget: %d, Used: %d", budget, used)
+	for k := cacheKind(0); k < cacheKindCount; k++ {
+		res += fmt.Sprintf("\n%s: %s", k, getCacheStats(k))
+	}
+	return res
+}
+
+// sizes of cached data
+func barsSize(b *Bars) int64 {
+	return int64(len(b.Date)) * int64(unsafe.Sizeof(timeT64{})+5*8)
+}
+
+func minFXSize(res []MinFX) int64 {
+	return int64(len(res)) * int64(unsafe.Sizeof(MinFX{}))
+}
+
+func dayTASize(res []DayTA) int64 {
+	return int64(len(res)) * int64(unsafe.Sizeof(DayTA{}))
+}
+
+func tickDBSize(db *tickDB) int64 {
+	return int64(len(db.tickBuf))*int64(unsafe.Sizeof(TickFX{})) +
+		int64(len(db.nodes))*int64(unsafe.Sizeof(tNode{}))
+}
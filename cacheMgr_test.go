@@ -0,0 +1,96 @@
+package ats
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCacheManager(t *testing.T) {
+	// isolate from entries of other tests
+	oldMgr := cacheMgr
+	cacheMgr = newCacheManager(0)
+	defer func() { cacheMgr = oldMgr }()
+	dayN := []string{"testDay1", "testDay2", "testDay3"}
+	for _, sym := range dayN {
+		cacheDayTA[sym] = cacheDayTAType{res: make([]DayTA, 10)}
+	}
+	cacheMinFX["testFX1"] = cacheMinFXType{res: make([]MinFX, 10)}
+	daySize := dayTASize(make([]DayTA, 10))
+	fxSize := minFXSize(make([]MinFX, 10))
+	for _, sym := range dayN {
+		cacheAdd(cacheID{kind: cacheKindDayTA, name: sym}, daySize)
+	}
+	// testDay1 most recently used
+	cacheHit(cacheID{kind: cacheKindDayTA, name: "testDay1"})
+	SetCacheBudget(2*daySize + fxSize)
+	cacheAdd(cacheID{kind: cacheKindMinFX, name: "testFX1"}, fxSize)
+	tests := []struct {
+		name string
+		kept bool
+	}{
+		{"testDay1", true},
+		{"testDay2", false},
+		{"testDay3", true},
+	}
+	for _, tt := range tests {
+		if _, ok := cacheDayTA[tt.name]; ok != tt.kept {
+			t.Errorf("%s kept %v, want %v", tt.name, ok, tt.kept)
+		}
+	}
+	if _, ok := cacheMinFX["testFX1"]; !ok {
+		t.Error("last added should be kept")
+	}
+	st := getCacheStats(cacheKindDayTA)
+	if st.hits != 1 || st.evictions != 1 || st.entries != 2 {
+		t.Error("DayTA stats diff", st)
+	}
+	if _, used := CacheBudget(); used != 2*daySize+fxSize {
+		t.Error("used diff", used)
+	}
+	if !strings.Contains(DayDbCacheStatus(), "Evictions") {
+		t.Error("DayDbCacheStatus", DayDbCacheStatus())
+	}
+	t.Log(CacheStatus())
+	for _, sym := range dayN {
+		delete(cacheDayTA, sym)
+		cacheRemove(cacheID{kind: cacheKindDayTA, name: sym})
+	}
+	delete(cacheMinFX, "testFX1")
+	cacheRemove(cacheID{kind: cacheKindMinFX, name: "testFX1"})
+}
+
+func TestCacheEvictBaseBars(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("EURUSD")
+	si, err := GetSymbolInfo("EURUSD")
+	if err != nil {
+		t.Skip("no EURUSD", err)
+	}
+	fKey := int(si.fKey)
+	oldMgr := cacheMgr
+	cacheMgr = newCacheManager(0)
+	oldDay, oldMin := getBaseBars(fKey, Daily), getBaseBars(fKey, Min1)
+	defer func() {
+		cacheMgr = oldMgr
+		dayBarsBase[fKey-1], minBarsBase[fKey-1] = oldDay, oldMin
+	}()
+	for _, p := range []Period{Daily, Min5} {
+		b := &Bars{symKey: si.fKey, period: p}
+		b.Date = make([]timeT64, 10)
+		setBaseBars(b)
+	}
+	if st := getCacheStats(cacheKindBaseBars); st.entries != 2 {
+		t.Fatal("base Bars not registered", st)
+	}
+	// evict all
+	SetCacheBudget(1)
+	if b := getBaseBars(fKey, Daily); b != nil {
+		t.Error("Daily base Bars not freed", b)
+	}
+	if b := getBaseBars(fKey, Min5); b != nil {
+		t.Error("Min5 base Bars not freed", b)
+	}
+	if _, used := CacheBudget(); used != 0 {
+		t.Error("used after evict", used)
+	}
+}
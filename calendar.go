@@ -0,0 +1,168 @@
+package ats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kjx98/golib/julian"
+)
+
+// tradingCalendar ... holidays and half days of market
+//	Saturday and Sunday never trading day
+//	halfDays	early close, seconds from local midnight
+type tradingCalendar struct {
+	holidays map[julian.JulianDay]bool
+	halfDays map[julian.JulianDay]int64
+}
+
+// calendarRec ... record of holidays.json, date as yyyymmdd
+type calendarRec struct {
+	Holidays []uint32          `json:"holidays,omitempty"`
+	HalfDays map[string]string `json:"halfDays,omitempty"`
+}
+
+var calendarOnce sync.Once
+var calendarLock sync.RWMutex
+var calendars = map[string]*tradingCalendar{}
+
+// loadCalendars ... load holidays.json, markets separated by comma share
+//	holidays and half days
+//		{"SHSE,SZSE": {"holidays": [20190101], "halfDays": {"20191224": "13:00"}}}
+func loadCalendars() {
+	calendarOnce.Do(func() {
+		bb, err := ioutil.ReadFile("holidays.json")
+		if err != nil {
+			return
+		}
+		var recMap map[string]calendarRec
+		if err := json.Unmarshal(bb, &recMap); err != nil {
+			log.Warning("Decode holidays.json", err)
+			return
+		}
+		for markets, rec := range recMap {
+			for _, market := range strings.Split(markets, ",") {
+				market = strings.TrimSpace(market)
+				for _, d := range rec.Holidays {
+					AddHoliday(market, julian.FromUint32(d))
+				}
+				for d, closeT := range rec.HalfDays {
+					dd, _ := strconv.ParseUint(d, 10, 32)
+					jd := julian.FromUint32(uint32(dd))
+					if err := AddHalfDay(market, jd, closeT); err != nil {
+						log.Warning("halfDay of", market, d, err)
+					}
+				}
+			}
+		}
+	})
+}
+
+func getCalendar(market string) *tradingCalendar {
+	loadCalendars()
+	calendarLock.RLock()
+	defer calendarLock.RUnlock()
+	return calendars[market]
+}
+
+func newCalendar(market string) *tradingCalendar {
+	cal, ok := calendars[market]
+	if !ok {
+		cal = &tradingCalendar{holidays: map[julian.JulianDay]bool{},
+			halfDays: map[julian.JulianDay]int64{}}
+		calendars[market] = cal
+	}
+	return cal
+}
+
+// AddHoliday ... add holiday of market
+func AddHoliday(market string, jd julian.JulianDay) {
+	calendarLock.Lock()
+	defer calendarLock.Unlock()
+	newCalendar(market).holidays[jd] = true
+}
+
+// AddHalfDay ... add half day of market, early close as HH:MM local time
+func AddHalfDay(market string, jd julian.JulianDay, closeT string) error {
+	tod, err := parseSessionTime(closeT)
+	if err != nil {
+		return err
+	}
+	calendarLock.Lock()
+	defer calendarLock.Unlock()
+	newCalendar(market).halfDays[jd] = tod
+	return nil
+}
+
+// IsTradingDay ... true for weekday not holiday of market
+func IsTradingDay(market string, jd julian.JulianDay) bool {
+	if !isWorkDay(jd) {
+		return false
+	}
+	if cal := getCalendar(market); cal != nil {
+		calendarLock.RLock()
+		defer calendarLock.RUnlock()
+		return !cal.holidays[jd]
+	}
+	return true
+}
+
+// NextTradingDay ... next trading day of market after jd
+func NextTradingDay(market string, jd julian.JulianDay) julian.JulianDay {
+	for jd = nextWorkDay(jd); !IsTradingDay(market, jd); jd = nextWorkDay(jd) {
+	}
+	return jd
+}
+
+// PrevTradingDay ... previous trading day of market before jd
+func PrevTradingDay(market string, jd julian.JulianDay) julian.JulianDay {
+	for jd = prevWorkDay(jd); !IsTradingDay(market, jd); jd = prevWorkDay(jd) {
+	}
+	return jd
+}
+
+// TradingDaysBetween ... number of trading days of market after from till
+//		to, negative for to before from
+func TradingDaysBetween(market string, from, to julian.JulianDay) (res int) {
+	sign := 1
+	if to < from {
+		from, to, sign = to, from, -1
+	}
+	for jd := from.Add(1); jd <= to; jd = jd.Add(1) {
+		if IsTradingDay(market, jd) {
+			res++
+		}
+	}
+	return res * sign
+}
+
+// HalfDayClose ... early close of half day, seconds from local midnight
+func HalfDayClose(market string, jd julian.JulianDay) (int64, bool) {
+	if cal := getCalendar(market); cal != nil {
+		calendarLock.RLock()
+		defer calendarLock.RUnlock()
+		tod, ok := cal.halfDays[jd]
+		return tod, ok
+	}
+	return 0, false
+}
+
+// TradingDaysOfYear ... number of trading days of market in year
+func TradingDaysOfYear(market string, year int) int {
+	return TradingDaysBetween(market, julian.NewJulianDay(year-1, 12, 31),
+		julian.NewJulianDay(year, 12, 31))
+}
+
+// AnnualizedReturn ... annualized rate of ret from day from to day to,
+//		by trading days of market
+func AnnualizedReturn(market string, ret float64, from, to julian.JulianDay) float64 {
+	days := TradingDaysBetween(market, from, to)
+	if days <= 0 || ret <= -1 {
+		return 0
+	}
+	y, _, _ := to.Date()
+	return math.Pow(1+ret, float64(TradingDaysOfYear(market, y))/float64(days)) - 1
+}
@@ -0,0 +1,82 @@
+package ats
+
+import (
+	"testing"
+	"time"
+
+	"github.com/kjx98/golib/julian"
+)
+
+func TestTradingCalendar(t *testing.T) {
+	const market = "TESTCAL"
+	// Friday and Monday holidays
+	AddHoliday(market, julian.NewJulianDay(2019, 11, 1))
+	AddHoliday(market, julian.NewJulianDay(2019, 11, 4))
+	if err := AddHalfDay(market, julian.NewJulianDay(2019, 11, 29), "13:00"); err != nil {
+		t.Error("AddHalfDay", err)
+	}
+	if err := AddHalfDay(market, julian.NewJulianDay(2019, 11, 29), "1300"); err == nil {
+		t.Error("AddHalfDay should fail for invalid time")
+	}
+	tests := []struct {
+		name string
+		jd   julian.JulianDay
+		next julian.JulianDay
+		prev julian.JulianDay
+	}{
+		{"before holidays", julian.NewJulianDay(2019, 10, 31),
+			julian.NewJulianDay(2019, 11, 5), julian.NewJulianDay(2019, 10, 30)},
+		{"after holidays", julian.NewJulianDay(2019, 11, 5),
+			julian.NewJulianDay(2019, 11, 6), julian.NewJulianDay(2019, 10, 31)},
+		{"holiday", julian.NewJulianDay(2019, 11, 1),
+			julian.NewJulianDay(2019, 11, 5), julian.NewJulianDay(2019, 10, 31)},
+		{"weekend", julian.NewJulianDay(2019, 11, 9),
+			julian.NewJulianDay(2019, 11, 11), julian.NewJulianDay(2019, 11, 8)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NextTradingDay(market, tt.jd); got != tt.next {
+				t.Errorf("NextTradingDay() = %v, want %v", got, tt.next)
+			}
+			if got := PrevTradingDay(market, tt.jd); got != tt.prev {
+				t.Errorf("PrevTradingDay() = %v, want %v", got, tt.prev)
+			}
+		})
+	}
+	if IsTradingDay(market, julian.NewJulianDay(2019, 11, 4)) ||
+		!IsTradingDay("", julian.NewJulianDay(2019, 11, 4)) {
+		t.Error("IsTradingDay diff")
+	}
+	from, to := julian.NewJulianDay(2019, 10, 31), julian.NewJulianDay(2019, 11, 8)
+	if n := TradingDaysBetween(market, from, to); n != 4 {
+		t.Error("TradingDaysBetween diff", n)
+	}
+	if n := TradingDaysBetween(market, to, from); n != -4 {
+		t.Error("TradingDaysBetween reverse diff", n)
+	}
+	if n := TradingDaysOfYear("", 2019); n != 261 {
+		t.Error("TradingDaysOfYear diff", n)
+	}
+	if r := round(AnnualizedReturn("", 0.1, julian.NewJulianDay(2018, 12, 31),
+		julian.NewJulianDay(2019, 12, 31))); r != 0.1 {
+		t.Error("AnnualizedReturn diff", r)
+	}
+	// early close of half day
+	ms, err := newMarketSessions("America/New_York", []string{"09:30-16:00"})
+	if err != nil {
+		t.Skip("newMarketSessions", err)
+	}
+	ms.market = market
+	at := func(m, d, hh, mm int) int64 {
+		return time.Date(2019, time.Month(m), d, hh, mm, 0, 0, ms.loc).Unix()
+	}
+	if got := ms.nextTime(at(11, 29, 12, 40), Min30); got != at(12, 2, 9, 30) {
+		t.Error("half day nextTime diff", time.Unix(got, 0).In(ms.loc))
+	}
+	if got := ms.nextTime(at(11, 28, 12, 40), Min30); got != at(11, 28, 13, 0) {
+		t.Error("nextTime diff", time.Unix(got, 0).In(ms.loc))
+	}
+	if got := ms.nextTime(at(10, 31, 12, 40), Daily); got != julian.NewJulianDay(2019, 11, 5).UTC().Unix() {
+		t.Error("Daily nextTime diff", time.Unix(got, 0).UTC())
+	}
+}
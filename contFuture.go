@@ -0,0 +1,436 @@
+package ats
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/kjx98/golib/julian"
+)
+
+// RollMode ... roll rule of continuous futures
+type RollMode int
+
+const (
+	// RollByOI - contract of max open interest, volume if no open interest
+	RollByOI RollMode = iota
+	// RollByVolume - contract of max volume
+	RollByVolume
+	// RollByDays - roll to next contract Days before expiry
+	RollByDays
+)
+
+// ContAdjust ... price adjustment of continuous futures history
+type ContAdjust int
+
+const (
+	// ContAdjustBack - earlier prices shifted by roll gaps, latest kept
+	ContAdjustBack ContAdjust = iota
+	// ContAdjustRatio - earlier prices multiplied by roll ratios
+	ContAdjustRatio
+	// ContAdjustNone - contracts spliced without adjustment
+	ContAdjustNone
+)
+
+// ContRule ... roll and adjustment rule of continuous symbol
+type ContRule struct {
+	Mode   RollMode
+	Days   int // days before expiry for RollByDays
+	Adjust ContAdjust
+}
+
+var defContRule = ContRule{Mode: RollByOI, Days: 5, Adjust: ContAdjustBack}
+
+var errNotContSymbol = errors.New("Not continuous symbol")
+var errNoContracts = errors.New("No contracts with daily Bars")
+
+// contRoll ... roll of continuous symbol
+//	day		first trading day of new contract
+//	fromP, toP	close of contracts on trading day before roll
+type contRoll struct {
+	day   julian.JulianDay
+	from  SymbolKey
+	to    SymbolKey
+	fromP float64
+	toP   float64
+}
+
+// contSeries ... continuous symbol like cu@main, contracts of root rolled
+type contSeries struct {
+	root  string
+	fKey  SymbolKey
+	rule  ContRule
+	built bool
+	first SymbolKey
+	rolls []contRoll
+}
+
+var contLock sync.Mutex
+var contSeriesMap = map[string]*contSeries{}
+
+// open interest of contracts by trading day
+var openInts = map[SymbolKey]map[julian.JulianDay]float64{}
+
+func isContSymbol(sym string) bool {
+	return strings.IndexByte(sym, '@') > 0
+}
+
+// AddOpenInterest ... open interest of contract on trading day, for RollByOI
+func AddOpenInterest(sym string, day julian.JulianDay, oi float64) error {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return err
+	}
+	contLock.Lock()
+	defer contLock.Unlock()
+	m, ok := openInts[si.fKey]
+	if !ok {
+		m = map[julian.JulianDay]float64{}
+		openInts[si.fKey] = m
+	}
+	m[day] = oi
+	for _, cs := range contSeriesMap {
+		cs.built = false
+	}
+	return nil
+}
+
+// SetContRule ... set roll rule of continuous symbol, default RollByOI
+//		with back adjustment
+func SetContRule(sym string, rule ContRule) error {
+	contLock.Lock()
+	defer contLock.Unlock()
+	cs, err := getContSeries(sym)
+	if err != nil {
+		return err
+	}
+	cs.rule = rule
+	cs.built = false
+	return nil
+}
+
+// getContSeries ... continuous series of sym, contLock held by caller
+func getContSeries(sym string) (*contSeries, error) {
+	if cs, ok := contSeriesMap[sym]; ok {
+		return cs, nil
+	}
+	if !isContSymbol(sym) {
+		return nil, errNotContSymbol
+	}
+	newSymbolInfo(sym)
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return nil, err
+	}
+	cs := &contSeries{root: sym[:strings.IndexByte(sym, '@')], fKey: si.fKey,
+		rule: defContRule}
+	contSeriesMap[sym] = cs
+	return cs, nil
+}
+
+// deliverDate ... year and month of delivery from ticker, like cu1905,
+//		SR905 or ESM9, one digit year resolved as not before ref
+func deliverDate(si *SymbolInfo, ref julian.JulianDay) (year, month int) {
+	sym := si.Ticker
+	i := len(sym)
+	for i > 0 && sym[i-1] >= '0' && sym[i-1] <= '9' {
+		i--
+	}
+	digits := sym[i:]
+	month = si.deliverMonth
+	if len(digits) >= 3 {
+		digits = digits[:len(digits)-2]
+	}
+	for _, c := range digits {
+		year = year*10 + int(c-'0')
+	}
+	refY, _, _ := ref.Date()
+	switch len(digits) {
+	case 1:
+		year += refY - refY%10
+		if year < refY {
+			year += 10
+		}
+	case 2:
+		year += 2000
+	}
+	return
+}
+
+// contract ... contract of continuous series with daily Bars
+type contract struct {
+	si     *SymbolInfo
+	expiry julian.JulianDay
+	bars   *Bars
+	dayIdx map[julian.JulianDay]int
+	oi     map[julian.JulianDay]float64
+}
+
+func barDay(b *Bars, i int) julian.JulianDay {
+	return timeT64FromInt64(barBaseTime(b.symKey, b.Date[i].Unix(),
+		Daily)).DateTimeMs().JulianDay()
+}
+
+// contracts ... contracts of root with daily Bars, ascending expiry
+func (cs *contSeries) contracts() (res []*contract) {
+	// slots of symInfoCaches never moved, pointers valid after unlock
+	var syms []*SymbolInfo
+	instRWlock.RLock()
+	for i := range symInfoCaches {
+		si := &symInfoCaches[i]
+		if si.deliverMonth == 0 || !strings.HasPrefix(si.Ticker, cs.root) ||
+			isContSymbol(si.Ticker) {
+			continue
+		}
+		// prefix of other root, like cu for cus
+		if c := si.Ticker[len(cs.root)]; (c < '0' || c > '9') &&
+			(len(si.Ticker) != len(cs.root)+2 ||
+				strings.IndexByte(usDeliverMonth, c) <= 0) {
+			continue
+		}
+		syms = append(syms, si)
+	}
+	instRWlock.RUnlock()
+	for _, si := range syms {
+		b := getBaseBars(int(si.fKey), Daily)
+		if b == nil || len(b.Date) == 0 {
+			continue
+		}
+		ct := &contract{si: si, bars: b, dayIdx: map[julian.JulianDay]int{},
+			oi: openInts[si.fKey]}
+		for j := range b.Date {
+			ct.dayIdx[barDay(b, j)] = j
+		}
+		ct.expiry = si.LastTradeDay(barDay(b, 0))
+		res = append(res, ct)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].expiry < res[j].expiry })
+	return
+}
+
+// metric ... open interest or volume of contract on day, false for no bar
+func (ct *contract) metric(day julian.JulianDay, useOI bool) (float64, bool) {
+	j, ok := ct.dayIdx[day]
+	if !ok {
+		return 0, false
+	}
+	if useOI {
+		if oi, ok := ct.oi[day]; ok {
+			return oi, true
+		}
+	}
+	return ct.bars.Volume[j], true
+}
+
+func (ct *contract) close(day julian.JulianDay) (float64, bool) {
+	if j, ok := ct.dayIdx[day]; ok {
+		return ct.bars.Close[j], true
+	}
+	return 0, false
+}
+
+// pick ... contract held after day, never roll to earlier contract
+func (cs *contSeries) pick(ctrs []*contract, cur int, day julian.JulianDay) int {
+	if cs.rule.Mode == RollByDays {
+		for j := cur; j < len(ctrs); j++ {
+			if ctrs[j].expiry.Sub(day) <= cs.rule.Days {
+				continue
+			}
+			if _, ok := ctrs[j].dayIdx[day]; ok {
+				return j
+			}
+		}
+		return cur
+	}
+	useOI := cs.rule.Mode == RollByOI
+	best := cur
+	for j := cur + 1; j < len(ctrs); j++ {
+		// open interest of both contracts, or volume
+		oi := useOI && ctrs[best].oi != nil && ctrs[j].oi != nil
+		m, ok := ctrs[j].metric(day, oi)
+		if !ok {
+			continue
+		}
+		if bm, ok := ctrs[best].metric(day, oi); !ok || m > bm {
+			best = j
+		}
+	}
+	return best
+}
+
+// build ... roll schedule from daily Bars of contracts
+func (cs *contSeries) build() error {
+	ctrs := cs.contracts()
+	if len(ctrs) == 0 {
+		return errNoContracts
+	}
+	dayMap := map[julian.JulianDay]bool{}
+	for _, ct := range ctrs {
+		for d := range ct.dayIdx {
+			dayMap[d] = true
+		}
+	}
+	days := make([]julian.JulianDay, 0, len(dayMap))
+	for d := range dayMap {
+		days = append(days, d)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i] < days[j] })
+	cur := 0
+	for cur < len(ctrs)-1 {
+		if _, ok := ctrs[cur].dayIdx[days[0]]; ok {
+			break
+		}
+		cur++
+	}
+	cur = cs.pick(ctrs, cur, days[0])
+	cs.first = ctrs[cur].si.fKey
+	cs.rolls = nil
+	for i, d := range days[:len(days)-1] {
+		next := cs.pick(ctrs, cur, d)
+		if next == cur {
+			continue
+		}
+		fromP, ok1 := ctrs[cur].close(d)
+		toP, ok2 := ctrs[next].close(d)
+		if !ok2 {
+			continue
+		}
+		if !ok1 {
+			// expired contract, no gap
+			fromP = toP
+		}
+		cs.rolls = append(cs.rolls, contRoll{day: days[i+1], from: ctrs[cur].si.fKey,
+			to: ctrs[next].si.fKey, fromP: fromP, toP: toP})
+		cur = next
+	}
+	cs.built = true
+	return nil
+}
+
+// active ... contract of continuous series on trading day
+func (cs *contSeries) active(day julian.JulianDay) SymbolKey {
+	res := cs.first
+	for _, r := range cs.rolls {
+		if r.day > day {
+			break
+		}
+		res = r.to
+	}
+	return res
+}
+
+// getBuiltSeries ... continuous series with roll schedule built
+func getBuiltSeries(sym string) (*contSeries, error) {
+	contLock.Lock()
+	defer contLock.Unlock()
+	cs, err := getContSeries(sym)
+	if err != nil {
+		return nil, err
+	}
+	if !cs.built {
+		if err := cs.build(); err != nil {
+			return nil, err
+		}
+	}
+	return cs, nil
+}
+
+// ContActive ... active contract of continuous symbol on trading day
+func ContActive(sym string, day julian.JulianDay) (string, error) {
+	cs, err := getBuiltSeries(sym)
+	if err != nil {
+		return "", err
+	}
+	si, err := cs.active(day).SymbolInfo()
+	if err != nil {
+		return "", err
+	}
+	return si.Ticker, nil
+}
+
+// getContBars ... Bars of continuous symbol, bars of active contracts
+//		spliced by trading day, history adjusted by rule
+func getContBars(sym string, period Period, curTime DateTimeMs) (*Bars, error) {
+	cs, err := getBuiltSeries(sym)
+	if err != nil {
+		return nil, err
+	}
+	res := Bars{symKey: cs.fKey, period: period}
+	// segments of contracts, end 0 for last
+	type segment struct {
+		fKey       SymbolKey
+		start, end julian.JulianDay
+	}
+	// rolls up to trading day of curTime, no gap of future rolls
+	rolls := cs.rolls
+	day := timeT64FromInt64(barBaseTime(cs.fKey, curTime.Unix(), Daily)).DateTimeMs().JulianDay()
+	for i, r := range rolls {
+		if r.day > day {
+			rolls = rolls[:i]
+			break
+		}
+	}
+	segs := []segment{{fKey: cs.first}}
+	for _, r := range rolls {
+		segs[len(segs)-1].end = r.day
+		segs = append(segs, segment{fKey: r.to, start: r.day})
+	}
+	// count of bars before each roll
+	rollIdx := make([]int, len(rolls))
+	for i, sg := range segs {
+		if i > 0 {
+			rollIdx[i-1] = len(res.Date)
+		}
+		b, err := getBarsByKey(int(sg.fKey), period, curTime)
+		if err != nil {
+			continue
+		}
+		for j := range b.Date {
+			d := barDay(b, j)
+			if d < sg.start || (sg.end != 0 && d >= sg.end) {
+				continue
+			}
+			res.Date = append(res.Date, b.Date[j])
+			res.Open = append(res.Open, b.Open[j])
+			res.High = append(res.High, b.High[j])
+			res.Low = append(res.Low, b.Low[j])
+			res.Close = append(res.Close, b.Close[j])
+			res.Volume = append(res.Volume, b.Volume[j])
+		}
+	}
+	if cnt := len(res.Date); cnt > 0 {
+		res.startDt = res.Date[0]
+		res.endDt = timeT64FromInt64(barNextTime(cs.fKey, res.Date[cnt-1].Unix(), period))
+	}
+	if cs.rule.Adjust == ContAdjustNone {
+		return &res, nil
+	}
+	// adjust bars before roll, latest first
+	offset, ratio := 0.0, 1.0
+	for i := len(rolls) - 1; i >= 0; i-- {
+		r := rolls[i]
+		offset += r.toP - r.fromP
+		if r.fromP != 0 {
+			ratio *= r.toP / r.fromP
+		}
+		start := 0
+		if i > 0 {
+			start = rollIdx[i-1]
+		}
+		for j := start; j < rollIdx[i]; j++ {
+			if cs.rule.Adjust == ContAdjustRatio {
+				res.Open[j] *= ratio
+				res.High[j] *= ratio
+				res.Low[j] *= ratio
+				res.Close[j] *= ratio
+			} else {
+				res.Open[j] += offset
+				res.High[j] += offset
+				res.Low[j] += offset
+				res.Close[j] += offset
+			}
+		}
+	}
+	return &res, nil
+}
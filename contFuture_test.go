@@ -0,0 +1,144 @@
+package ats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kjx98/golib/julian"
+)
+
+func TestContFuture(t *testing.T) {
+	initSymbols()
+	days := []julian.JulianDay{}
+	for d := julian.NewJulianDay(2019, 12, 2); len(days) < 6; d = nextWorkDay(d) {
+		days = append(days, d)
+	}
+	ctrs := []struct {
+		sym   string
+		close []float64
+		vol   []float64
+		oi    []float64
+	}{
+		{"cu2001", []float64{100, 101, 102, 103, 104, 105}, []float64{50, 40, 30, 20, 10, 5},
+			[]float64{100, 100, 100, 100, 100, 100}},
+		{"cu2002", []float64{110, 111, 112, 113, 114, 115}, []float64{10, 30, 35, 40, 50, 60},
+			[]float64{50, 200, 200, 200, 200, 200}},
+	}
+	for _, ct := range ctrs {
+		newSymbolInfo(ct.sym)
+		si, err := GetSymbolInfo(ct.sym)
+		if err != nil {
+			t.Fatal("no symbol", ct.sym)
+		}
+		b := &Bars{symKey: si.fKey, period: Daily}
+		for i, d := range days {
+			b.Date = append(b.Date, timeT64FromTime(d.UTC()))
+			b.Open = append(b.Open, ct.close[i])
+			b.High = append(b.High, ct.close[i])
+			b.Low = append(b.Low, ct.close[i])
+			b.Close = append(b.Close, ct.close[i])
+			b.Volume = append(b.Volume, ct.vol[i])
+			AddOpenInterest(ct.sym, d, ct.oi[i])
+		}
+		b.startDt, b.endDt = b.Date[0], timeT64FromTime(days[5].Add(1).UTC())
+		setBaseBars(b)
+	}
+	curT := timeT64FromTime(time.Date(2020, 12, 31, 0, 0, 0, 0, time.UTC)).DateTimeMs()
+	tests := []struct {
+		sym   string
+		rule  ContRule
+		close []float64
+	}{
+		{"cu@vol", ContRule{Mode: RollByVolume}, []float64{110, 111, 112, 113, 114, 115}},
+		{"cu@main", defContRule, []float64{110, 111, 112, 113, 114, 115}},
+		{"cu@days", ContRule{Mode: RollByDays, Days: 40}, []float64{110, 111, 112, 113,
+			114, 115}},
+		{"cu@raw", ContRule{Mode: RollByVolume, Adjust: ContAdjustNone}, []float64{100,
+			101, 102, 113, 114, 115}},
+		{"cu@ratio", ContRule{Mode: RollByVolume, Adjust: ContAdjustRatio}, []float64{
+			round(100 * 112.0 / 102), round(101 * 112.0 / 102), 112, 113, 114, 115}},
+	}
+	rollDays := map[string]julian.JulianDay{"cu@vol": days[3], "cu@main": days[2],
+		"cu@days": days[5], "cu@raw": days[3], "cu@ratio": days[3]}
+	for _, tt := range tests {
+		t.Run(tt.sym, func(t *testing.T) {
+			if err := SetContRule(tt.sym, tt.rule); err != nil {
+				t.Error("SetContRule", err)
+				return
+			}
+			b, err := getBars(tt.sym, Daily, curT)
+			if err != nil {
+				t.Error("getBars", err)
+				return
+			}
+			var cl []float64
+			for _, v := range b.Close {
+				cl = append(cl, round(v))
+			}
+			if !reflect.DeepEqual(cl, tt.close) {
+				t.Errorf("getBars() close %v, want %v", cl, tt.close)
+			}
+			rd := rollDays[tt.sym]
+			if sym, _ := ContActive(tt.sym, rd.Add(-1)); sym != "cu2001" {
+				t.Error("before roll", sym)
+			}
+			if sym, _ := ContActive(tt.sym, rd); sym != "cu2002" {
+				t.Error("after roll", sym)
+			}
+		})
+	}
+	// two rolls, bars before second roll never adjusted by its gap
+	s1, _ := GetSymbolInfo("cu2001")
+	s2, _ := GetSymbolInfo("cu2002")
+	f1, f2 := s1.fKey, s2.fKey
+	contLock.Lock()
+	cs, _ := getContSeries("cu@two")
+	cs.first, cs.built = f1, true
+	cs.rolls = []contRoll{{day: days[2], from: f1, to: f2, fromP: 101, toP: 111},
+		{day: days[4], from: f2, to: f1, fromP: 113, toP: 103}}
+	contLock.Unlock()
+	midT := timeT64FromTime(days[3].UTC().Add(12 * time.Hour)).DateTimeMs()
+	if b, err := getContBars("cu@two", Daily, midT); err != nil {
+		t.Error("getContBars", err)
+	} else if cnt := len(b.Close); cnt == 0 || b.Close[cnt-1] != 112 ||
+		b.Close[0] != 110 {
+		t.Error("getContBars before second roll diff", b.Close)
+	}
+	if err := SetContRule("cu2001", defContRule); err != errNotContSymbol {
+		t.Error("SetContRule should fail for contract", err)
+	}
+	// roll long position
+	from, _ := GetSymbolInfo("cu2001")
+	to, _ := GetSymbolInfo("cu2002")
+	acct := account{pos: map[SymbolKey]*PositionType{}}
+	acct.updatePos(&from, OrderDirBuy, 100, 2)
+	acct.rollPos(&from, &to, 2, 102, 112)
+	if acct.pos[from.fKey].Positions != 0 || acct.pos[to.fKey].Positions != 2 ||
+		acct.pos[to.fKey].AvgPrice != 112 {
+		t.Error("rollPos position diff", *acct.pos[to.fKey])
+	}
+	if len(acct.deals) != 2 || acct.deals[0].Reason != "roll" ||
+		acct.deals[0].Profit != from.CalcProfit(100, 102, 2) || acct.deals[1].Oid != -1 {
+		t.Error("roll deals diff", acct.deals)
+	}
+	// order of continuous symbol on active contract, only its qty rolled
+	curSim := simCurrent
+	defer func() { simCurrent = curSim }()
+	simCurrent = midT
+	if sym, err := contOrderSymbol("cu@two"); err != nil || sym != "cu2002" {
+		t.Error("contOrderSymbol", sym, err)
+	}
+	tb, ta, release := newTestAccount(-7)
+	defer release()
+	ta.updatePos(&from, OrderDirBuy, 100, 1)
+	or := &simOrderType{simBroker: tb, cont: true, OrderType: OrderType{Dir: OrderDirBuy}}
+	simUpdateAcctPos(&from, or, int32(100*from.Multi()), 2)
+	simContRolls(days[2])
+	if ta.pos[f1].Positions != 1 || ta.pos[f2] == nil || ta.pos[f2].Positions != 2 {
+		t.Error("roll of continuous position diff", ta.pos[f1], ta.pos[f2])
+	}
+	if ta.contPos[f1] != 0 || ta.contPos[f2] != 2 {
+		t.Error("contPos after roll diff", ta.contPos)
+	}
+}
@@ -0,0 +1,197 @@
+package ats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"sort"
+	"sync"
+
+	"github.com/kjx98/golib/julian"
+)
+
+// CorpAction ... corporate action of A-share on ex-date, per share
+//	Cash		cash dividend
+//	Bonus		bonus and conversion shares
+//	Split		new shares of one share, 0 for no split
+//	Rights		rights shares offered, subscribed at RightsPrice
+type CorpAction struct {
+	Date        julian.JulianDay
+	Cash        float64
+	Bonus       float64
+	Split       float64
+	Rights      float64
+	RightsPrice float64
+}
+
+// corpActionRec ... record of corpActions.json, date as yyyymmdd
+type corpActionRec struct {
+	Date        uint32  `json:"date"`
+	Cash        float64 `json:"cash,omitempty"`
+	Bonus       float64 `json:"bonus,omitempty"`
+	Split       float64 `json:"split,omitempty"`
+	Rights      float64 `json:"rights,omitempty"`
+	RightsPrice float64 `json:"rightsPrice,omitempty"`
+}
+
+// shareFactor ... shares after ex-date of one share, rights excluded
+func (ca *CorpAction) shareFactor() float64 {
+	res := 1 + ca.Bonus
+	if ca.Split > 0 {
+		res *= ca.Split
+	}
+	return res
+}
+
+// exPrice ... reference price of ex-date from close before ex-date
+func (ca *CorpAction) exPrice(prevClose float64) float64 {
+	return (prevClose - ca.Cash + ca.RightsPrice*ca.Rights) /
+		(ca.shareFactor() + ca.Rights)
+}
+
+// AdjustType ... price adjustment of corporate actions
+type AdjustType int
+
+const (
+	// AdjustNone - raw prices
+	AdjustNone AdjustType = iota
+	// AdjustForward - latest prices kept, earlier prices adjusted
+	AdjustForward
+	// AdjustBackward - earliest prices kept, later prices adjusted
+	AdjustBackward
+)
+
+var corpActionOnce sync.Once
+var corpActionLock sync.RWMutex
+var corpActions = map[string][]CorpAction{}
+
+// loadCorpActions ... load corpActions.json, symbol to array of actions
+//		{"sh601318": [{"date": 20190523, "cash": 1.1}]}
+func loadCorpActions() {
+	corpActionOnce.Do(func() {
+		bb, err := ioutil.ReadFile("corpActions.json")
+		if err != nil {
+			return
+		}
+		var recMap map[string][]corpActionRec
+		if err := json.Unmarshal(bb, &recMap); err != nil {
+			log.Warning("Decode corpActions.json", err)
+			return
+		}
+		for sym, recs := range recMap {
+			for _, rec := range recs {
+				AddCorpAction(sym, CorpAction{Date: julian.FromUint32(rec.Date),
+					Cash: rec.Cash, Bonus: rec.Bonus, Split: rec.Split,
+					Rights: rec.Rights, RightsPrice: rec.RightsPrice})
+			}
+		}
+	})
+}
+
+// AddCorpAction ... add corporate action of symbol, replace same ex-date
+func AddCorpAction(sym string, ca CorpAction) {
+	corpActionLock.Lock()
+	defer corpActionLock.Unlock()
+	cas := corpActions[sym]
+	i := sort.Search(len(cas), func(i int) bool { return cas[i].Date >= ca.Date })
+	if i < len(cas) && cas[i].Date == ca.Date {
+		cas[i] = ca
+		return
+	}
+	cas = append(cas, CorpAction{})
+	copy(cas[i+1:], cas[i:])
+	cas[i] = ca
+	corpActions[sym] = cas
+}
+
+// GetCorpActions ... corporate actions of symbol, ascending ex-date
+func GetCorpActions(sym string) []CorpAction {
+	loadCorpActions()
+	corpActionLock.RLock()
+	defer corpActionLock.RUnlock()
+	return corpActions[sym]
+}
+
+// corpActionOn ... corporate action of symbol on ex-date day
+func corpActionOn(sym string, day julian.JulianDay) (CorpAction, bool) {
+	cas := GetCorpActions(sym)
+	i := sort.Search(len(cas), func(i int) bool { return cas[i].Date >= day })
+	if i < len(cas) && cas[i].Date == day {
+		return cas[i], true
+	}
+	return CorpAction{}, false
+}
+
+// Adjusted ... Bars with prices adjusted by corporate actions of symbol,
+//		volume adjusted by shares of bonus/split, Bars without actions
+//		returned as is
+func (b *Bars) Adjusted(adj AdjustType) (*Bars, error) {
+	si, err := b.symKey.SymbolInfo()
+	if err != nil {
+		return nil, err
+	}
+	cas := GetCorpActions(si.Ticker)
+	cnt := len(b.Date)
+	if adj == AdjustNone || len(cas) == 0 || cnt == 0 {
+		return b, nil
+	}
+	factor := make([]float64, cnt)
+	vFactor := make([]float64, cnt)
+	for i := range factor {
+		factor[i], vFactor[i] = 1, 1
+	}
+	applied := false
+	for _, ca := range cas {
+		i := sort.Search(cnt, func(i int) bool {
+			return b.Date[i].DateTimeMs().JulianDay() >= ca.Date
+		})
+		if i >= cnt {
+			break
+		}
+		if i == 0 {
+			// ex-date before or at first bar, no gap in Bars
+			continue
+		}
+		prevC := b.Close[i-1]
+		f, sf := ca.exPrice(prevC)/prevC, ca.shareFactor()
+		if adj == AdjustForward {
+			for j := 0; j < i; j++ {
+				factor[j] *= f
+				vFactor[j] *= sf
+			}
+		} else {
+			for j := i; j < cnt; j++ {
+				factor[j] /= f
+				vFactor[j] /= sf
+			}
+		}
+		applied = true
+	}
+	if !applied {
+		return b, nil
+	}
+	res := Bars{symKey: b.symKey, period: b.period, startDt: b.startDt,
+		endDt: b.endDt, Date: b.Date}
+	res.Open = make([]float64, cnt)
+	res.High = make([]float64, cnt)
+	res.Low = make([]float64, cnt)
+	res.Close = make([]float64, cnt)
+	res.Volume = make([]float64, cnt)
+	for i, f := range factor {
+		res.Open[i] = b.Open[i] * f
+		res.High[i] = b.High[i] * f
+		res.Low[i] = b.Low[i] * f
+		res.Close[i] = b.Close[i] * f
+		res.Volume[i] = math.Floor(b.Volume[i]*vFactor[i] + 0.5)
+	}
+	return &res, nil
+}
+
+// GetAdjustedBars ... Bars of symbol with prices adjusted by corporate actions
+func GetAdjustedBars(sym string, period Period, adj AdjustType, curTime DateTimeMs) (*Bars, error) {
+	b, err := getBars(sym, period, curTime)
+	if err != nil {
+		return nil, err
+	}
+	return b.Adjusted(adj)
+}
@@ -0,0 +1,72 @@
+package ats
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/kjx98/golib/julian"
+)
+
+func TestCorpActionAdjust(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil {
+		t.Skip("no sh601318", err)
+	}
+	exD := julian.NewJulianDay(2019, 5, 22)
+	// 10 shares bonus 5, cash 5
+	ca := CorpAction{Date: exD, Cash: 0.5, Bonus: 0.5}
+	if got := round(ca.exPrice(10)); got != round(9.5/1.5) {
+		t.Error("exPrice diff", got)
+	}
+	AddCorpAction("sh601318", ca)
+	b := &Bars{symKey: si.fKey, period: Daily}
+	for i, c := range []float64{10, 10, 6.5, 6.6} {
+		b.Date = append(b.Date, timeT64FromTime(exD.Add(i-2).UTC()))
+		b.Open = append(b.Open, c)
+		b.High = append(b.High, c)
+		b.Low = append(b.Low, c)
+		b.Close = append(b.Close, c)
+		b.Volume = append(b.Volume, 1500)
+	}
+	f := ca.exPrice(10) / 10
+	tests := []struct {
+		name  string
+		adj   AdjustType
+		close []float64
+		vol   []float64
+	}{
+		{"none", AdjustNone, []float64{10, 10, 6.5, 6.6}, []float64{1500, 1500, 1500, 1500}},
+		{"forward", AdjustForward, []float64{round(10 * f), round(10 * f), 6.5, 6.6},
+			[]float64{2250, 2250, 1500, 1500}},
+		{"backward", AdjustBackward, []float64{10, 10, round(6.5 / f), round(6.6 / f)},
+			[]float64{1500, 1500, 1000, 1000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := b.Adjusted(tt.adj)
+			if err != nil {
+				t.Error("Adjusted", err)
+				return
+			}
+			var cl []float64
+			for _, v := range res.Close {
+				cl = append(cl, round(v))
+			}
+			if !reflect.DeepEqual(cl, tt.close) || !reflect.DeepEqual(res.Volume, tt.vol) {
+				t.Errorf("Adjusted() = %v %v, want %v %v", cl, res.Volume, tt.close, tt.vol)
+			}
+		})
+	}
+	if _, ok := corpActionOn("sh601318", exD); !ok {
+		t.Error("corpActionOn should found")
+	}
+	// position of 1000 shares
+	acct := account{fund: 1e6, balance: 1e6, equity: 1e6}
+	pos := PositionType{fKey: si.fKey, Positions: 1000, AvgPrice: 10}
+	acct.applyCorpAction(&si, &pos, &ca)
+	if acct.fund != 1e6+500 || pos.Positions != 1500 || round(pos.AvgPrice) != round(10.0/1.5) {
+		t.Error("applyCorpAction diff", acct.fund, pos)
+	}
+}
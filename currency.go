@@ -0,0 +1,175 @@
+package ats
+
+import (
+	"errors"
+)
+
+var errNoCrossPair = errors.New("No cross pair convert to base currency")
+
+// Currency ... currency of P&L for symbol, CurrencySym of template or
+//		quote currency of Forex pair like JPY of USDJPY
+func (s *SymbolInfo) Currency() string {
+	if s.symbolBase == nil {
+		return ""
+	}
+	if s.CurrencySym != "" {
+		return s.CurrencySym
+	}
+	if s.IsForex && len(s.Ticker) >= 6 {
+		return s.Ticker[3:6]
+	}
+	return ""
+}
+
+// quotePrice ... mid of bid/ask, last or previous close of symbol by
+//		quotes published by broker
+func quotePrice(sym string) float64 {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return 0
+	}
+	// pair fed by simBroker, or quotes published by other broker
+	var q Quotes
+	if qq, ok := simSymbolsQ[si.fKey]; ok {
+		q = qq.Load()
+	} else {
+		q = si.GetQuotes()
+	}
+	switch {
+	case q.Bid > 0 && q.Ask > 0:
+		return (q.Bid + q.Ask) / 2
+	case q.Last > 0:
+		return q.Last
+	}
+	return q.Pclose
+}
+
+// crossRate ... exchange rate from currency to currency by current quotes
+//		of pair from+to or to+from, cross via USD for others
+func crossRate(from, to string) (float64, bool) {
+	if from == to {
+		return 1, true
+	}
+	if p := quotePrice(from + to); p > 0 {
+		return p, true
+	}
+	if p := quotePrice(to + from); p > 0 {
+		return 1 / p, true
+	}
+	if from == "USD" || to == "USD" {
+		return 0, false
+	}
+	r1, ok := crossRate(from, "USD")
+	if !ok {
+		return 0, false
+	}
+	r2, ok := crossRate("USD", to)
+	if !ok {
+		return 0, false
+	}
+	return r1 * r2, true
+}
+
+// convertCurrency ... convert amount from currency to currency, false for
+//		no quotes of cross pairs
+func convertCurrency(amt float64, from, to string) (float64, bool) {
+	if amt == 0 || from == "" || to == "" || from == to {
+		return amt, true
+	}
+	rate, ok := crossRate(from, to)
+	if !ok {
+		return amt, false
+	}
+	return amt * rate, true
+}
+
+// simSubscribePair ... subscribe quotes of loaded pair, false for pair
+//		without sim data
+func simSubscribePair(sym string) bool {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return false
+	}
+	if _, ok := simSymbolsQ[si.fKey]; ok {
+		return true
+	}
+	if _, ok := simTickMap[si.fKey]; !ok {
+		return false
+	}
+	simSymbolsQ[si.fKey] = &QuoteSnap{}
+	return true
+}
+
+// simSubscribePath ... subscribe pairs convert currency from to currency
+//		to, same path of crossRate
+func simSubscribePath(from, to string) bool {
+	if from == to || simSubscribePair(from+to) || simSubscribePair(to+from) {
+		return true
+	}
+	if from == "USD" || to == "USD" {
+		return false
+	}
+	return simSubscribePath(from, "USD") && simSubscribePath("USD", to)
+}
+
+// simCheckCurrency ... subscribe cross pairs for P&L of subscribed symbols
+//		to simCurrency, fail for no pairs loaded, caller hold simVmLock
+func simCheckCurrency() error {
+	if simCurrency == "" {
+		return nil
+	}
+	var curs []string
+	for fKey := range simSymbolsQ {
+		if si, err := fKey.SymbolInfo(); err == nil {
+			curs = append(curs, si.Currency())
+		}
+	}
+	for _, cur := range curs {
+		if cur != "" && !simSubscribePath(cur, simCurrency) {
+			log.Errorf("no cross pairs loaded convert %s to %s", cur, simCurrency)
+			return errNoCrossPair
+		}
+	}
+	return nil
+}
+
+// toBase ... P&L of symbol to base currency of account, unconverted
+//		while no quotes of cross pairs yet
+func (acct *account) toBase(si *SymbolInfo, amt float64) float64 {
+	base := acct.baseCurrency()
+	res, ok := convertCurrency(amt, si.Currency(), base)
+	if !ok {
+		log.Warningf("no quotes convert %s to %s", si.Currency(), base)
+	}
+	return res
+}
+
+// baseCurrency ... base currency of account
+func (acct *account) baseCurrency() string {
+	if acct.currency != "" {
+		return acct.currency
+	}
+	return simCurrency
+}
+
+// unrealized ... unrealized P&L of positions in base currency at quotes
+func (acct *account) unrealized() (res float64) {
+	acctLock.RLock()
+	defer acctLock.RUnlock()
+	for fKey, pos := range acct.pos {
+		si, err := fKey.SymbolInfo()
+		if err != nil {
+			continue
+		}
+		p := quotePrice(si.Ticker)
+		if p <= 0 {
+			continue
+		}
+		for _, leg := range pos.legs() {
+			amt, _ := convertCurrency(si.CalcProfit(leg.avgPrice, p, leg.qty),
+				si.Currency(), simCurrency)
+			res += amt
+		}
+	}
+	return
+}
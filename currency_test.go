@@ -0,0 +1,114 @@
+package ats
+
+import "testing"
+
+func Test_convertCurrency(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("USDCAD")
+	newSymbolInfo("NZDUSD")
+	cad, err := GetSymbolInfo("USDCAD")
+	if err != nil {
+		t.Skip("no USDCAD", err)
+	}
+	nzd, _ := GetSymbolInfo("NZDUSD")
+	oldCad, oldNzd := simSymbolsQ[cad.fKey], simSymbolsQ[nzd.fKey]
+	simSymbolsQ[cad.fKey] = &QuoteSnap{}
+	simSymbolsQ[cad.fKey].Store(Quotes{Bid: 1.2499, Ask: 1.2501})
+	simSymbolsQ[nzd.fKey] = &QuoteSnap{}
+	simSymbolsQ[nzd.fKey].Store(Quotes{Last: 0.64})
+	defer func() {
+		simSymbolsQ[cad.fKey], simSymbolsQ[nzd.fKey] = oldCad, oldNzd
+	}()
+	tests := []struct {
+		name   string
+		amt    float64
+		from   string
+		to     string
+		want   float64
+		wantOk bool
+	}{
+		{"same", 100, "USD", "USD", 100, true},
+		{"no base", 100, "CAD", "", 100, true},
+		{"USD to CAD", 100, "USD", "CAD", 125, true},
+		{"CAD to USD", 125, "CAD", "USD", 100, true},
+		{"NZD to USD", 100, "NZD", "USD", 64, true},
+		{"NZD to CAD cross", 100, "NZD", "CAD", 80, true},
+		{"no quotes", 100, "CHF", "USD", 100, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := convertCurrency(tt.amt, tt.from, tt.to)
+			if round(got) != tt.want || ok != tt.wantOk {
+				t.Errorf("convertCurrency() = %v %v, want %v %v", got, ok,
+					tt.want, tt.wantOk)
+			}
+		})
+	}
+	if c := cad.Currency(); c != "CAD" {
+		t.Error("Currency of USDCAD", c)
+	}
+	// realized and unrealized P&L in USD
+	simCurrency = "USD"
+	defer func() { simCurrency = "" }()
+	acct := &account{pos: map[SymbolKey]*PositionType{}}
+	acct.updatePos(&cad, OrderDirBuy, 1.24, 100)
+	if u := round(acct.unrealized()); u != round(cad.CalcProfit(1.24, 1.25, 100)/1.25) {
+		t.Error("unrealized diff", u)
+	}
+	profit := acct.updatePos(&cad, OrderDirClose, 1.25, 100)
+	if round(profit) != round(cad.CalcProfit(1.24, 1.25, 100)/1.25) {
+		t.Error("realized diff", profit)
+	}
+	// borrow fee and cash dividend in USD
+	acct.borrowFee(&cad, 100, 1.25, 0.01)
+	if fee := acct.deals[len(acct.deals)-1].Profit; round(fee) !=
+		round(-cad.CalcProfit(0, 1.25, 100)*0.01/1.25) {
+		t.Error("borrow fee diff", fee)
+	}
+	fund := acct.fund
+	acct.applyCorpAction(&cad, &PositionType{Positions: 100}, &CorpAction{Cash: 0.5})
+	if cash := acct.fund - fund; round(cash) != round(cad.CalcProfit(0, 0.5, 100)/1.25) {
+		t.Error("dividend diff", cash)
+	}
+}
+
+func Test_simCheckCurrency(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("USDJPY")
+	newSymbolInfo("EURUSD")
+	jpy, err := GetSymbolInfo("USDJPY")
+	if err != nil {
+		t.Skip("no USDJPY", err)
+	}
+	eur, _ := GetSymbolInfo("EURUSD")
+	oldQ, oldTick := simSymbolsQ[eur.fKey], simTickMap[eur.fKey]
+	oldJpy := simSymbolsQ[jpy.fKey]
+	simSymbolsQ[jpy.fKey] = &QuoteSnap{}
+	delete(simSymbolsQ, eur.fKey)
+	delete(simTickMap, eur.fKey)
+	simCurrency = "EUR"
+	defer func() {
+		simCurrency = ""
+		simSymbolsQ[jpy.fKey] = oldJpy
+		if oldJpy == nil {
+			delete(simSymbolsQ, jpy.fKey)
+		}
+		simSymbolsQ[eur.fKey], simTickMap[eur.fKey] = oldQ, oldTick
+		if oldQ == nil {
+			delete(simSymbolsQ, eur.fKey)
+		}
+		if oldTick == nil {
+			delete(simTickMap, eur.fKey)
+		}
+	}()
+	// JPY to EUR via USD, EURUSD not loaded
+	if err := simCheckCurrency(); err != errNoCrossPair {
+		t.Error("simCheckCurrency without EURUSD", err)
+	}
+	simTickMap[eur.fKey] = &simTickFX{}
+	if err := simCheckCurrency(); err != nil {
+		t.Error("simCheckCurrency", err)
+	} else if _, ok := simSymbolsQ[eur.fKey]; !ok {
+		t.Error("EURUSD not subscribed")
+	}
+}
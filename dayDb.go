@@ -100,8 +100,9 @@ func OpenDB() (*sql.DB, error) {
 				panic(err)
 			}
 			var sym = Symbol{Ticker: tick, Name: name,
-				StartDate: julian.FromString(start),
-				EndDate:   julian.FromString(end), Exchange: exch}
+				StartDate:     julian.FromString(start),
+				EndDate:       julian.FromString(end),
+				AutoCloseDate: julian.FromString(autoc), Exchange: exch}
 			symbolsMap[tick] = &sym
 		}
 	} else {
@@ -112,24 +113,22 @@ func OpenDB() (*sql.DB, error) {
 	return myDB, nil
 }
 
-var cacheDayHits int
-var cacheDayMiss int
-
 // DayDbCacheStatus ... dump mysql Dayta cache status
 func DayDbCacheStatus() string {
-	return fmt.Sprintf("DayTACache Status: Hits %d, Miss: %d", cacheDayHits, cacheDayMiss)
+	return fmt.Sprintf("DayTACache Status: %s", getCacheStats(cacheKindDayTA))
 }
 
 // GetChart ... get []DayTA from mysql or cache
 func GetChart(sym string, startD, endD julian.JulianDay) (res []DayTA) {
+	cid := cacheID{kind: cacheKindDayTA, name: sym}
 	if cc, ok := cacheDayTA[sym]; ok {
 		if startD >= cc.startD && endD == cc.endD {
 			res = cc.res
-			cacheDayHits++
+			cacheHit(cid)
 			return
 		}
 	}
-	cacheDayMiss++
+	cacheMiss(cacheKindDayTA)
 
 	si, err := GetSymbolInfo(sym)
 	if err != nil {
@@ -177,6 +176,7 @@ func GetChart(sym string, startD, endD julian.JulianDay) (res []DayTA) {
 	var cc = cacheDayTAType{startD: startD, endD: endD}
 	cc.res = res
 	cacheDayTA[sym] = cc
+	cacheAdd(cid, dayTASize(res))
 	return
 }
 
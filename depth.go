@@ -0,0 +1,157 @@
+package ats
+
+import "sync/atomic"
+
+// DepthLevel ... price level of depth book
+type DepthLevel struct {
+	Price  float64
+	Volume int64
+}
+
+// DepthBook ... Level2 depth, N levels of bids/asks, level 0 for top of book
+//	volume with same unit as order quantity
+type DepthBook struct {
+	UpdateTime DateTimeMs
+	Bids       []DepthLevel
+	Asks       []DepthLevel
+}
+
+// DefDepthLevels ... default levels of DepthBook
+const DefDepthLevels = 5
+
+// DepthSnap ... Level2 depth snapshot
+//	broker publish new DepthBook via atomic pointer swap, published
+//	DepthBook never modified, reader could hold it without lock
+type DepthSnap struct {
+	levels int
+	val    atomic.Value
+}
+
+// NewDepthSnap ... create DepthSnap with n levels
+func NewDepthSnap(n int) *DepthSnap {
+	if n <= 0 {
+		n = DefDepthLevels
+	}
+	return &DepthSnap{levels: n}
+}
+
+// Levels ... max levels of depth snapshot
+func (d *DepthSnap) Levels() int {
+	return d.levels
+}
+
+// Load ... current depth book, nil before first update
+//	returned DepthBook shared by readers, must not be modified
+func (d *DepthSnap) Load() *DepthBook {
+	if p, ok := d.val.Load().(*DepthBook); ok {
+		return p
+	}
+	return nil
+}
+
+// Store ... publish db as new snapshot, db must not be modified after
+func (d *DepthSnap) Store(db *DepthBook) {
+	d.val.Store(db)
+}
+
+// storeTickExt ... publish new depth book built from TickExt
+func (d *DepthSnap) storeTickExt(si *SymbolInfo, tick *TickExt, curT DateTimeMs) {
+	db := NewDepthBook(d.levels)
+	db.fillTickExt(si, tick, curT)
+	d.Store(db)
+}
+
+// depthLevel ... integer price level used by simMatchOrder
+type depthLevel struct {
+	price int32
+	vol   int64
+}
+
+// depthTicker ... simTicker with Level2 depth, nil for no depth
+type depthTicker interface {
+	TickDepth() *TickExt
+}
+
+// NewDepthBook ... create DepthBook with n levels
+func NewDepthBook(n int) *DepthBook {
+	if n <= 0 {
+		n = DefDepthLevels
+	}
+	return &DepthBook{Bids: make([]DepthLevel, 0, n), Asks: make([]DepthLevel, 0, n)}
+}
+
+// Levels ... max levels of depth book
+func (d *DepthBook) Levels() int {
+	return cap(d.Bids)
+}
+
+// tickExtLevels ... split TickExt depth to n levels
+//	level 0 for top price and volume, volume of depth remain
+//	(BidsVol-BidVol) spread evenly over level 1..n-1 till deep price
+func tickExtLevels(top, deep int32, topVol, totVol uint32, n int) (res []depthLevel) {
+	if top == 0 {
+		return
+	}
+	if topVol > 0 {
+		res = append(res, depthLevel{top, int64(topVol)})
+	}
+	if n <= 1 || totVol <= topVol || top == deep {
+		return
+	}
+	span := deep - top
+	steps := int32(n - 1)
+	if span < 0 && -span < steps {
+		steps = -span
+	} else if span > 0 && span < steps {
+		steps = span
+	}
+	remain := int64(totVol - topVol)
+	per := remain / int64(steps)
+	for i := int32(1); i <= steps; i++ {
+		v := per
+		if i == steps {
+			v = remain - per*int64(steps-1)
+		}
+		if v > 0 {
+			res = append(res, depthLevel{top + span*i/steps, v})
+		}
+	}
+	return
+}
+
+// fillTickExt ... rebuild depth book from TickExt
+func (d *DepthBook) fillTickExt(si *SymbolInfo, tick *TickExt, curT DateTimeMs) {
+	n := d.Levels()
+	if n == 0 {
+		n = DefDepthLevels
+	}
+	fill := func(dst []DepthLevel, lv []depthLevel) []DepthLevel {
+		dst = dst[:0]
+		for _, l := range lv {
+			dst = append(dst, DepthLevel{Price: float64(l.price) * si.Divi(),
+				Volume: l.vol})
+		}
+		return dst
+	}
+	d.UpdateTime = curT
+	d.Bids = fill(d.Bids, tickExtLevels(tick.Bid, tick.BidDepth, tick.BidVol,
+		tick.BidsVol, n))
+	d.Asks = fill(d.Asks, tickExtLevels(tick.Ask, tick.AskDepth, tick.AskVol,
+		tick.AsksVol, n))
+}
+
+// depthTickExt ... build TickExt depth fields from DepthBook
+func (d *DepthBook) depthTickExt(si *SymbolInfo, tick *TickExt) {
+	if len(d.Bids) > 0 {
+		tick.BidDepth = int32(d.Bids[len(d.Bids)-1].Price*si.Multi() + 0.5)
+		for _, l := range d.Bids {
+			tick.BidsVol += uint32(l.Volume)
+		}
+	}
+	if len(d.Asks) > 0 {
+		tick.AskDepth = int32(d.Asks[len(d.Asks)-1].Price*si.Multi() + 0.5)
+		for _, l := range d.Asks {
+			tick.AsksVol += uint32(l.Volume)
+		}
+	}
+}
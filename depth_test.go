@@ -0,0 +1,156 @@
+package ats
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func Test_tickExtLevels(t *testing.T) {
+	type args struct {
+		top, deep      int32
+		topVol, totVol uint32
+		n              int
+	}
+	tests := []struct {
+		name string
+		args args
+		want []depthLevel
+	}{
+		{"noPrice", args{0, 0, 0, 0, 5}, nil},
+		{"topOnly", args{16500, 16500, 3, 3, 5}, []depthLevel{{16500, 3}}},
+		{"ask5", args{16500, 16504, 3, 11, 5}, []depthLevel{{16500, 3},
+			{16501, 2}, {16502, 2}, {16503, 2}, {16504, 2}}},
+		{"bid3", args{16500, 16490, 3, 10, 3}, []depthLevel{{16500, 3},
+			{16495, 3}, {16490, 4}}},
+		{"narrow", args{16500, 16502, 1, 7, 5}, []depthLevel{{16500, 1},
+			{16501, 3}, {16502, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tickExtLevels(tt.args.top, tt.args.deep, tt.args.topVol,
+				tt.args.totVol, tt.args.n)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tickExtLevels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDepthBook(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("XAGUSD")
+	s, err := GetSymbolInfo("XAGUSD")
+	if err != nil {
+		t.Fatal("GetSymbolInfo", err)
+	}
+	si, _ := s.fKey.SymbolInfo()
+	tick := TickExt{Bid: 16490, Ask: 16500, BidVol: 2, AskVol: 3, BidDepth: 16486,
+		AskDepth: 16504, BidsVol: 10, AsksVol: 11}
+	d := NewDepthBook(3)
+	d.fillTickExt(si, &tick, 1000)
+	if len(d.Bids) != 3 || len(d.Asks) != 3 || d.Asks[0].Price != 16.5 ||
+		round(d.Bids[2].Price) != 16.486 || d.Bids[1].Volume != 4 {
+		t.Error("fillTickExt diff", d)
+	}
+	var res TickExt
+	d.depthTickExt(si, &res)
+	if res.BidDepth != tick.BidDepth || res.AskDepth != tick.AskDepth ||
+		res.BidsVol != tick.BidsVol || res.AsksVol != tick.AsksVol {
+		t.Error("depthTickExt diff", res)
+	}
+}
+
+func TestDepthSnap(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("XAGUSD")
+	s, err := GetSymbolInfo("XAGUSD")
+	if err != nil {
+		t.Fatal("GetSymbolInfo", err)
+	}
+	si, _ := s.fKey.SymbolInfo()
+	d := NewDepthSnap(3)
+	if d.Load() != nil || d.Levels() != 3 {
+		t.Error("empty DepthSnap diff", d.Load(), d.Levels())
+	}
+	tick := TickExt{Bid: 16490, Ask: 16500, BidVol: 2, AskVol: 3, BidDepth: 16486,
+		AskDepth: 16504, BidsVol: 10, AsksVol: 11}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 1000; i++ {
+			db := d.Load()
+			if db == nil {
+				continue
+			}
+			var vol int64
+			for _, l := range db.Bids {
+				vol += l.Volume
+			}
+			if vol != int64(db.UpdateTime) {
+				t.Error("inconsistent depth", db)
+				return
+			}
+		}
+	}()
+	for i := 1; i <= 1000; i++ {
+		tick.BidsVol = uint32(i + 2)
+		d.storeTickExt(si, &tick, DateTimeMs(i+2))
+	}
+	wg.Wait()
+	old := d.Load()
+	tick.BidsVol = 10
+	d.storeTickExt(si, &tick, 1000)
+	if old.UpdateTime != 1002 || len(old.Bids) != 3 || old.Bids[2].Volume == 4 {
+		t.Error("published DepthBook modified", old)
+	}
+	if db := d.Load(); db.UpdateTime != 1000 || db.Bids[1].Volume != 4 {
+		t.Error("new DepthBook diff", db)
+	}
+}
+
+func TestSimMatchDepth(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("XAGUSD")
+	s, err := GetSymbolInfo("XAGUSD")
+	if err != nil {
+		t.Fatal("GetSymbolInfo", err)
+	}
+	si, _ := s.fKey.SymbolInfo()
+	br, err := simTrader.Open(nil)
+	if err != nil {
+		t.Fatal("simBroker Open", err)
+	}
+	tick := &replayTick{multi: si.Multi(), recs: []quoteRecord{{
+		Quotes: Quotes{Bid: 16.49, Ask: 16.5, BidVol: 2, AskVol: 3},
+		Bids:   []DepthLevel{{16.49, 2}, {16.486, 8}},
+		Asks:   []DepthLevel{{16.5, 3}, {16.504, 8}}}}}
+	match := func() {
+		simVmLock.Lock()
+		simMatchOrder(si, tick)
+		simVmLock.Unlock()
+	}
+	// limit order walk 3 levels, partial filled
+	oid := br.SendOrder("XAGUSD", OrderDirBuy, 10, 16.502, 0)
+	match()
+	if or := br.GetOrder(oid); or.Status != OrderPartFilled || or.QtyFilled != 7 ||
+		round(or.AvgPrice) != round((3*16.5+2*16.501+2*16.502)/7) {
+		t.Error("partial fill diff", or)
+	}
+	match()
+	if or := br.GetOrder(oid); or.Status != OrderFilled || or.QtyFilled != 10 ||
+		round(or.AvgPrice) != round((6*16.5+2*16.501+2*16.502)/10) {
+		t.Error("fill diff", or)
+	}
+	// market order walk all levels
+	oid = br.SendOrder("XAGUSD", OrderDirClose, 12, 0, 0)
+	match()
+	if or := br.GetOrder(oid); or.Status != OrderPartFilled || or.QtyFilled != 10 {
+		t.Error("market close diff", or)
+	}
+	br.CancelOrder(oid)
+	if pos := br.GetPosition("XAGUSD"); pos.Positions != 0 {
+		t.Error("position diff", pos)
+	}
+}
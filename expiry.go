@@ -0,0 +1,113 @@
+package ats
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/kjx98/golib/julian"
+)
+
+// last trading day rules of futures template, "lastTrade" of symbols.json
+//	"15"	15th of delivery month, next trading day if not trading (SHFE)
+//	"3Fri"	3rd Friday of delivery month (CME equity index)
+//	"-1"	last trading day of delivery month, "-3" the 3rd last
+//	""		default, same as "15"
+//	AutoCloseDate of Symbol in dayDb overrides rule
+
+var errLastTradeRule = errors.New("Invalid lastTrade rule")
+var errContractExpired = errors.New("Contract expired")
+var errNoOpenNearExpiry = errors.New("No open near expiry")
+
+var weekdayAbbr = map[string]time.Weekday{
+	"Sun": time.Sunday, "Mon": time.Monday, "Tue": time.Tuesday,
+	"Wed": time.Wednesday, "Thu": time.Thursday, "Fri": time.Friday,
+	"Sat": time.Saturday,
+}
+
+// lastTradeOf ... last trading day of rule for delivery year/month,
+//		trading days by calendar of market
+func lastTradeOf(market, rule string, year, month int) (julian.JulianDay, error) {
+	if rule == "" {
+		rule = "15"
+	}
+	first := julian.NewJulianDay(year, month, 1)
+	if len(rule) > 3 {
+		// nth weekday of month, such as "3Fri"
+		wd, ok := weekdayAbbr[rule[len(rule)-3:]]
+		n, err := strconv.Atoi(rule[:len(rule)-3])
+		if !ok || err != nil || n < 1 || n > 5 {
+			return 0, errLastTradeRule
+		}
+		jd := first.Add((int(wd) - int(first.Weekday()) + 7) % 7)
+		jd = jd.Add(7 * (n - 1))
+		if _, m, _ := jd.Date(); m != month {
+			return 0, errLastTradeRule
+		}
+		return jd, nil
+	}
+	n, err := strconv.Atoi(rule)
+	if err != nil || n == 0 || n > 31 || n < -20 {
+		return 0, errLastTradeRule
+	}
+	if n > 0 {
+		jd := first.Add(n - 1)
+		if !IsTradingDay(market, jd) {
+			jd = NextTradingDay(market, jd)
+		}
+		return jd, nil
+	}
+	// nth last trading day of month
+	var jd julian.JulianDay
+	if month == 12 {
+		jd = julian.NewJulianDay(year+1, 1, 1)
+	} else {
+		jd = julian.NewJulianDay(year, month+1, 1)
+	}
+	for ; n < 0; n++ {
+		jd = PrevTradingDay(market, jd)
+	}
+	return jd, nil
+}
+
+// LastTradeDay ... last trading day of futures contract, ref to resolve
+//		year of one digit tickers, 0 for non futures
+func (si *SymbolInfo) LastTradeDay(ref julian.JulianDay) julian.JulianDay {
+	if si.deliverMonth == 0 || si.symbolBase == nil || isContSymbol(si.Ticker) {
+		return 0
+	}
+	if sym, ok := symbolsMap[si.Ticker]; ok && sym.AutoCloseDate != 0 {
+		return sym.AutoCloseDate
+	}
+	y, m := deliverDate(si, ref)
+	jd, err := lastTradeOf(si.Market, si.LastTrade, y, m)
+	if err != nil {
+		log.Warning(si.Ticker, err)
+		return 0
+	}
+	return jd
+}
+
+// checkExpiry ... verify order of contract on day, opens refused in last
+//		ExpiryNoOpen trading days till last trading day, all orders refused
+//		after last trading day
+func (si *SymbolInfo) checkExpiry(dir OrderDirT, day julian.JulianDay) error {
+	lt := si.LastTradeDay(day)
+	if lt == 0 {
+		return nil
+	}
+	if day > lt {
+		return errContractExpired
+	}
+	if dir.IsOffset() {
+		return nil
+	}
+	noOpen := lt
+	for i := 1; i < si.ExpiryNoOpen; i++ {
+		noOpen = PrevTradingDay(si.Market, noOpen)
+	}
+	if si.ExpiryNoOpen > 0 && day >= noOpen {
+		return errNoOpenNearExpiry
+	}
+	return nil
+}
@@ -0,0 +1,90 @@
+package ats
+
+import (
+	"testing"
+
+	"github.com/kjx98/golib/julian"
+)
+
+func Test_lastTradeOf(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    string
+		year    int
+		month   int
+		want    julian.JulianDay
+		wantErr bool
+	}{
+		{"default", "", 2019, 5, julian.NewJulianDay(2019, 5, 15), false},
+		{"15th", "15", 2019, 5, julian.NewJulianDay(2019, 5, 15), false},
+		{"15th weekend", "15", 2019, 6, julian.NewJulianDay(2019, 6, 17), false},
+		{"3rd Friday", "3Fri", 2019, 12, julian.NewJulianDay(2019, 12, 20), false},
+		{"last workday", "-1", 2019, 11, julian.NewJulianDay(2019, 11, 29), false},
+		{"3rd last workday", "-3", 2019, 11, julian.NewJulianDay(2019, 11, 27), false},
+		{"last workday Dec", "-1", 2019, 12, julian.NewJulianDay(2019, 12, 31), false},
+		{"5th Friday", "5Fri", 2019, 12, 0, true},
+		{"invalid", "xFri", 2019, 12, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := lastTradeOf("", tt.rule, tt.year, tt.month)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("lastTradeOf() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("lastTradeOf() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbolInfo_checkExpiry(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("cu1906")
+	newSymbolInfo("ESZ9")
+	cu, err := GetSymbolInfo("cu1906")
+	if err != nil {
+		t.Skip("no cu1906", err)
+	}
+	es, err := GetSymbolInfo("ESZ9")
+	if err != nil {
+		t.Skip("no ESZ9", err)
+	}
+	if lt := es.LastTradeDay(julian.NewJulianDay(2019, 6, 1)); lt != julian.NewJulianDay(2019, 12, 20) {
+		t.Error("ESZ9 LastTradeDay diff", lt)
+	}
+	tests := []struct {
+		name string
+		si   *SymbolInfo
+		dir  OrderDirT
+		day  julian.JulianDay
+		want error
+	}{
+		{"open", &cu, OrderDirBuy, julian.NewJulianDay(2019, 6, 11), nil},
+		{"open near expiry", &cu, OrderDirSell, julian.NewJulianDay(2019, 6, 13), errNoOpenNearExpiry},
+		{"close near expiry", &cu, OrderDirClose, julian.NewJulianDay(2019, 6, 17), nil},
+		{"expired", &cu, OrderDirCover, julian.NewJulianDay(2019, 6, 18), errContractExpired},
+		{"ES open", &es, OrderDirBuy, julian.NewJulianDay(2019, 12, 18), nil},
+		{"ES open near expiry", &es, OrderDirBuy, julian.NewJulianDay(2019, 12, 19), errNoOpenNearExpiry},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.si.checkExpiry(tt.dir, tt.day); got != tt.want {
+				t.Errorf("checkExpiry() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// short position closed at settlement
+	acct := account{pos: map[SymbolKey]*PositionType{}}
+	acct.updatePos(&cu, OrderDirSell, 46000, 2)
+	acct.expiryClose(&cu, -2, 45500)
+	if acct.pos[cu.fKey].Positions != 0 {
+		t.Error("expiryClose position diff", *acct.pos[cu.fKey])
+	}
+	if len(acct.deals) != 1 || acct.deals[0].Reason != "expiry" ||
+		acct.deals[0].Dir != OrderDirCover || acct.deals[0].Oid != -1 ||
+		acct.deals[0].Profit != cu.CalcProfit(46000, 45500, -2) {
+		t.Error("expiry deals diff", acct.deals)
+	}
+}
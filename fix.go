@@ -0,0 +1,487 @@
+package ats
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FIX 4.4 tags used by fixBroker and FixAcceptor
+const (
+	fixTagAvgPx         = 6
+	fixTagBeginSeqNo    = 7
+	fixTagBeginString   = 8
+	fixTagBodyLength    = 9
+	fixTagCheckSum      = 10
+	fixTagClOrdID       = 11
+	fixTagCumQty        = 14
+	fixTagEndSeqNo      = 16
+	fixTagExecID        = 17
+	fixTagHandlInst     = 21
+	fixTagLastPx        = 31
+	fixTagLastQty       = 32
+	fixTagMsgSeqNum     = 34
+	fixTagMsgType       = 35
+	fixTagNewSeqNo      = 36
+	fixTagOrderID       = 37
+	fixTagOrderQty      = 38
+	fixTagOrdStatus     = 39
+	fixTagOrdType       = 40
+	fixTagOrigClOrdID   = 41
+	fixTagPossDupFlag   = 43
+	fixTagPrice         = 44
+	fixTagRefSeqNum     = 45
+	fixTagSenderCompID  = 49
+	fixTagSendingTime   = 52
+	fixTagSide          = 54
+	fixTagSymbol        = 55
+	fixTagTargetCompID  = 56
+	fixTagText          = 58
+	fixTagTransactTime  = 60
+	fixTagOpenClose     = 77
+	fixTagEncryptMethod = 98
+	fixTagHeartBtInt    = 108
+	fixTagTestReqID     = 112
+	fixTagOrigSendTime  = 122
+	fixTagGapFillFlag   = 123
+	fixTagResetSeqNum   = 141
+	fixTagExecType      = 150
+	fixTagLeavesQty     = 151
+	fixTagMDReqID       = 262
+	fixTagSubReqType    = 263
+	fixTagMarketDepth   = 264
+	fixTagNoMDEntryType = 267
+	fixTagNoMDEntries   = 268
+	fixTagMDEntryType   = 269
+	fixTagMDEntryPx     = 270
+	fixTagMDEntrySize   = 271
+	fixTagNoRelatedSym  = 146
+)
+
+// FIX 4.4 message types
+const (
+	fixMsgHeartbeat     = "0"
+	fixMsgTestRequest   = "1"
+	fixMsgResendRequest = "2"
+	fixMsgReject        = "3"
+	fixMsgSequenceReset = "4"
+	fixMsgLogout        = "5"
+	fixMsgExecReport    = "8"
+	fixMsgCancelReject  = "9"
+	fixMsgLogon         = "A"
+	fixMsgNewOrder      = "D"
+	fixMsgCancelRequest = "F"
+	fixMsgCancelReplace = "G"
+	fixMsgMDRequest     = "V"
+	fixMsgMDSnapshot    = "W"
+)
+
+const fixBeginString = "FIX.4.4"
+const fixSOH = '\x01'
+const fixTimeFormat = "20060102-15:04:05.000"
+
+var (
+	errFixFormat   = errors.New("FIX message format error")
+	errFixCheckSum = errors.New("FIX message checksum error")
+	errFixSeqLow   = errors.New("FIX MsgSeqNum too low")
+	errFixLogout   = errors.New("FIX session logout")
+	errFixNoLogon  = errors.New("FIX session not logon")
+)
+
+type fixField struct {
+	tag int
+	val string
+}
+
+// fixMessage ... ordered fields exclude BeginString/BodyLength/CheckSum
+type fixMessage []fixField
+
+func newFixMessage(msgType string) fixMessage {
+	return fixMessage{{fixTagMsgType, msgType}}
+}
+
+// Get ... return value of first tag, "" for not exist
+func (m fixMessage) Get(tag int) string {
+	for _, f := range m {
+		if f.tag == tag {
+			return f.val
+		}
+	}
+	return ""
+}
+
+// GetInt ... return int value of tag, 0 for not exist
+func (m fixMessage) GetInt(tag int) int {
+	res, _ := strconv.Atoi(m.Get(tag))
+	return res
+}
+
+// GetFloat ... return float value of tag, 0 for not exist
+func (m fixMessage) GetFloat(tag int) float64 {
+	res, _ := strconv.ParseFloat(m.Get(tag), 64)
+	return res
+}
+
+// Set ... replace value of tag, append if not exist
+func (m *fixMessage) Set(tag int, val string) {
+	for i := range *m {
+		if (*m)[i].tag == tag {
+			(*m)[i].val = val
+			return
+		}
+	}
+	*m = append(*m, fixField{tag, val})
+}
+
+// Add ... append tag, used for repeating groups
+func (m *fixMessage) Add(tag int, val string) {
+	*m = append(*m, fixField{tag, val})
+}
+
+func (m fixMessage) MsgType() string {
+	return m.Get(fixTagMsgType)
+}
+
+func (m fixMessage) String() string {
+	return strings.Replace(string(m.encode()), string(fixSOH), "|", -1)
+}
+
+func fixCheckSum(buf []byte) int {
+	sum := 0
+	for _, c := range buf {
+		sum += int(c)
+	}
+	return sum % 256
+}
+
+// encode ... build wire format with BodyLength and CheckSum
+func (m fixMessage) encode() []byte {
+	var body bytes.Buffer
+	for _, f := range m {
+		body.WriteString(strconv.Itoa(f.tag))
+		body.WriteByte('=')
+		body.WriteString(f.val)
+		body.WriteByte(fixSOH)
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%d=%s%c%d=%d%c", fixTagBeginString, fixBeginString, fixSOH,
+		fixTagBodyLength, body.Len(), fixSOH)
+	buf.Write(body.Bytes())
+	fmt.Fprintf(&buf, "%d=%03d%c", fixTagCheckSum, fixCheckSum(buf.Bytes()), fixSOH)
+	return buf.Bytes()
+}
+
+func parseFixFields(buf []byte) (res fixMessage, err error) {
+	for _, ff := range bytes.Split(buf, []byte{fixSOH}) {
+		if len(ff) == 0 {
+			continue
+		}
+		idx := bytes.IndexByte(ff, '=')
+		if idx <= 0 {
+			err = errFixFormat
+			return
+		}
+		tag, errL := strconv.Atoi(string(ff[:idx]))
+		if errL != nil {
+			err = errFixFormat
+			return
+		}
+		res = append(res, fixField{tag, string(ff[idx+1:])})
+	}
+	return
+}
+
+// readFixMessage ... read one message from stream, validate BodyLength/CheckSum
+func readFixMessage(rd *bufio.Reader) (res fixMessage, err error) {
+	var raw bytes.Buffer
+	head, err := rd.ReadBytes(fixSOH)
+	if err != nil {
+		return
+	}
+	if string(head) != fmt.Sprintf("%d=%s%c", fixTagBeginString, fixBeginString, fixSOH) {
+		err = errFixFormat
+		return
+	}
+	raw.Write(head)
+	bl, err := rd.ReadBytes(fixSOH)
+	if err != nil {
+		return
+	}
+	raw.Write(bl)
+	if !bytes.HasPrefix(bl, []byte("9=")) {
+		err = errFixFormat
+		return
+	}
+	bLen, err := strconv.Atoi(string(bl[2 : len(bl)-1]))
+	if err != nil || bLen <= 0 {
+		err = errFixFormat
+		return
+	}
+	body := make([]byte, bLen)
+	if _, err = io.ReadFull(rd, body); err != nil {
+		return
+	}
+	raw.Write(body)
+	tail, err := rd.ReadBytes(fixSOH)
+	if err != nil {
+		return
+	}
+	if !bytes.HasPrefix(tail, []byte("10=")) {
+		err = errFixFormat
+		return
+	}
+	if cs, errL := strconv.Atoi(string(tail[3 : len(tail)-1])); errL != nil ||
+		cs != fixCheckSum(raw.Bytes()) {
+		err = errFixCheckSum
+		return
+	}
+	return parseFixFields(body)
+}
+
+func isFixAdminMsg(msgType string) bool {
+	switch msgType {
+	case fixMsgHeartbeat, fixMsgTestRequest, fixMsgResendRequest,
+		fixMsgReject, fixMsgSequenceReset, fixMsgLogout, fixMsgLogon:
+		return true
+	}
+	return false
+}
+
+// fixSession ... FIX 4.4 session layer shared by initiator and acceptor
+//	sequence numbers, heartbeat, test request, resend and gap fill
+type fixSession struct {
+	conn     net.Conn
+	rd       *bufio.Reader
+	senderID string
+	targetID string
+	heartBt  int
+	lock     sync.Mutex
+	outSeq   int // next outgoing MsgSeqNum
+	inSeq    int // next expected incoming MsgSeqNum
+	resendTo int // pending ResendRequest up to MsgSeqNum
+	sent     map[int]fixMessage
+	lastRecv time.Time
+	closed   bool
+	done     chan struct{}
+}
+
+func newFixSession(conn net.Conn, senderID, targetID string, heartBt int) *fixSession {
+	if heartBt <= 0 {
+		heartBt = 30
+	}
+	return &fixSession{conn: conn, rd: bufio.NewReader(conn),
+		senderID: senderID, targetID: targetID, heartBt: heartBt,
+		outSeq: 1, inSeq: 1, sent: map[int]fixMessage{},
+		lastRecv: time.Now(), done: make(chan struct{})}
+}
+
+func (s *fixSession) header(m fixMessage, seq int) fixMessage {
+	res := fixMessage{{fixTagMsgType, m.MsgType()},
+		{fixTagSenderCompID, s.senderID}, {fixTagTargetCompID, s.targetID},
+		{fixTagMsgSeqNum, strconv.Itoa(seq)},
+		{fixTagSendingTime, time.Now().UTC().Format(fixTimeFormat)}}
+	for _, f := range m {
+		switch f.tag {
+		case fixTagMsgType, fixTagSenderCompID, fixTagTargetCompID,
+			fixTagMsgSeqNum, fixTagSendingTime:
+			continue
+		}
+		res = append(res, f)
+	}
+	return res
+}
+
+// send ... assign MsgSeqNum, store for resend and write to peer
+func (s *fixSession) send(m fixMessage) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.closed {
+		return errFixLogout
+	}
+	seq := s.outSeq
+	s.outSeq++
+	msg := s.header(m, seq)
+	s.sent[seq] = msg
+	_, err := s.conn.Write(msg.encode())
+	return err
+}
+
+// resend ... replay stored messages, admin messages replaced by gap fill
+func (s *fixSession) resend(beginSeq, endSeq int) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if endSeq == 0 || endSeq >= s.outSeq {
+		endSeq = s.outSeq - 1
+	}
+	gapStart := 0
+	flushGap := func(next int) error {
+		if gapStart == 0 {
+			return nil
+		}
+		gap := s.header(newFixMessage(fixMsgSequenceReset), gapStart)
+		gap.Set(fixTagPossDupFlag, "Y")
+		gap.Set(fixTagGapFillFlag, "Y")
+		gap.Set(fixTagNewSeqNo, strconv.Itoa(next))
+		gapStart = 0
+		_, err := s.conn.Write(gap.encode())
+		return err
+	}
+	for seq := beginSeq; seq <= endSeq; seq++ {
+		msg, ok := s.sent[seq]
+		if !ok || isFixAdminMsg(msg.MsgType()) {
+			if gapStart == 0 {
+				gapStart = seq
+			}
+			continue
+		}
+		if err := flushGap(seq); err != nil {
+			return err
+		}
+		dup := s.header(msg, seq)
+		dup.Set(fixTagPossDupFlag, "Y")
+		dup.Set(fixTagOrigSendTime, msg.Get(fixTagSendingTime))
+		if _, err := s.conn.Write(dup.encode()); err != nil {
+			return err
+		}
+	}
+	return flushGap(endSeq + 1)
+}
+
+// close ... close connection, no logout
+func (s *fixSession) close() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if !s.closed {
+		s.closed = true
+		s.conn.Close()
+		close(s.done)
+	}
+}
+
+// logout ... send logout and close connection
+func (s *fixSession) logout(text string) {
+	m := newFixMessage(fixMsgLogout)
+	if text != "" {
+		m.Set(fixTagText, text)
+	}
+	s.send(m)
+	s.close()
+}
+
+// heartbeat ... send heartbeat every heartBt seconds until session done
+//		test request sent if nothing received for heartBt seconds
+func (s *fixSession) heartbeat() {
+	ticker := time.NewTicker(time.Duration(s.heartBt) * time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+			s.lock.Lock()
+			idle := time.Since(s.lastRecv)
+			s.lock.Unlock()
+			if idle > time.Duration(2*s.heartBt)*time.Second {
+				s.logout("heartbeat timeout")
+				return
+			}
+			if idle > time.Duration(s.heartBt)*time.Second {
+				m := newFixMessage(fixMsgTestRequest)
+				m.Set(fixTagTestReqID, strconv.FormatInt(time.Now().Unix(), 10))
+				s.send(m)
+			} else {
+				s.send(newFixMessage(fixMsgHeartbeat))
+			}
+		}
+	}
+}
+
+// run ... read loop, process session level messages
+//		application messages(and Logon/Logout) passed to handler in sequence
+func (s *fixSession) run(handler func(m fixMessage)) (err error) {
+	defer s.close()
+	for {
+		var m fixMessage
+		if m, err = readFixMessage(s.rd); err != nil {
+			s.lock.Lock()
+			if s.closed {
+				err = nil
+			}
+			s.lock.Unlock()
+			return
+		}
+		s.lock.Lock()
+		s.lastRecv = time.Now()
+		s.lock.Unlock()
+		msgType := m.MsgType()
+		seq := m.GetInt(fixTagMsgSeqNum)
+		if msgType == fixMsgSequenceReset && m.Get(fixTagGapFillFlag) != "Y" {
+			// reset mode, ignore MsgSeqNum
+			if newSeq := m.GetInt(fixTagNewSeqNo); newSeq > s.inSeq {
+				s.inSeq = newSeq
+			}
+			continue
+		}
+		if seq > s.inSeq {
+			if msgType == fixMsgLogout {
+				handler(m)
+				return errFixLogout
+			}
+			if s.resendTo < seq {
+				rr := newFixMessage(fixMsgResendRequest)
+				rr.Set(fixTagBeginSeqNo, strconv.Itoa(s.inSeq))
+				rr.Set(fixTagEndSeqNo, "0")
+				s.resendTo = seq
+				s.send(rr)
+			}
+			if msgType == fixMsgResendRequest {
+				s.resend(m.GetInt(fixTagBeginSeqNo), m.GetInt(fixTagEndSeqNo))
+			}
+			continue
+		}
+		if seq < s.inSeq {
+			if m.Get(fixTagPossDupFlag) == "Y" {
+				continue
+			}
+			s.logout(fmt.Sprintf("MsgSeqNum too low, expecting %d but received %d",
+				s.inSeq, seq))
+			return errFixSeqLow
+		}
+		s.inSeq++
+		switch msgType {
+		case fixMsgHeartbeat:
+		case fixMsgTestRequest:
+			hb := newFixMessage(fixMsgHeartbeat)
+			hb.Set(fixTagTestReqID, m.Get(fixTagTestReqID))
+			s.send(hb)
+		case fixMsgResendRequest:
+			s.resend(m.GetInt(fixTagBeginSeqNo), m.GetInt(fixTagEndSeqNo))
+		case fixMsgSequenceReset:
+			if newSeq := m.GetInt(fixTagNewSeqNo); newSeq > s.inSeq {
+				s.inSeq = newSeq
+			}
+		case fixMsgReject:
+			log.Warningf("FIX session reject RefSeqNum(%s): %s",
+				m.Get(fixTagRefSeqNum), m.Get(fixTagText))
+		case fixMsgLogout:
+			handler(m)
+			s.lock.Lock()
+			closed := s.closed
+			s.lock.Unlock()
+			if !closed {
+				// answer logout initiated by peer
+				s.logout("")
+			}
+			return errFixLogout
+		default:
+			handler(m)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package ats
+
+import (
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type fixQuote struct {
+	bid, ask, last float64
+}
+
+// FixAcceptor ... in-process FIX 4.4 acceptor for offline test of fixBroker
+//	orders sent to own simBroker account, matched by simMatchOrder against
+//	quotes of UpdateQuote, fills reported by deals of account,
+//	one session at a time
+type FixAcceptor struct {
+	ln       net.Listener
+	compID   string
+	broker   simBroker
+	lock     sync.Mutex
+	sess     *fixSession
+	execNo   int
+	nDeals   int
+	fillSize int
+	clOrdOf  map[int]string // simBroker order id to last ClOrdID
+	clOrdIDs map[string]int
+	quotes   map[string]fixQuote
+	mdSubs   map[string]string
+}
+
+// NewFixAcceptor ... listen on addr(host:port), port 0 for any free port
+func NewFixAcceptor(addr, compID string) (*FixAcceptor, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	return newFixAcceptor(ln, compID), nil
+}
+
+func newFixAcceptor(ln net.Listener, compID string) *FixAcceptor {
+	br, _ := simTrader.Open(nil)
+	a := &FixAcceptor{ln: ln, compID: compID, broker: br.(simBroker),
+		clOrdOf: map[int]string{}, clOrdIDs: map[string]int{},
+		quotes: map[string]fixQuote{}, mdSubs: map[string]string{}}
+	go a.accept()
+	return a
+}
+
+// SetFillSize ... volume of bid/ask each quote update, matched as top of
+//		depth by simMatchOrder, 0 for unlimited
+func (a *FixAcceptor) SetFillSize(qty int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.fillSize = qty
+}
+
+// Addr ... listen address of acceptor
+func (a *FixAcceptor) Addr() string {
+	return a.ln.Addr().String()
+}
+
+// Close ... logout session and stop listen
+func (a *FixAcceptor) Close() error {
+	a.lock.Lock()
+	sess := a.sess
+	a.lock.Unlock()
+	if sess != nil {
+		sess.logout("")
+	}
+	return a.ln.Close()
+}
+
+func (a *FixAcceptor) accept() {
+	for {
+		conn, err := a.ln.Accept()
+		if err != nil {
+			return
+		}
+		sess := newFixSession(conn, a.compID, "", 30)
+		a.lock.Lock()
+		a.sess = sess
+		a.lock.Unlock()
+		sess.run(func(m fixMessage) { a.onMessage(sess, m) })
+	}
+}
+
+func (a *FixAcceptor) send(m fixMessage) {
+	a.lock.Lock()
+	sess := a.sess
+	a.lock.Unlock()
+	if sess != nil {
+		sess.send(m)
+	}
+}
+
+func (a *FixAcceptor) onMessage(sess *fixSession, m fixMessage) {
+	switch m.MsgType() {
+	case fixMsgLogon:
+		sess.lock.Lock()
+		sess.targetID = m.Get(fixTagSenderCompID)
+		if hb := m.GetInt(fixTagHeartBtInt); hb > 0 {
+			sess.heartBt = hb
+		}
+		sess.lock.Unlock()
+		reply := newFixMessage(fixMsgLogon)
+		reply.Set(fixTagEncryptMethod, "0")
+		reply.Set(fixTagHeartBtInt, strconv.Itoa(sess.heartBt))
+		sess.send(reply)
+		go sess.heartbeat()
+	case fixMsgNewOrder:
+		a.onNewOrder(m)
+	case fixMsgCancelRequest:
+		a.onCancel(m)
+	case fixMsgCancelReplace:
+		a.onReplace(m)
+	case fixMsgMDRequest:
+		reqID := m.Get(fixTagMDReqID)
+		for _, f := range m {
+			if f.tag != fixTagSymbol {
+				continue
+			}
+			a.lock.Lock()
+			a.mdSubs[f.val] = reqID
+			qq, ok := a.quotes[f.val]
+			a.lock.Unlock()
+			if ok {
+				a.sendSnapshot(f.val, qq)
+			}
+		}
+	}
+}
+
+// execReport ... build ExecutionReport for simBroker order, caller hold lock
+func (a *FixAcceptor) execReport(oid int, ao *OrderType, execType string) fixMessage {
+	a.execNo++
+	m := newFixMessage(fixMsgExecReport)
+	m.Set(fixTagOrderID, strconv.Itoa(oid))
+	m.Set(fixTagClOrdID, a.clOrdOf[oid])
+	m.Set(fixTagExecID, strconv.Itoa(a.execNo))
+	m.Set(fixTagExecType, execType)
+	m.Set(fixTagOrdStatus, fixStatusString(ao.Status))
+	m.Set(fixTagSymbol, ao.Symbol)
+	m.Set(fixTagSide, fixSide(ao.Dir))
+	m.Set(fixTagOrderQty, strconv.Itoa(ao.Qty))
+	m.Set(fixTagCumQty, strconv.Itoa(ao.QtyFilled))
+	m.Set(fixTagLeavesQty, strconv.Itoa(ao.Qty-ao.QtyFilled))
+	m.Set(fixTagAvgPx, strconv.FormatFloat(ao.AvgPrice, 'f', -1, 64))
+	m.Set(fixTagTransactTime, time.Now().UTC().Format(fixTimeFormat))
+	return m
+}
+
+// fixStatusString ... map OrderStatusT to OrdStatus(39)
+func fixStatusString(st OrderStatusT) string {
+	switch st {
+	case OrderNew:
+		return "A"
+	case OrderPartFilled:
+		return "1"
+	case OrderFilled:
+		return "2"
+	case OrderCanceled:
+		return "4"
+	case OrderRejected:
+		return "8"
+	}
+	return "0"
+}
+
+func (a *FixAcceptor) reject(m fixMessage, text string) {
+	rej := newFixMessage(fixMsgExecReport)
+	a.lock.Lock()
+	a.execNo++
+	rej.Set(fixTagExecID, strconv.Itoa(a.execNo))
+	a.lock.Unlock()
+	rej.Set(fixTagOrderID, "NONE")
+	rej.Set(fixTagClOrdID, m.Get(fixTagClOrdID))
+	rej.Set(fixTagExecType, "8")
+	rej.Set(fixTagOrdStatus, "8")
+	rej.Set(fixTagSymbol, m.Get(fixTagSymbol))
+	rej.Set(fixTagSide, m.Get(fixTagSide))
+	rej.Set(fixTagOrderQty, m.Get(fixTagOrderQty))
+	rej.Set(fixTagCumQty, "0")
+	rej.Set(fixTagLeavesQty, "0")
+	rej.Set(fixTagAvgPx, "0")
+	rej.Set(fixTagText, text)
+	a.send(rej)
+}
+
+func (a *FixAcceptor) onNewOrder(m fixMessage) {
+	sym := m.Get(fixTagSymbol)
+	qty := m.GetInt(fixTagOrderQty)
+	if _, err := GetSymbolInfo(sym); err != nil || qty <= 0 {
+		a.reject(m, "invalid symbol or quantity")
+		return
+	}
+	dir := fixOrderDir(m.Get(fixTagSide), m.Get(fixTagOpenClose))
+	prc := m.GetFloat(fixTagPrice)
+	if m.Get(fixTagOrdType) == "1" {
+		prc = 0
+	}
+	a.lock.Lock()
+	oid := a.broker.SendOrder(sym, dir, qty, prc, 0)
+	if oid < 0 {
+		a.lock.Unlock()
+		a.reject(m, "simBroker reject")
+		return
+	}
+	a.clOrdOf[oid] = m.Get(fixTagClOrdID)
+	a.clOrdIDs[a.clOrdOf[oid]] = oid
+	rep := a.execReport(oid, a.broker.GetOrder(oid), "0")
+	a.lock.Unlock()
+	a.send(rep)
+	a.match(sym)
+}
+
+// findOrder ... simBroker order id of OrigClOrdID, 0 for unknown
+func (a *FixAcceptor) findOrder(m fixMessage) int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.clOrdIDs[m.Get(fixTagOrigClOrdID)]
+}
+
+func (a *FixAcceptor) cancelReject(m fixMessage, text string) {
+	rej := newFixMessage(fixMsgCancelReject)
+	rej.Set(fixTagOrderID, "NONE")
+	rej.Set(fixTagClOrdID, m.Get(fixTagClOrdID))
+	rej.Set(fixTagOrigClOrdID, m.Get(fixTagOrigClOrdID))
+	rej.Set(fixTagOrdStatus, "8")
+	rej.Set(fixTagText, text)
+	a.send(rej)
+}
+
+// openOrder ... true for order could be canceled or filled
+func openOrder(or *OrderType) bool {
+	return or.Status == OrderAccept || or.Status == OrderPartFilled
+}
+
+func (a *FixAcceptor) onCancel(m fixMessage) {
+	oid := a.findOrder(m)
+	if oid == 0 {
+		a.cancelReject(m, "unknown order")
+		return
+	}
+	a.lock.Lock()
+	if err := a.broker.CancelOrder(oid); err != nil {
+		a.lock.Unlock()
+		a.cancelReject(m, err.Error())
+		return
+	}
+	a.clOrdOf[oid] = m.Get(fixTagClOrdID)
+	a.clOrdIDs[a.clOrdOf[oid]] = oid
+	rep := a.execReport(oid, a.broker.GetOrder(oid), "4")
+	a.lock.Unlock()
+	rep.Set(fixTagOrigClOrdID, m.Get(fixTagOrigClOrdID))
+	a.send(rep)
+}
+
+// onReplace ... only replace to market order supported, via simBroker CloseOrder
+func (a *FixAcceptor) onReplace(m fixMessage) {
+	oid := a.findOrder(m)
+	if oid == 0 || m.Get(fixTagOrdType) != "1" {
+		a.cancelReject(m, "unknown order or unsupported replace")
+		return
+	}
+	a.lock.Lock()
+	or := a.broker.GetOrder(oid)
+	if !openOrder(or) {
+		a.lock.Unlock()
+		a.cancelReject(m, "order filled or canceled")
+		return
+	}
+	a.broker.CloseOrder(oid)
+	a.clOrdOf[oid] = m.Get(fixTagClOrdID)
+	a.clOrdIDs[a.clOrdOf[oid]] = oid
+	rep := a.execReport(oid, or, "5")
+	a.lock.Unlock()
+	rep.Set(fixTagOrigClOrdID, m.Get(fixTagOrigClOrdID))
+	a.send(rep)
+	a.match(or.Symbol)
+}
+
+func (a *FixAcceptor) sendSnapshot(sym string, qq fixQuote) {
+	a.lock.Lock()
+	reqID, ok := a.mdSubs[sym]
+	a.lock.Unlock()
+	if !ok {
+		return
+	}
+	m := newFixMessage(fixMsgMDSnapshot)
+	m.Set(fixTagMDReqID, reqID)
+	m.Set(fixTagSymbol, sym)
+	m.Set(fixTagNoMDEntries, "3")
+	for i, px := range []float64{qq.bid, qq.ask, qq.last} {
+		m.Add(fixTagMDEntryType, strconv.Itoa(i))
+		m.Add(fixTagMDEntryPx, strconv.FormatFloat(px, 'f', -1, 64))
+	}
+	a.send(m)
+}
+
+// UpdateQuote ... update quote of sym, publish snapshot and match orders
+//		last ignored for forex
+func (a *FixAcceptor) UpdateQuote(sym string, bid, ask, last float64) error {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return err
+	}
+	qq := fixQuote{bid, ask, last}
+	if si.IsForex {
+		qq.last = bid
+	}
+	a.lock.Lock()
+	a.quotes[sym] = qq
+	a.lock.Unlock()
+	a.sendSnapshot(sym, qq)
+	a.match(sym)
+	return nil
+}
+
+// match ... match orders of sym via simMatchOrder with last quote as tick,
+//		report each fill of account deals with LastQty/LastPx
+func (a *FixAcceptor) match(sym string) {
+	s, err := GetSymbolInfo(sym)
+	if err != nil {
+		return
+	}
+	si, _ := s.fKey.SymbolInfo()
+	var reps []fixMessage
+	a.lock.Lock()
+	if qq, ok := a.quotes[sym]; ok {
+		simVmLock.Lock()
+		simMatchOrder(si, a.quoteTick(si, qq))
+		simVmLock.Unlock()
+		deals := a.broker.dealsFrom(a.nDeals)
+		a.nDeals += len(deals)
+		for _, d := range deals {
+			if _, ok := a.clOrdOf[d.Oid]; !ok {
+				continue
+			}
+			rep := a.execReport(d.Oid, a.broker.GetOrder(d.Oid), "F")
+			rep.Set(fixTagLastQty, strconv.Itoa(d.Qty))
+			rep.Set(fixTagLastPx, strconv.FormatFloat(d.Price, 'f', -1, 64))
+			reps = append(reps, rep)
+		}
+	}
+	a.lock.Unlock()
+	for _, rep := range reps {
+		a.send(rep)
+	}
+}
+
+// quoteTick ... quote as single tick for simMatchOrder, bid/ask as top of
+//		depth with fillSize volume, caller hold lock
+func (a *FixAcceptor) quoteTick(si *SymbolInfo, qq fixQuote) simTicker {
+	qr := quoteRecord{Quotes: Quotes{UpdateTime: TimeToDateTimeMs(time.Now()),
+		Bid: qq.bid, Ask: qq.ask, Last: qq.last}}
+	if a.fillSize > 0 {
+		if qq.bid > 0 {
+			qr.Bids = []DepthLevel{{qq.bid, int64(a.fillSize)}}
+		}
+		if qq.ask > 0 {
+			qr.Asks = []DepthLevel{{qq.ask, int64(a.fillSize)}}
+		}
+	}
+	return &replayTick{multi: si.Multi(), recs: []quoteRecord{qr}}
+}
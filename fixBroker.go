@@ -0,0 +1,484 @@
+package ats
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fixBroker ... Broker via FIX 4.4 session
+//	Config items: FixHost(host:port), SenderCompID, TargetCompID,
+//		HeartBtInt(seconds), Fund
+//	positions and P&L accounted locally from ExecutionReport fills
+type fixBroker struct {
+	evChan   chan<- QuoteEvent
+	sess     *fixSession
+	lock     sync.RWMutex
+	acct     account
+	orderNo  int
+	orders   map[int]*OrderType
+	clOrdIDs map[string]int
+	execIDs  map[string]bool
+	quotes   map[SymbolKey]*QuoteSnap
+	logon    chan struct{}
+	bLogon   bool
+	current  DateTimeMs
+}
+
+var (
+	errFixNoHost = errors.New("FixHost not configured")
+	errFixNoSess = errors.New("FIX session not started")
+)
+
+const fixLogonTimeout = 10 * time.Second
+
+func (b *fixBroker) Open(ch chan<- QuoteEvent) (Broker, error) {
+	var res = fixBroker{evChan: ch, orders: map[int]*OrderType{},
+		clOrdIDs: map[string]int{}, execIDs: map[string]bool{},
+		quotes: map[SymbolKey]*QuoteSnap{}, logon: make(chan struct{})}
+	res.acct = account{fundStart: defaultFund, fund: defaultFund, evChan: ch,
+		equity: defaultFund, balance: defaultFund}
+	res.acct.orders = []int{}
+	res.acct.pos = map[SymbolKey]*PositionType{}
+	return &res, nil
+}
+
+// Start ... connect FixHost and logon
+func (b *fixBroker) Start(c Config) error {
+	host := c.GetString("FixHost", "")
+	if host == "" {
+		return errFixNoHost
+	}
+	if fund := c.GetFloat64("Fund", 0); fund > 0 {
+		b.acct.fundStart, b.acct.fund = fund, fund
+		b.acct.equity, b.acct.balance = fund, fund
+	}
+	conn, err := net.DialTimeout("tcp", host, fixLogonTimeout)
+	if err != nil {
+		return err
+	}
+	b.sess = newFixSession(conn, c.GetString("SenderCompID", "ATS"),
+		c.GetString("TargetCompID", "FIXSIM"), c.GetInt("HeartBtInt", 30))
+	go func() {
+		if err := b.sess.run(b.onMessage); err != nil {
+			log.Warning("fixBroker session:", err)
+		}
+	}()
+	logon := newFixMessage(fixMsgLogon)
+	logon.Set(fixTagEncryptMethod, "0")
+	logon.Set(fixTagHeartBtInt, strconv.Itoa(b.sess.heartBt))
+	logon.Set(fixTagResetSeqNum, "Y")
+	if err := b.sess.send(logon); err != nil {
+		b.sess.close()
+		return err
+	}
+	select {
+	case <-b.logon:
+	case <-b.sess.done:
+		return errFixNoLogon
+	case <-time.After(fixLogonTimeout):
+		b.sess.close()
+		return errFixNoLogon
+	}
+	go b.sess.heartbeat()
+	b.lock.RLock()
+	syms := []string{}
+	for fk := range b.quotes {
+		if si, err := fk.SymbolInfo(); err == nil {
+			syms = append(syms, si.Ticker)
+		}
+	}
+	b.lock.RUnlock()
+	return b.requestMarketData(syms)
+}
+
+// Stop ... logout and close FIX session
+func (b *fixBroker) Stop() error {
+	if b.sess == nil {
+		return nil
+	}
+	b.sess.logout("")
+	return nil
+}
+
+func (b *fixBroker) requestMarketData(syms []string) error {
+	if len(syms) == 0 {
+		return nil
+	}
+	m := newFixMessage(fixMsgMDRequest)
+	m.Set(fixTagMDReqID, strconv.FormatInt(time.Now().UnixNano(), 36))
+	m.Set(fixTagSubReqType, "1")
+	m.Set(fixTagMarketDepth, "1")
+	m.Set(fixTagNoMDEntryType, "2")
+	m.Add(fixTagMDEntryType, "0")
+	m.Add(fixTagMDEntryType, "1")
+	m.Add(fixTagNoRelatedSym, strconv.Itoa(len(syms)))
+	for _, sym := range syms {
+		m.Add(fixTagSymbol, sym)
+	}
+	return b.sess.send(m)
+}
+
+func (b *fixBroker) SubscribeQuotes(qq []QuoteSubT) error {
+	syms := []string{}
+	b.lock.Lock()
+	for _, qs := range qq {
+		if si, err := GetSymbolInfo(qs.Symbol); err == nil {
+			if _, ok := b.quotes[si.fKey]; !ok {
+				b.quotes[si.fKey] = qs.QuotesPtr
+				syms = append(syms, qs.Symbol)
+			}
+		}
+	}
+	bLogon := b.bLogon
+	b.lock.Unlock()
+	if !bLogon {
+		// request after logon
+		return nil
+	}
+	return b.requestMarketData(syms)
+}
+
+// fixOrdStatus ... map OrdStatus(39) to OrderStatusT
+//		false for status no change, such as pending cancel/replace
+func fixOrdStatus(st string) (OrderStatusT, bool) {
+	switch st {
+	case "A":
+		return OrderNew, true
+	case "0":
+		return OrderAccept, true
+	case "1":
+		return OrderPartFilled, true
+	case "2":
+		return OrderFilled, true
+	case "4", "C":
+		return OrderCanceled, true
+	case "8":
+		return OrderRejected, true
+	}
+	return OrderNil, false
+}
+
+func fixSide(dir OrderDirT) string {
+	if dir.Sign() > 0 {
+		return "1"
+	}
+	return "2"
+}
+
+// fixOrderDir ... build OrderDirT from Side(54) and OpenClose(77)
+func fixOrderDir(side, openClose string) OrderDirT {
+	if side == "1" {
+		if openClose == "C" {
+			return OrderDirCover
+		}
+		return OrderDirBuy
+	}
+	if openClose == "C" {
+		return OrderDirClose
+	}
+	return OrderDirSell
+}
+
+func fixTimeMs(ss string) DateTimeMs {
+	if tt, err := time.Parse(fixTimeFormat, ss); err == nil {
+		return TimeToDateTimeMs(tt)
+	}
+	return 0
+}
+
+func (b *fixBroker) onMessage(m fixMessage) {
+	if tt := fixTimeMs(m.Get(fixTagSendingTime)); tt != 0 {
+		b.lock.Lock()
+		b.current = tt
+		b.lock.Unlock()
+	}
+	switch m.MsgType() {
+	case fixMsgLogon:
+		b.lock.Lock()
+		if !b.bLogon {
+			b.bLogon = true
+			close(b.logon)
+		}
+		b.lock.Unlock()
+	case fixMsgLogout:
+		log.Info("fixBroker logout:", m.Get(fixTagText))
+	case fixMsgExecReport:
+		b.onExecReport(m)
+	case fixMsgCancelReject:
+		log.Warningf("fixBroker cancel reject ClOrdID(%s): %s",
+			m.Get(fixTagOrigClOrdID), m.Get(fixTagText))
+	case fixMsgMDSnapshot:
+		b.onMarketData(m)
+	}
+}
+
+func (b *fixBroker) onExecReport(m fixMessage) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	execID := m.Get(fixTagExecID)
+	if b.execIDs[execID] {
+		// duplicate report
+		return
+	}
+	b.execIDs[execID] = true
+	oid, ok := b.clOrdIDs[m.Get(fixTagClOrdID)]
+	if !ok {
+		if oid, ok = b.clOrdIDs[m.Get(fixTagOrigClOrdID)]; !ok {
+			log.Warning("fixBroker ExecutionReport for unknown order", m)
+			return
+		}
+	}
+	or := b.orders[oid]
+	if st, ok := fixOrdStatus(m.Get(fixTagOrdStatus)); ok {
+		or.Status = st
+	}
+	or.QtyFilled = m.GetInt(fixTagCumQty)
+	if avgPx := m.GetFloat(fixTagAvgPx); avgPx != 0 {
+		or.AvgPrice = avgPx
+	}
+	switch or.Status {
+	case OrderAccept:
+		if or.AckTime == 0 {
+			or.AckTime = b.current
+		}
+	case OrderFilled, OrderCanceled, OrderRejected:
+		or.DoneTime = b.current
+	}
+	if or.Status == OrderRejected {
+		log.Warningf("fixBroker order %d rejected: %s", oid, m.Get(fixTagText))
+	}
+	if lastQty := m.GetInt(fixTagLastQty); lastQty > 0 {
+		if si, err := GetSymbolInfo(or.Symbol); err == nil {
+			b.acct.updatePos(&si, or.Dir, m.GetFloat(fixTagLastPx), lastQty)
+		}
+	}
+}
+
+func (b *fixBroker) onMarketData(m fixMessage) {
+	si, err := GetSymbolInfo(m.Get(fixTagSymbol))
+	if err != nil {
+		return
+	}
+	b.lock.RLock()
+	qs, ok := b.quotes[si.fKey]
+	curT := b.current
+	b.lock.RUnlock()
+	if !ok {
+		return
+	}
+	qs.Update(func(qq *Quotes) {
+		qq.UpdateTime = curT
+		entType := ""
+		for _, f := range m {
+			switch f.tag {
+			case fixTagMDEntryType:
+				entType = f.val
+			case fixTagMDEntryPx:
+				px, _ := strconv.ParseFloat(f.val, 64)
+				switch entType {
+				case "0":
+					qq.Bid = px
+				case "1":
+					qq.Ask = px
+				case "2":
+					qq.Last = px
+				}
+			case fixTagMDEntrySize:
+				sz, _ := strconv.ParseInt(f.val, 10, 64)
+				switch entType {
+				case "0":
+					qq.BidVol = sz
+				case "1":
+					qq.AskVol = sz
+				}
+			}
+		}
+		if si.IsForex {
+			qq.Last = qq.Bid
+		}
+	})
+	if b.evChan != nil {
+		b.evChan <- QuoteEvent{Symbol: si.Ticker}
+	}
+}
+
+func (b *fixBroker) Equity() float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	res := b.acct.balance
+	for fk, pos := range b.acct.pos {
+		qq, ok := b.quotes[fk]
+		if !ok || pos.Positions == 0 {
+			continue
+		}
+		if si, err := fk.SymbolInfo(); err == nil {
+			res += si.CalcProfit(pos.AvgPrice, qq.Load().Last, pos.Positions)
+		}
+	}
+	return res
+}
+
+func (b *fixBroker) Balance() float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.acct.balance
+}
+
+func (b *fixBroker) Cash() float64 {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.acct.fund
+}
+
+func (b *fixBroker) FreeMargin() float64 {
+	return b.Equity() - b.acct.margin
+}
+
+func (b *fixBroker) SendOrder(sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64) int {
+	if _, err := GetSymbolInfo(sym); err != nil || b.sess == nil {
+		return -1
+	}
+	b.lock.Lock()
+	b.orderNo++
+	oid := b.orderNo
+	clOrdID := strconv.Itoa(oid)
+	or := &OrderType{Symbol: sym, Price: prc, StopPrice: stopL, Dir: dir,
+		Qty: qty, Status: OrderNew}
+	b.orders[oid] = or
+	b.clOrdIDs[clOrdID] = oid
+	b.acct.orders = append(b.acct.orders, oid)
+	b.lock.Unlock()
+	m := newFixMessage(fixMsgNewOrder)
+	m.Set(fixTagClOrdID, clOrdID)
+	m.Set(fixTagHandlInst, "1")
+	m.Set(fixTagSymbol, sym)
+	m.Set(fixTagSide, fixSide(dir))
+	if dir.IsOffset() {
+		m.Set(fixTagOpenClose, "C")
+	} else {
+		m.Set(fixTagOpenClose, "O")
+	}
+	m.Set(fixTagTransactTime, time.Now().UTC().Format(fixTimeFormat))
+	m.Set(fixTagOrderQty, strconv.Itoa(qty))
+	if prc == 0 {
+		m.Set(fixTagOrdType, "1")
+	} else {
+		m.Set(fixTagOrdType, "2")
+		m.Set(fixTagPrice, strconv.FormatFloat(prc, 'f', -1, 64))
+	}
+	if err := b.sess.send(m); err != nil {
+		b.lock.Lock()
+		or.Status = OrderRejected
+		b.lock.Unlock()
+		return -1
+	}
+	return oid
+}
+
+// orderRequest ... build cancel or cancel/replace request for order
+func (b *fixBroker) orderRequest(msgType string, oid int) (m fixMessage, err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	or, ok := b.orders[oid]
+	if !ok {
+		err = errNoOrder
+		return
+	}
+	switch or.Status {
+	case OrderFilled, OrderCanceled, OrderRejected:
+		err = errCancelOrder
+		return
+	}
+	b.orderNo++
+	clOrdID := strconv.Itoa(oid) + "-" + strconv.Itoa(b.orderNo)
+	b.clOrdIDs[clOrdID] = oid
+	m = newFixMessage(msgType)
+	m.Set(fixTagOrigClOrdID, strconv.Itoa(oid))
+	m.Set(fixTagClOrdID, clOrdID)
+	m.Set(fixTagSymbol, or.Symbol)
+	m.Set(fixTagSide, fixSide(or.Dir))
+	m.Set(fixTagTransactTime, time.Now().UTC().Format(fixTimeFormat))
+	m.Set(fixTagOrderQty, strconv.Itoa(or.Qty))
+	return
+}
+
+func (b *fixBroker) CancelOrder(oid int) error {
+	if b.sess == nil {
+		return errFixNoSess
+	}
+	m, err := b.orderRequest(fixMsgCancelRequest, oid)
+	if err != nil {
+		return err
+	}
+	return b.sess.send(m)
+}
+
+// CloseOrder ... open order replaced by market order
+func (b *fixBroker) CloseOrder(oid int) {
+	if b.sess == nil {
+		return
+	}
+	if m, err := b.orderRequest(fixMsgCancelReplace, oid); err == nil {
+		m.Set(fixTagHandlInst, "1")
+		m.Set(fixTagOrdType, "1")
+		b.sess.send(m)
+	}
+}
+
+func (b *fixBroker) GetOrder(oid int) *OrderType {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if or, ok := b.orders[oid]; ok {
+		res := *or
+		return &res
+	}
+	return nil
+}
+
+func (b *fixBroker) GetOrders() []int {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	return b.acct.orders
+}
+
+func (b *fixBroker) GetPosition(sym string) (vPos PositionType) {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return
+	}
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if v, ok := b.acct.pos[si.fKey]; ok {
+		vPos = *v
+	}
+	return
+}
+
+func (b *fixBroker) GetPositions() (res []PositionType) {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	for _, v := range b.acct.pos {
+		res = append(res, *v)
+	}
+	return
+}
+
+// TimeCurrent ... SendingTime of last message from server
+func (b *fixBroker) TimeCurrent() DateTimeMs {
+	b.lock.RLock()
+	defer b.lock.RUnlock()
+	if b.current == 0 {
+		return TimeToDateTimeMs(time.Now())
+	}
+	return b.current
+}
+
+var fixTrader fixBroker
+
+func init() {
+	RegisterBroker("fixBroker", &fixTrader)
+}
@@ -0,0 +1,191 @@
+package ats
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dropListener ... listener with conns could lose next write
+type dropListener struct {
+	net.Listener
+	lock  sync.Mutex
+	conns []*dropConn
+}
+
+type dropConn struct {
+	net.Conn
+	lock sync.Mutex
+	drop bool
+}
+
+func (l *dropListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	dc := &dropConn{Conn: conn}
+	l.lock.Lock()
+	l.conns = append(l.conns, dc)
+	l.lock.Unlock()
+	return dc, nil
+}
+
+// dropNext ... next message written to peer lost
+func (l *dropListener) dropNext() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	for _, dc := range l.conns {
+		dc.lock.Lock()
+		dc.drop = true
+		dc.lock.Unlock()
+	}
+}
+
+func (c *dropConn) Write(b []byte) (int, error) {
+	c.lock.Lock()
+	drop := c.drop
+	c.drop = false
+	c.lock.Unlock()
+	if drop {
+		return len(b), nil
+	}
+	return c.Conn.Write(b)
+}
+
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 200; i++ {
+		if cond() {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestFixMessageCodec(t *testing.T) {
+	m := newFixMessage(fixMsgNewOrder)
+	m.Set(fixTagClOrdID, "12")
+	m.Set(fixTagSymbol, "XAUUSD")
+	m.Set(fixTagOrderQty, "3")
+	buf := m.encode()
+	t.Log(m)
+	rd := bufio.NewReader(bytes.NewReader(buf))
+	if res, err := readFixMessage(rd); err != nil {
+		t.Error("readFixMessage", err)
+	} else if res.MsgType() != fixMsgNewOrder || res.Get(fixTagSymbol) != "XAUUSD" ||
+		res.GetInt(fixTagOrderQty) != 3 {
+		t.Error("decode diff", res)
+	}
+	buf[len(buf)-3]++
+	if _, err := readFixMessage(bufio.NewReader(bytes.NewReader(buf))); err != errFixCheckSum {
+		t.Error("checksum error expected, got", err)
+	}
+}
+
+func TestFixBroker(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("XAUUSD")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal("Listen", err)
+	}
+	dl := &dropListener{Listener: ln}
+	acc := newFixAcceptor(dl, "FIXSIM")
+	defer acc.Close()
+	acc.UpdateQuote("XAUUSD", 1300.0, 1300.5, 0)
+	ch := make(chan QuoteEvent, 1024)
+	br, err := openBroker("fixBroker", ch)
+	if err != nil {
+		t.Fatal("openBroker", err)
+	}
+	var qq QuoteSnap
+	br.SubscribeQuotes([]QuoteSubT{{Symbol: "XAUUSD", QuotesPtr: &qq}})
+	conf := Config{"FixHost": acc.Addr(), "SenderCompID": "ATS",
+		"TargetCompID": "FIXSIM", "HeartBtInt": 1}
+	if err := br.Start(conf); err != nil {
+		t.Fatal("fixBroker Start", err)
+	}
+	defer br.Stop()
+	orderStatus := func(oid int, st OrderStatusT) bool {
+		return waitFor(func() bool {
+			or := br.GetOrder(oid)
+			return or != nil && or.Status == st
+		})
+	}
+	oid1 := br.SendOrder("XAUUSD", OrderDirBuy, 1, 1290, 0)
+	if !orderStatus(oid1, OrderAccept) {
+		t.Error("order not accepted", br.GetOrder(oid1))
+	}
+	oid2 := br.SendOrder("XAUUSD", OrderDirBuy, 2, 1301, 0)
+	if !orderStatus(oid2, OrderFilled) {
+		t.Error("order not filled", br.GetOrder(oid2))
+	} else if or := br.GetOrder(oid2); or.AvgPrice != 1300.5 || or.QtyFilled != 2 {
+		t.Error("fill diff", or)
+	}
+	if pos := br.GetPosition("XAUUSD"); pos.Positions != 2 {
+		t.Error("position diff", pos)
+	}
+	if err := br.CancelOrder(oid1); err != nil {
+		t.Error("CancelOrder", err)
+	} else if !orderStatus(oid1, OrderCanceled) {
+		t.Error("order not canceled", br.GetOrder(oid1))
+	}
+	if err := br.CancelOrder(oid2); err == nil {
+		t.Error("cancel filled order should fail")
+	}
+	// lost ack, recovered by resend request
+	dl.dropNext()
+	oid3 := br.SendOrder("XAUUSD", OrderDirClose, 2, 1310, 0)
+	time.Sleep(50 * time.Millisecond)
+	acc.UpdateQuote("XAUUSD", 1310.5, 1311, 0)
+	if !orderStatus(oid3, OrderFilled) {
+		t.Error("order not filled after resend", br.GetOrder(oid3))
+	}
+	if pos := br.GetPosition("XAUUSD"); pos.Positions != 0 {
+		t.Error("position diff", pos)
+	}
+	if !waitFor(func() bool { return round(br.Balance()) == round(defaultFund+20) }) {
+		t.Errorf("Balance %f, want %f", br.Balance(), defaultFund+20)
+	}
+	// market order via CloseOrder
+	oid4 := br.SendOrder("XAUUSD", OrderDirBuy, 1, 1200, 0)
+	orderStatus(oid4, OrderAccept)
+	br.CloseOrder(oid4)
+	if !orderStatus(oid4, OrderFilled) {
+		t.Error("CloseOrder not filled", br.GetOrder(oid4))
+	}
+	if !waitFor(func() bool { return qq.Load().Bid == 1310.5 }) {
+		t.Error("quotes not updated", qq.Load())
+	}
+	// partial fills at different prices, long 1 closed at 1310.5 and
+	// short opened at 1320.5, not average of order
+	acc.SetFillSize(1)
+	oid5 := br.SendOrder("XAUUSD", OrderDirSell, 2, 0, 0)
+	if !orderStatus(oid5, OrderPartFilled) {
+		t.Error("order not part filled", br.GetOrder(oid5))
+	}
+	acc.UpdateQuote("XAUUSD", 1320.5, 1321, 0)
+	if !orderStatus(oid5, OrderFilled) {
+		t.Error("order not filled", br.GetOrder(oid5))
+	} else if or := br.GetOrder(oid5); or.AvgPrice != 1315.5 {
+		t.Error("avg price diff", or)
+	}
+	if !waitFor(func() bool {
+		pos := br.GetPosition("XAUUSD")
+		return pos.Positions == -1 && pos.AvgPrice == 1320.5
+	}) {
+		t.Error("position diff", br.GetPosition("XAUUSD"))
+	}
+	// filled by simBroker account of acceptor, fill prices from deals
+	if pos := acc.broker.GetPosition("XAUUSD"); pos.Positions != -1 || pos.AvgPrice != 1320.5 {
+		t.Error("acceptor simBroker position diff", pos)
+	}
+	if deals := acc.broker.GetDeals(); len(deals) != 5 || deals[3].Price != 1310.5 ||
+		deals[4].Price != 1320.5 {
+		t.Error("acceptor deals diff", deals)
+	}
+}
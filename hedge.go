@@ -0,0 +1,192 @@
+package ats
+
+import (
+	"errors"
+)
+
+var (
+	errNoAccount    = errors.New("No such account")
+	errHasPositions = errors.New("Position mode switch with positions")
+	errNoLeg        = errors.New("Offset over position of leg")
+)
+
+// posLeg ... leg of position with signed qty, negative for short
+type posLeg struct {
+	qty      int
+	avgPrice float64
+}
+
+// legs ... legs of position, long and short legs for hedging account,
+//		net position for netting account
+func (pos *PositionType) legs() []posLeg {
+	if pos.Long.Positions == 0 && pos.Short.Positions == 0 {
+		if pos.Positions == 0 {
+			return nil
+		}
+		return []posLeg{{pos.Positions, pos.AvgPrice}}
+	}
+	var res []posLeg
+	if pos.Long.Positions > 0 {
+		res = append(res, posLeg{pos.Long.Positions, pos.Long.AvgPrice})
+	}
+	if pos.Short.Positions > 0 {
+		res = append(res, posLeg{-pos.Short.Positions, pos.Short.AvgPrice})
+	}
+	return res
+}
+
+// open ... open vol at price, opened today
+func (leg *PositionLeg) open(price float64, vol int) {
+	avg := leg.AvgPrice*float64(leg.Positions) + price*float64(vol)
+	leg.Positions += vol
+	leg.Today += vol
+	leg.AvgPrice = avg / float64(leg.Positions)
+}
+
+// offset ... offset vol of leg, opened today first for today, else
+//		opened before first
+func (leg *PositionLeg) offset(vol int, today bool) {
+	if today {
+		leg.Today -= vol
+		if leg.Today < 0 {
+			leg.Today = 0
+		}
+	} else if over := vol - (leg.Positions - leg.Today); over > 0 {
+		leg.Today -= over
+	}
+	leg.Positions -= vol
+	if leg.Positions <= 0 {
+		*leg = PositionLeg{}
+	}
+}
+
+// available ... qty of leg could be offset, only opened today or before
+//		for exchanges distinguish close today
+func (leg *PositionLeg) available(dir OrderDirT, closeToday bool) int {
+	if !closeToday {
+		return leg.Positions
+	}
+	if dir.IsToday() {
+		return leg.Today
+	}
+	return leg.Positions - leg.Today
+}
+
+// updateLeg ... update leg of hedging position with filled volume at fLast
+//		Buy/Sell open long/short leg, Cover/Close offset short/long leg
+func (acct *account) updateLeg(si *SymbolInfo, pos *PositionType, dir OrderDirT, fLast float64, vol int) (profit float64) {
+	switch dir {
+	case OrderDirBuy:
+		pos.Long.open(fLast, vol)
+		if si.SettleT1 {
+			// T+1, bought today frozen till next trading day
+			pos.PosFreeze += vol
+		}
+		acct.tradeOpen(si, 1, vol, fLast)
+	case OrderDirSell:
+		pos.Short.open(fLast, vol)
+		acct.tradeOpen(si, -1, vol, fLast)
+	case OrderDirCover, OrderDirCoverToday:
+		profit = acct.toBase(si, si.CalcProfit(pos.Short.AvgPrice, fLast, -vol))
+		pos.Short.offset(vol, dir.IsToday())
+		acct.realize(profit)
+		acct.tradeClose(si, -1, vol, fLast, profit, pos.Short.Positions == 0)
+	case OrderDirClose, OrderDirCloseToday:
+		profit = acct.toBase(si, si.CalcProfit(pos.Long.AvgPrice, fLast, vol))
+		pos.Long.offset(vol, dir.IsToday())
+		if pos.PosFreeze > pos.Long.Positions {
+			pos.PosFreeze = pos.Long.Positions
+		}
+		acct.realize(profit)
+		acct.tradeClose(si, 1, vol, fLast, profit, pos.Long.Positions == 0)
+	}
+	pos.Positions = pos.Long.Positions - pos.Short.Positions
+	if pos.Positions >= 0 {
+		pos.AvgPrice = pos.Long.AvgPrice
+	} else {
+		pos.AvgPrice = pos.Short.AvgPrice
+	}
+	return
+}
+
+// checkHedge ... verify order of hedging account, offset within leg
+//		available excluded pending offset orders and T+1 frozen long,
+//		short open by short mode
+//		caller hold simVmLock
+func (acct *account) checkHedge(si *SymbolInfo, dir OrderDirT, qty int) error {
+	var pos PositionType
+	acctLock.RLock()
+	if p, ok := acct.pos[si.fKey]; ok {
+		pos = *p
+	}
+	acctLock.RUnlock()
+	var leg *PositionLeg
+	switch dir {
+	case OrderDirBuy:
+		return nil
+	case OrderDirSell:
+		if si.ShortMode == ShortFree {
+			return nil
+		}
+		leg = &pos.Short
+	case OrderDirCover, OrderDirCoverToday:
+		leg = &pos.Short
+	default:
+		leg = &pos.Long
+	}
+	// pending orders of same leg, offset of today or before separated
+	//	for exchanges distinguish close today
+	pending := 0
+	for _, oid := range acct.orders {
+		or, ok := simOrders[oid]
+		if !ok || or.Symbol != si.Ticker || or.Dir.Sign() != dir.Sign() ||
+			or.Dir.IsOffset() != dir.IsOffset() {
+			continue
+		}
+		if si.CloseToday && or.Dir != dir {
+			continue
+		}
+		switch or.Status {
+		case OrderAccept, OrderPartFilled:
+			pending += or.Qty - or.QtyFilled
+		}
+	}
+	if dir == OrderDirSell {
+		return si.checkShort(leg.Positions + pending + qty)
+	}
+	if si.SettleT1 && leg == &pos.Long && qty+pending > leg.Positions-pos.PosFreeze {
+		// T+1, long leg bought today frozen
+		return errNoAvailable
+	}
+	if qty+pending > leg.available(dir, si.CloseToday) {
+		return errNoLeg
+	}
+	return nil
+}
+
+// SetHedging ... switch account to hedging or netting mode, no positions
+func (b simBroker) SetHedging(on bool) error {
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	acct, ok := simAccounts[b]
+	if !ok {
+		return errNoAccount
+	}
+	for _, pos := range acct.pos {
+		if pos.Positions != 0 || pos.Long.Positions != 0 || pos.Short.Positions != 0 {
+			return errHasPositions
+		}
+	}
+	acct.hedging = on
+	return nil
+}
+
+// Hedging ... true for hedging account
+func (b simBroker) Hedging() bool {
+	acctLock.RLock()
+	defer acctLock.RUnlock()
+	if acct, ok := simAccounts[b]; ok {
+		return acct.hedging
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package ats
+
+import "testing"
+
+func Test_account_updateLeg(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("cu1905")
+	si, err := GetSymbolInfo("cu1905")
+	if err != nil {
+		t.Skip("no cu1905", err)
+	}
+	tb, acct, release := newTestAccount(-5)
+	defer release()
+	if err := tb.SetHedging(true); err != nil || !tb.Hedging() {
+		t.Error("SetHedging", err)
+	}
+	acct.updatePos(&si, OrderDirBuy, 46000, 3)
+	acct.updatePos(&si, OrderDirSell, 46200, 2)
+	pos := acct.pos[si.fKey]
+	if pos.Positions != 1 || pos.Long.Positions != 3 || pos.Short.Positions != 2 ||
+		pos.Long.Today != 3 {
+		t.Error("legs diff", *pos)
+	}
+	if err := tb.SetHedging(false); err != errHasPositions {
+		t.Error("SetHedging with positions", err)
+	}
+	// SHFE close today only for legs opened today
+	tests := []struct {
+		name string
+		dir  OrderDirT
+		qty  int
+		want error
+	}{
+		{"open long", OrderDirBuy, 10, nil},
+		{"close yesterday", OrderDirClose, 1, errNoLeg},
+		{"close today", OrderDirCloseToday, 3, nil},
+		{"close today over", OrderDirCloseToday, 4, errNoLeg},
+		{"cover today", OrderDirCoverToday, 2, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simVmLock.Lock()
+			got := acct.checkHedge(&si, tt.dir, tt.qty)
+			simVmLock.Unlock()
+			if got != tt.want {
+				t.Errorf("checkHedge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	simSettle()
+	if pos.Long.Today != 0 || pos.Short.Today != 0 {
+		t.Error("legs after settle", *pos)
+	}
+	simVmLock.Lock()
+	if err := acct.checkHedge(&si, OrderDirClose, 3); err != nil {
+		t.Error("close yesterday after settle", err)
+	}
+	simVmLock.Unlock()
+	profit := acct.updatePos(&si, OrderDirCover, 46100, 2)
+	if profit != si.CalcProfit(46200, 46100, -2) || pos.Short.Positions != 0 ||
+		pos.Positions != 3 {
+		t.Error("cover short leg", profit, *pos)
+	}
+	if legs := pos.legs(); len(legs) != 1 || legs[0].qty != 3 {
+		t.Error("legs after cover", legs)
+	}
+}
+
+func Test_account_checkHedgeT1(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil || !si.SettleT1 {
+		t.Skip("no T+1 sh601318", err)
+	}
+	acct := &account{pos: map[SymbolKey]*PositionType{}, hedging: true}
+	acct.updatePos(&si, OrderDirBuy, 50, 1000)
+	acct.updatePos(&si, OrderDirSell, 51, 500)
+	pos := acct.pos[si.fKey]
+	if pos.PosFreeze != 1000 {
+		t.Error("long leg bought today not frozen", *pos)
+	}
+	tests := []struct {
+		name string
+		dir  OrderDirT
+		qty  int
+		want error
+	}{
+		{"close bought today", OrderDirClose, 100, errNoAvailable},
+		{"cover short leg", OrderDirCover, 500, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			simVmLock.Lock()
+			got := acct.checkHedge(&si, tt.dir, tt.qty)
+			simVmLock.Unlock()
+			if got != tt.want {
+				t.Errorf("checkHedge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// frozen released by settle of next trading day
+	pos.PosFreeze = 0
+	simVmLock.Lock()
+	if err := acct.checkHedge(&si, OrderDirClose, 1000); err != nil {
+		t.Error("close after settle", err)
+	}
+	simVmLock.Unlock()
+}
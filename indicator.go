@@ -0,0 +1,414 @@
+package ats
+
+import "math"
+
+// indicators over Series, batch form return slice same length as input,
+// NaN for data before indicator ready. Incremental form update one value
+// per call in O(1), Update return current value, NaN for not ready
+
+// ringBuf ... fixed size window of float
+type ringBuf struct {
+	data []float64
+	pos  int
+	full bool
+}
+
+func newRingBuf(n int) ringBuf {
+	if n <= 0 {
+		n = 1
+	}
+	return ringBuf{data: make([]float64, n)}
+}
+
+// push ... push v, return value dropped out of window and true if full
+func (r *ringBuf) push(v float64) (old float64, ok bool) {
+	old, ok = r.data[r.pos], r.full
+	r.data[r.pos] = v
+	if r.pos++; r.pos == len(r.data) {
+		r.pos = 0
+		r.full = true
+	}
+	return
+}
+
+func (r *ringBuf) count() int {
+	if r.full {
+		return len(r.data)
+	}
+	return r.pos
+}
+
+// rollingExt ... rolling max or min of window via monotonic deque
+type rollingExt struct {
+	n     int
+	isMax bool
+	idx   []int
+	vals  []float64
+	cnt   int
+}
+
+func newRollingExt(n int, isMax bool) rollingExt {
+	if n <= 0 {
+		n = 1
+	}
+	return rollingExt{n: n, isMax: isMax}
+}
+
+// push ... push v, return max/min of window, amortized O(1)
+func (r *rollingExt) push(v float64) float64 {
+	for l := len(r.vals); l > 0; l = len(r.vals) {
+		if (r.isMax && r.vals[l-1] > v) || (!r.isMax && r.vals[l-1] < v) {
+			break
+		}
+		r.idx, r.vals = r.idx[:l-1], r.vals[:l-1]
+	}
+	r.idx, r.vals = append(r.idx, r.cnt), append(r.vals, v)
+	r.cnt++
+	if r.idx[0] <= r.cnt-1-r.n {
+		r.idx, r.vals = r.idx[1:], r.vals[1:]
+	}
+	return r.vals[0]
+}
+
+func batchSeries(s Series, update func(v float64) float64) []float64 {
+	res := make([]float64, s.Len())
+	for i := range res {
+		res[i] = update(s.DataAt(i))
+	}
+	return res
+}
+
+// SmaT ... incremental simple moving average
+type SmaT struct {
+	buf ringBuf
+	sum float64
+}
+
+// NewSma ... simple moving average of n periods
+func NewSma(n int) *SmaT {
+	return &SmaT{buf: newRingBuf(n)}
+}
+
+// Update ... add value, return SMA
+func (m *SmaT) Update(v float64) float64 {
+	old, full := m.buf.push(v)
+	m.sum += v
+	if full {
+		m.sum -= old
+	}
+	return m.Value()
+}
+
+// Value ... current SMA, NaN for not ready
+func (m *SmaT) Value() float64 {
+	if !m.buf.full {
+		return math.NaN()
+	}
+	return m.sum / float64(len(m.buf.data))
+}
+
+// SMA ... simple moving average of n periods
+func SMA(s Series, n int) []float64 {
+	return batchSeries(s, NewSma(n).Update)
+}
+
+// EmaT ... incremental exponential moving average, seeded by SMA
+type EmaT struct {
+	n     int
+	alpha float64
+	cnt   int
+	val   float64
+}
+
+// NewEma ... exponential moving average, alpha 2/(n+1)
+func NewEma(n int) *EmaT {
+	if n <= 0 {
+		n = 1
+	}
+	return &EmaT{n: n, alpha: 2.0 / float64(n+1)}
+}
+
+// newWilder ... Wilder smoothing, alpha 1/n
+func newWilder(n int) *EmaT {
+	if n <= 0 {
+		n = 1
+	}
+	return &EmaT{n: n, alpha: 1.0 / float64(n)}
+}
+
+// Update ... add value, return EMA
+func (m *EmaT) Update(v float64) float64 {
+	if m.cnt < m.n {
+		m.cnt++
+		m.val += (v - m.val) / float64(m.cnt)
+	} else {
+		m.val += m.alpha * (v - m.val)
+	}
+	return m.Value()
+}
+
+// Value ... current EMA, NaN for not ready
+func (m *EmaT) Value() float64 {
+	if m.cnt < m.n {
+		return math.NaN()
+	}
+	return m.val
+}
+
+// EMA ... exponential moving average of n periods
+func EMA(s Series, n int) []float64 {
+	return batchSeries(s, NewEma(n).Update)
+}
+
+// WmaT ... incremental linear weighted moving average, weight 1..n
+type WmaT struct {
+	buf  ringBuf
+	sum  float64
+	wsum float64
+}
+
+// NewWma ... weighted moving average of n periods
+func NewWma(n int) *WmaT {
+	return &WmaT{buf: newRingBuf(n)}
+}
+
+// Update ... add value, return WMA
+func (m *WmaT) Update(v float64) float64 {
+	n := float64(len(m.buf.data))
+	cnt := float64(m.buf.count())
+	old, full := m.buf.push(v)
+	if full {
+		m.wsum += n*v - m.sum
+		m.sum += v - old
+	} else {
+		m.wsum += (cnt + 1) * v
+		m.sum += v
+	}
+	return m.Value()
+}
+
+// Value ... current WMA, NaN for not ready
+func (m *WmaT) Value() float64 {
+	if !m.buf.full {
+		return math.NaN()
+	}
+	n := float64(len(m.buf.data))
+	return m.wsum / (n * (n + 1) / 2)
+}
+
+// WMA ... linear weighted moving average of n periods
+func WMA(s Series, n int) []float64 {
+	return batchSeries(s, NewWma(n).Update)
+}
+
+// RsiT ... incremental relative strength index, Wilder smoothing
+type RsiT struct {
+	gain, loss *EmaT
+	prev       float64
+	cnt        int
+}
+
+// NewRsi ... RSI of n periods
+func NewRsi(n int) *RsiT {
+	return &RsiT{gain: newWilder(n), loss: newWilder(n)}
+}
+
+// Update ... add value, return RSI 0..100
+func (m *RsiT) Update(v float64) float64 {
+	if m.cnt++; m.cnt > 1 {
+		d := v - m.prev
+		m.gain.Update(math.Max(d, 0))
+		m.loss.Update(math.Max(-d, 0))
+	}
+	m.prev = v
+	return m.Value()
+}
+
+// Value ... current RSI, NaN for not ready
+func (m *RsiT) Value() float64 {
+	g, l := m.gain.Value(), m.loss.Value()
+	if math.IsNaN(g) {
+		return g
+	}
+	if g+l == 0 {
+		return 50
+	}
+	return 100 * g / (g + l)
+}
+
+// RSI ... relative strength index of n periods
+func RSI(s Series, n int) []float64 {
+	return batchSeries(s, NewRsi(n).Update)
+}
+
+// MacdT ... incremental MACD
+type MacdT struct {
+	fast, slow, signal *EmaT
+}
+
+// NewMacd ... MACD with fast/slow EMA periods and signal periods
+func NewMacd(fast, slow, signal int) *MacdT {
+	return &MacdT{fast: NewEma(fast), slow: NewEma(slow), signal: NewEma(signal)}
+}
+
+// Update ... add value, return MACD line, signal line and histogram
+func (m *MacdT) Update(v float64) (macd, signal, hist float64) {
+	f, s := m.fast.Update(v), m.slow.Update(v)
+	if math.IsNaN(f) || math.IsNaN(s) {
+		nan := math.NaN()
+		return nan, nan, nan
+	}
+	macd = f - s
+	signal = m.signal.Update(macd)
+	hist = macd - signal
+	return
+}
+
+// MACD ... MACD line, signal line and histogram
+func MACD(s Series, fast, slow, signal int) (macd, sig, hist []float64) {
+	m := NewMacd(fast, slow, signal)
+	cnt := s.Len()
+	macd, sig, hist = make([]float64, cnt), make([]float64, cnt), make([]float64, cnt)
+	for i := 0; i < cnt; i++ {
+		macd[i], sig[i], hist[i] = m.Update(s.DataAt(i))
+	}
+	return
+}
+
+// StdDevT ... incremental rolling population standard deviation
+type StdDevT struct {
+	buf   ringBuf
+	sum   float64
+	sumSq float64
+}
+
+// NewStdDev ... rolling standard deviation of n periods
+func NewStdDev(n int) *StdDevT {
+	return &StdDevT{buf: newRingBuf(n)}
+}
+
+// Update ... add value, return standard deviation
+func (m *StdDevT) Update(v float64) float64 {
+	old, full := m.buf.push(v)
+	m.sum += v
+	m.sumSq += v * v
+	if full {
+		m.sum -= old
+		m.sumSq -= old * old
+	}
+	return m.Value()
+}
+
+// Mean ... mean of window, NaN for not ready
+func (m *StdDevT) Mean() float64 {
+	if !m.buf.full {
+		return math.NaN()
+	}
+	return m.sum / float64(len(m.buf.data))
+}
+
+// Value ... current standard deviation, NaN for not ready
+func (m *StdDevT) Value() float64 {
+	if !m.buf.full {
+		return math.NaN()
+	}
+	n := float64(len(m.buf.data))
+	mean := m.sum / n
+	if vv := m.sumSq/n - mean*mean; vv > 0 {
+		return math.Sqrt(vv)
+	}
+	return 0
+}
+
+// StdDev ... rolling standard deviation of n periods
+func StdDev(s Series, n int) []float64 {
+	return batchSeries(s, NewStdDev(n).Update)
+}
+
+// BollT ... incremental Bollinger Bands
+type BollT struct {
+	std *StdDevT
+	k   float64
+}
+
+// NewBoll ... Bollinger Bands of n periods, k times standard deviation
+func NewBoll(n int, k float64) *BollT {
+	return &BollT{std: NewStdDev(n), k: k}
+}
+
+// Update ... add value, return middle, upper and lower bands
+func (m *BollT) Update(v float64) (mid, upper, lower float64) {
+	sd := m.std.Update(v)
+	mid = m.std.Mean()
+	return mid, mid + m.k*sd, mid - m.k*sd
+}
+
+// Bollinger ... Bollinger Bands of n periods, k times standard deviation
+func Bollinger(s Series, n int, k float64) (mid, upper, lower []float64) {
+	m := NewBoll(n, k)
+	cnt := s.Len()
+	mid, upper, lower = make([]float64, cnt), make([]float64, cnt), make([]float64, cnt)
+	for i := 0; i < cnt; i++ {
+		mid[i], upper[i], lower[i] = m.Update(s.DataAt(i))
+	}
+	return
+}
+
+// CorrT ... incremental rolling Pearson correlation of two series
+type CorrT struct {
+	bx, by                ringBuf
+	sx, sy, sxx, syy, sxy float64
+}
+
+// NewCorr ... rolling correlation of n periods
+func NewCorr(n int) *CorrT {
+	return &CorrT{bx: newRingBuf(n), by: newRingBuf(n)}
+}
+
+// Update ... add pair of values, return correlation -1..1
+func (m *CorrT) Update(x, y float64) float64 {
+	ox, full := m.bx.push(x)
+	oy, _ := m.by.push(y)
+	m.sx += x
+	m.sy += y
+	m.sxx += x * x
+	m.syy += y * y
+	m.sxy += x * y
+	if full {
+		m.sx -= ox
+		m.sy -= oy
+		m.sxx -= ox * ox
+		m.syy -= oy * oy
+		m.sxy -= ox * oy
+	}
+	return m.Value()
+}
+
+// Value ... current correlation, NaN for not ready or constant series
+func (m *CorrT) Value() float64 {
+	if !m.bx.full {
+		return math.NaN()
+	}
+	n := float64(len(m.bx.data))
+	cov := m.sxy - m.sx*m.sy/n
+	vx := m.sxx - m.sx*m.sx/n
+	vy := m.syy - m.sy*m.sy/n
+	if vx <= 0 || vy <= 0 {
+		return math.NaN()
+	}
+	return cov / math.Sqrt(vx*vy)
+}
+
+// Correlation ... rolling correlation of n periods, x and y same length
+func Correlation(x, y Series, n int) []float64 {
+	m := NewCorr(n)
+	cnt := x.Len()
+	if y.Len() < cnt {
+		cnt = y.Len()
+	}
+	res := make([]float64, cnt)
+	for i := 0; i < cnt; i++ {
+		res[i] = m.Update(x.DataAt(i), y.DataAt(i))
+	}
+	return res
+}
@@ -0,0 +1,269 @@
+package ats
+
+import "math"
+
+// indicators over OHLCV of Bars, in package ats for VWAP reset by trading
+// day of symbol session, unexported barBaseTime and symKey of Bars
+
+func batchBars(b *Bars, update func(i int) float64) []float64 {
+	res := make([]float64, len(b.Date))
+	for i := range res {
+		res[i] = update(i)
+	}
+	return res
+}
+
+// trueRange ... true range with previous close, NaN for no previous
+func trueRange(h, l, prevC float64) float64 {
+	if math.IsNaN(prevC) {
+		return h - l
+	}
+	return math.Max(h, prevC) - math.Min(l, prevC)
+}
+
+// AtrT ... incremental average true range, Wilder smoothing
+type AtrT struct {
+	ma    *EmaT
+	prevC float64
+}
+
+// NewAtr ... ATR of n periods
+func NewAtr(n int) *AtrT {
+	return &AtrT{ma: newWilder(n), prevC: math.NaN()}
+}
+
+// Update ... add bar, return ATR
+func (m *AtrT) Update(h, l, c float64) float64 {
+	tr := trueRange(h, l, m.prevC)
+	m.prevC = c
+	return m.ma.Update(tr)
+}
+
+// Value ... current ATR, NaN for not ready
+func (m *AtrT) Value() float64 {
+	return m.ma.Value()
+}
+
+// ATR ... average true range of n periods
+func ATR(b *Bars, n int) []float64 {
+	m := NewAtr(n)
+	return batchBars(b, func(i int) float64 {
+		return m.Update(b.High[i], b.Low[i], b.Close[i])
+	})
+}
+
+// StochT ... incremental stochastic oscillator
+type StochT struct {
+	hh, ll rollingExt
+	cnt    int
+	n      int
+	d      *SmaT
+}
+
+// NewStoch ... stochastic %K of n periods, %D SMA of dN periods
+func NewStoch(n, dN int) *StochT {
+	return &StochT{hh: newRollingExt(n, true), ll: newRollingExt(n, false),
+		n: n, d: NewSma(dN)}
+}
+
+// Update ... add bar, return %K and %D
+func (m *StochT) Update(h, l, c float64) (k, d float64) {
+	hh, ll := m.hh.push(h), m.ll.push(l)
+	if m.cnt++; m.cnt < m.n {
+		return math.NaN(), math.NaN()
+	}
+	k = 50
+	if hh > ll {
+		k = 100 * (c - ll) / (hh - ll)
+	}
+	d = m.d.Update(k)
+	return
+}
+
+// Stochastic ... stochastic %K of n periods, %D SMA of dN periods
+func Stochastic(b *Bars, n, dN int) (k, d []float64) {
+	m := NewStoch(n, dN)
+	cnt := len(b.Date)
+	k, d = make([]float64, cnt), make([]float64, cnt)
+	for i := 0; i < cnt; i++ {
+		k[i], d[i] = m.Update(b.High[i], b.Low[i], b.Close[i])
+	}
+	return
+}
+
+// AdxT ... incremental average directional index, Wilder smoothing
+//	PlusDI/MinusDI	directional indicators of last update
+type AdxT struct {
+	PlusDI  float64
+	MinusDI float64
+	tr      *EmaT
+	pDM     *EmaT
+	mDM     *EmaT
+	adx     *EmaT
+	prevH   float64
+	prevL   float64
+	prevC   float64
+	cnt     int
+}
+
+// NewAdx ... ADX of n periods
+func NewAdx(n int) *AdxT {
+	return &AdxT{tr: newWilder(n), pDM: newWilder(n), mDM: newWilder(n),
+		adx: newWilder(n), PlusDI: math.NaN(), MinusDI: math.NaN()}
+}
+
+// Update ... add bar, return ADX
+func (m *AdxT) Update(h, l, c float64) float64 {
+	defer func() {
+		m.prevH, m.prevL, m.prevC = h, l, c
+	}()
+	if m.cnt++; m.cnt == 1 {
+		return math.NaN()
+	}
+	up, down := h-m.prevH, m.prevL-l
+	var pDM, mDM float64
+	if up > down && up > 0 {
+		pDM = up
+	}
+	if down > up && down > 0 {
+		mDM = down
+	}
+	tr := m.tr.Update(trueRange(h, l, m.prevC))
+	p, n := m.pDM.Update(pDM), m.mDM.Update(mDM)
+	if math.IsNaN(tr) {
+		return math.NaN()
+	}
+	if tr == 0 {
+		m.PlusDI, m.MinusDI = 0, 0
+	} else {
+		m.PlusDI, m.MinusDI = 100*p/tr, 100*n/tr
+	}
+	dx := 0.0
+	if sum := m.PlusDI + m.MinusDI; sum > 0 {
+		dx = 100 * math.Abs(m.PlusDI-m.MinusDI) / sum
+	}
+	return m.adx.Update(dx)
+}
+
+// Value ... current ADX, NaN for not ready
+func (m *AdxT) Value() float64 {
+	return m.adx.Value()
+}
+
+// ADX ... average directional index of n periods
+func ADX(b *Bars, n int) []float64 {
+	m := NewAdx(n)
+	return batchBars(b, func(i int) float64 {
+		return m.Update(b.High[i], b.Low[i], b.Close[i])
+	})
+}
+
+// ObvT ... incremental on balance volume
+type ObvT struct {
+	val   float64
+	prevC float64
+	cnt   int
+}
+
+// NewObv ... on balance volume
+func NewObv() *ObvT {
+	return &ObvT{}
+}
+
+// Update ... add bar close and volume, return OBV
+func (m *ObvT) Update(c, vol float64) float64 {
+	if m.cnt++; m.cnt > 1 {
+		if c > m.prevC {
+			m.val += vol
+		} else if c < m.prevC {
+			m.val -= vol
+		}
+	}
+	m.prevC = c
+	return m.val
+}
+
+// OBV ... on balance volume
+func OBV(b *Bars) []float64 {
+	m := NewObv()
+	return batchBars(b, func(i int) float64 {
+		return m.Update(b.Close[i], b.Volume[i])
+	})
+}
+
+// VwapT ... incremental volume weighted average price of typical price
+type VwapT struct {
+	pv  float64
+	vol float64
+}
+
+// NewVwap ... VWAP, call Reset on new trading day
+func NewVwap() *VwapT {
+	return &VwapT{}
+}
+
+// Reset ... restart VWAP accumulation
+func (m *VwapT) Reset() {
+	m.pv, m.vol = 0, 0
+}
+
+// Update ... add bar, return VWAP, NaN for no volume
+func (m *VwapT) Update(h, l, c, vol float64) float64 {
+	m.pv += (h + l + c) / 3 * vol
+	m.vol += vol
+	return m.Value()
+}
+
+// Value ... current VWAP, NaN for no volume
+func (m *VwapT) Value() float64 {
+	if m.vol == 0 {
+		return math.NaN()
+	}
+	return m.pv / m.vol
+}
+
+// VWAP ... volume weighted average price, reset on every trading day
+func VWAP(b *Bars) []float64 {
+	m := NewVwap()
+	var day int64
+	return batchBars(b, func(i int) float64 {
+		if d := barBaseTime(b.symKey, b.Date[i].Unix(), Daily); d != day {
+			day = d
+			m.Reset()
+		}
+		return m.Update(b.High[i], b.Low[i], b.Close[i], b.Volume[i])
+	})
+}
+
+// DonchianT ... incremental Donchian channel
+type DonchianT struct {
+	hh, ll rollingExt
+	cnt    int
+	n      int
+}
+
+// NewDonchian ... Donchian channel of n periods
+func NewDonchian(n int) *DonchianT {
+	return &DonchianT{hh: newRollingExt(n, true), ll: newRollingExt(n, false), n: n}
+}
+
+// Update ... add bar, return upper, middle and lower of channel
+func (m *DonchianT) Update(h, l float64) (upper, mid, lower float64) {
+	upper, lower = m.hh.push(h), m.ll.push(l)
+	if m.cnt++; m.cnt < m.n {
+		nan := math.NaN()
+		return nan, nan, nan
+	}
+	return upper, (upper + lower) / 2, lower
+}
+
+// Donchian ... Donchian channel of n periods
+func Donchian(b *Bars, n int) (upper, mid, lower []float64) {
+	m := NewDonchian(n)
+	cnt := len(b.Date)
+	upper, mid, lower = make([]float64, cnt), make([]float64, cnt), make([]float64, cnt)
+	for i := 0; i < cnt; i++ {
+		upper[i], mid[i], lower[i] = m.Update(b.High[i], b.Low[i])
+	}
+	return
+}
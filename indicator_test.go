@@ -0,0 +1,147 @@
+package ats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func naiveWindow(s []float64, i, n int, fn func(w []float64) float64) float64 {
+	if i+1 < n {
+		return math.NaN()
+	}
+	return fn(s[i+1-n : i+1])
+}
+
+func sameFloat(a, b float64) bool {
+	if math.IsNaN(a) || math.IsNaN(b) {
+		return math.IsNaN(a) && math.IsNaN(b)
+	}
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestMovingAverage(t *testing.T) {
+	s := FloatSeries{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	tests := []struct {
+		name string
+		res  []float64
+		want []float64
+	}{
+		{"SMA", SMA(s, 3), []float64{math.NaN(), math.NaN(), 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"EMA", EMA(s, 3), []float64{math.NaN(), math.NaN(), 2, 3, 4, 5, 6, 7, 8, 9}},
+		{"WMA", WMA(s, 3), []float64{math.NaN(), math.NaN(), 14.0 / 6, 20.0 / 6,
+			26.0 / 6, 32.0 / 6, 38.0 / 6, 44.0 / 6, 50.0 / 6, 56.0 / 6}},
+		{"RSI", RSI(s, 3), []float64{math.NaN(), math.NaN(), math.NaN(), 100, 100,
+			100, 100, 100, 100, 100}},
+		{"StdDev", StdDev(FloatSeries{2, 4, 4, 4, 5, 5, 7, 9}, 8), []float64{
+			math.NaN(), math.NaN(), math.NaN(), math.NaN(), math.NaN(),
+			math.NaN(), math.NaN(), 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.want {
+				if !sameFloat(tt.res[i], tt.want[i]) {
+					t.Errorf("%s[%d] = %g, want %g", tt.name, i, tt.res[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRollingIndicators(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	x := make([]float64, 500)
+	y := make([]float64, 500)
+	for i := range x {
+		x[i] = 100 + rnd.NormFloat64()*5
+		y[i] = 2*x[i] + 1
+	}
+	n := 20
+	sma, sd := SMA(FloatSeries(x), n), StdDev(FloatSeries(x), n)
+	corr := Correlation(FloatSeries(x), FloatSeries(y), n)
+	hh, ll := newRollingExt(n, true), newRollingExt(n, false)
+	for i := range x {
+		mean := naiveWindow(x, i, n, func(w []float64) float64 {
+			var sum float64
+			for _, v := range w {
+				sum += v
+			}
+			return sum / float64(len(w))
+		})
+		dev := naiveWindow(x, i, n, func(w []float64) float64 {
+			var sum float64
+			for _, v := range w {
+				sum += (v - mean) * (v - mean)
+			}
+			return math.Sqrt(sum / float64(len(w)))
+		})
+		if !sameFloat(sma[i], mean) || math.Abs(sd[i]-dev) > 1e-6 {
+			t.Errorf("%d: SMA %g/%g, StdDev %g/%g", i, sma[i], mean, sd[i], dev)
+		}
+		if i >= n-1 && math.Abs(corr[i]-1) > 1e-6 {
+			t.Errorf("%d: Correlation %g, want 1", i, corr[i])
+		}
+		start := i + 1 - n
+		if start < 0 {
+			start = 0
+		}
+		mx, mn := x[start], x[start]
+		for _, v := range x[start : i+1] {
+			mx, mn = math.Max(mx, v), math.Min(mn, v)
+		}
+		if h, l := hh.push(x[i]), ll.push(x[i]); h != mx || l != mn {
+			t.Errorf("%d: rolling max/min %g/%g, want %g/%g", i, h, l, mx, mn)
+		}
+	}
+	macd, sig, hist := MACD(FloatSeries(x), 12, 26, 9)
+	if !math.IsNaN(macd[24]) || math.IsNaN(sig[40]) || !sameFloat(hist[40], macd[40]-sig[40]) {
+		t.Error("MACD diff", macd[24], sig[40], hist[40])
+	}
+	mid, upper, lower := Bollinger(FloatSeries(x), n, 2)
+	if !sameFloat(mid[100], sma[100]) || !sameFloat(upper[100]-mid[100], 2*sd[100]) ||
+		!sameFloat(mid[100]-lower[100], 2*sd[100]) {
+		t.Error("Bollinger diff", mid[100], upper[100], lower[100])
+	}
+}
+
+func TestBarsIndicators(t *testing.T) {
+	// uptrend bars, range 2, close at high
+	b := &Bars{period: Daily}
+	for i := 0; i < 30; i++ {
+		c := 10 + float64(i)
+		b.Date = append(b.Date, timeT64FromInt64(int64(i)*86400))
+		b.Open = append(b.Open, c-1)
+		b.High = append(b.High, c)
+		b.Low = append(b.Low, c-2)
+		b.Close = append(b.Close, c)
+		b.Volume = append(b.Volume, 100)
+	}
+	if atr := ATR(b, 5); !math.IsNaN(atr[3]) || !sameFloat(atr[10], 2) {
+		t.Error("ATR diff", atr)
+	}
+	if k, d := Stochastic(b, 5, 3); !math.IsNaN(k[3]) || !sameFloat(k[10], 100) ||
+		!sameFloat(d[10], 100) {
+		t.Error("Stochastic diff", k, d)
+	}
+	adx := NewAdx(5)
+	for i := range b.Date {
+		adx.Update(b.High[i], b.Low[i], b.Close[i])
+	}
+	if adx.PlusDI <= adx.MinusDI || !sameFloat(adx.Value(), 100) {
+		t.Error("ADX diff", adx.PlusDI, adx.MinusDI, adx.Value())
+	}
+	if res := ADX(b, 5); !sameFloat(res[29], adx.Value()) {
+		t.Error("ADX batch diff", res[29], adx.Value())
+	}
+	if obv := OBV(b); obv[0] != 0 || obv[29] != 2900 {
+		t.Error("OBV diff", obv[0], obv[29])
+	}
+	// daily bars, VWAP reset every bar
+	if vwap := VWAP(b); !sameFloat(vwap[5], (b.High[5]+b.Low[5]+b.Close[5])/3) {
+		t.Error("VWAP diff", vwap[5])
+	}
+	if u, m, l := Donchian(b, 10); !math.IsNaN(u[8]) || u[20] != 30 || l[20] != 19 ||
+		m[20] != 24.5 {
+		t.Error("Donchian diff", u[20], m[20], l[20])
+	}
+}
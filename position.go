@@ -0,0 +1,166 @@
+package ats
+
+import (
+	"time"
+)
+
+// tripKey ... open round trip of symbol, side 1 for long, -1 for short
+type tripKey struct {
+	fKey SymbolKey
+	side int
+}
+
+// tradeOpen ... entry of qty at price, round trip of side begin from flat
+func (acct *account) tradeOpen(si *SymbolInfo, side, qty int, price float64) {
+	if acct.openTrips == nil {
+		acct.openTrips = map[tripKey]*TradeType{}
+	}
+	key := tripKey{si.fKey, side}
+	tr, ok := acct.openTrips[key]
+	if !ok {
+		dir := OrderDirBuy
+		if side < 0 {
+			dir = OrderDirSell
+		}
+		tr = &TradeType{Symbol: si.Ticker, Dir: dir, EntryTime: simCurrent}
+		acct.openTrips[key] = tr
+	}
+	tr.EntryPrice = (tr.EntryPrice*float64(tr.Qty) + price*float64(qty)) /
+		float64(tr.Qty+qty)
+	tr.Qty += qty
+}
+
+// tradeClose ... exit of qty at price with profit, round trip done while
+//		side flat
+func (acct *account) tradeClose(si *SymbolInfo, side, qty int, price, profit float64, flat bool) {
+	key := tripKey{si.fKey, side}
+	tr, ok := acct.openTrips[key]
+	if !ok {
+		return
+	}
+	tr.ExitPrice = (tr.ExitPrice*float64(tr.exitQty) + price*float64(qty)) /
+		float64(tr.exitQty+qty)
+	tr.exitQty += qty
+	tr.Profit += profit
+	if flat {
+		tr.ExitTime = simCurrent
+		acct.roundTrips = append(acct.roundTrips, *tr)
+		delete(acct.openTrips, key)
+	}
+}
+
+// addFee ... fee of position side charged by broker, negative for credit
+func (acct *account) addFee(si *SymbolInfo, side int, fee float64) {
+	if pos, ok := acct.pos[si.fKey]; ok {
+		pos.Fees += fee
+	}
+	if tr, ok := acct.openTrips[tripKey{si.fKey, side}]; ok {
+		tr.Fees += fee
+	}
+}
+
+// markPos ... unrealized P&L of position at price, excursions of position
+//		and open round trips updated
+func (acct *account) markPos(si *SymbolInfo, pos *PositionType, price float64) {
+	var res float64
+	for _, leg := range pos.legs() {
+		amt, _ := convertCurrency(si.CalcProfit(leg.avgPrice, price, leg.qty),
+			si.Currency(), simCurrency)
+		res += amt
+		side := 1
+		if leg.qty < 0 {
+			side = -1
+		}
+		if tr, ok := acct.openTrips[tripKey{si.fKey, side}]; ok {
+			if amt > tr.MFE {
+				tr.MFE = amt
+			}
+			if amt < tr.MAE {
+				tr.MAE = amt
+			}
+		}
+	}
+	pos.Unrealized = res
+	if res > pos.MFE {
+		pos.MFE = res
+	}
+	if res < pos.MAE {
+		pos.MAE = res
+	}
+}
+
+// simMarkPositions ... mark positions of symbol for all accounts at price
+//		write lock only while some position to mark
+func simMarkPositions(si *SymbolInfo, price float64) {
+	if price <= 0 {
+		return
+	}
+	needMark := func(acct *account) (*PositionType, bool) {
+		pos, ok := acct.pos[si.fKey]
+		if !ok || pos.markPx == price || len(pos.legs()) == 0 {
+			return nil, false
+		}
+		return pos, true
+	}
+	acctLock.RLock()
+	changed := false
+	for _, acct := range simAccounts {
+		if _, changed = needMark(acct); changed {
+			break
+		}
+	}
+	acctLock.RUnlock()
+	if !changed {
+		return
+	}
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	for _, acct := range simAccounts {
+		if pos, ok := needMark(acct); ok {
+			acct.markPos(si, pos, price)
+			pos.markPx = price
+		}
+	}
+}
+
+// Holding ... holding period of round trip
+func (t *TradeType) Holding() time.Duration {
+	return time.Duration(t.ExitTime-t.EntryTime) * time.Millisecond
+}
+
+// TradeStat ... statistics of round trips of symbol, Profit net of fees
+type TradeStat struct {
+	Trades     int
+	Wins       int
+	Profit     float64
+	AvgMFE     float64
+	AvgMAE     float64
+	AvgHolding time.Duration
+}
+
+// TradeStats ... statistics of round trips per symbol
+func TradeStats(trades []TradeType) map[string]TradeStat {
+	res := map[string]TradeStat{}
+	var holding = map[string]time.Duration{}
+	for i := range trades {
+		tr := &trades[i]
+		st := res[tr.Symbol]
+		st.Trades++
+		if tr.Profit-tr.Fees > 0 {
+			st.Wins++
+		}
+		st.Profit += tr.Profit - tr.Fees
+		st.AvgMFE += tr.MFE
+		st.AvgMAE += tr.MAE
+		holding[tr.Symbol] += tr.Holding()
+		res[tr.Symbol] = st
+	}
+	for sym, st := range res {
+		n := float64(st.Trades)
+		st.AvgMFE /= n
+		st.AvgMAE /= n
+		st.AvgHolding = holding[sym] / time.Duration(st.Trades)
+		res[sym] = st
+	}
+	return res
+}
@@ -0,0 +1,145 @@
+package ats
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_account_roundTrips(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("cu2001")
+	si, err := GetSymbolInfo("cu2001")
+	if err != nil {
+		t.Skip("no cu2001", err)
+	}
+	curT := simCurrent
+	defer func() { simCurrent = curT }()
+	acct := &account{pos: map[SymbolKey]*PositionType{}}
+	simCurrent = 1000
+	acct.updatePos(&si, OrderDirBuy, 46000, 2)
+	acct.updatePos(&si, OrderDirBuy, 46100, 2)
+	pos := acct.pos[si.fKey]
+	if pos.OpenTime != 1000 || round(pos.AvgPrice) != 46050 {
+		t.Error("open position diff", *pos)
+	}
+	acct.markPos(&si, pos, 46200)
+	acct.markPos(&si, pos, 45900)
+	if pos.Unrealized != si.CalcProfit(46050, 45900, 4) ||
+		pos.MFE != si.CalcProfit(46050, 46200, 4) || pos.MAE != pos.Unrealized {
+		t.Error("excursions diff", *pos)
+	}
+	acct.addFee(&si, 1, 12)
+	simCurrent = 61000
+	// reversed to short, round trip of long done
+	profit := acct.updatePos(&si, OrderDirSell, 46000, 5)
+	if profit != si.CalcProfit(46050, 46000, 4) || pos.Positions != -1 ||
+		pos.AvgPrice != 46000 || pos.OpenTime != 1000 {
+		t.Error("reversed position diff", profit, *pos)
+	}
+	if pos.Realized != profit || pos.Fees != 12 {
+		t.Error("realized/fees diff", *pos)
+	}
+	acct.updatePos(&si, OrderDirCover, 45800, 1)
+	if pos.Positions != 0 || pos.Unrealized != 0 {
+		t.Error("flat position diff", *pos)
+	}
+	tests := []struct {
+		name  string
+		dir   OrderDirT
+		qty   int
+		entry float64
+		exit  float64
+		mfe   float64
+		fees  float64
+	}{
+		{"long", OrderDirBuy, 4, 46050, 46000, si.CalcProfit(46050, 46200, 4), 12},
+		{"short", OrderDirSell, 1, 46000, 45800, 0, 0},
+	}
+	if len(acct.roundTrips) != len(tests) {
+		t.Fatal("roundTrips diff", acct.roundTrips)
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := acct.roundTrips[i]
+			if tr.Dir != tt.dir || tr.Qty != tt.qty || round(tr.EntryPrice) != tt.entry ||
+				round(tr.ExitPrice) != tt.exit || tr.MFE != tt.mfe || tr.Fees != tt.fees {
+				t.Errorf("round trip = %v, want %v", tr, tt)
+			}
+		})
+	}
+	st := TradeStats(acct.roundTrips)["cu2001"]
+	if st.Trades != 2 || st.Wins != 1 || st.AvgHolding != time.Minute/2 {
+		t.Error("TradeStats diff", st)
+	}
+}
+
+func Test_account_updateNet(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("cu2001")
+	si, err := GetSymbolInfo("cu2001")
+	if err != nil {
+		t.Skip("no cu2001", err)
+	}
+	tests := []struct {
+		name   string
+		dir    OrderDirT
+		qty    int
+		price  float64
+		pos    int
+		avg    float64
+		profit float64
+	}{
+		{"open long", OrderDirBuy, 2, 46000, 2, 46000, 0},
+		{"partial close", OrderDirSell, 1, 46100, 1, 46000, si.CalcProfit(46000, 46100, 1)},
+		// only 1 closed at cost, remain 2 opened short at fill price
+		{"reverse to short", OrderDirSell, 3, 46200, -2, 46200, si.CalcProfit(46000, 46200, 1)},
+		{"reverse to long", OrderDirBuy, 5, 46300, 3, 46300, si.CalcProfit(46200, 46300, -2)},
+		{"flat", OrderDirSell, 3, 46250, 0, 46300, si.CalcProfit(46300, 46250, 3)},
+	}
+	acct := &account{pos: map[SymbolKey]*PositionType{}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profit := acct.updatePos(&si, tt.dir, tt.price, tt.qty)
+			pos := acct.pos[si.fKey]
+			if pos.Positions != tt.pos || round(pos.AvgPrice) != tt.avg ||
+				round(profit) != round(tt.profit) {
+				t.Errorf("updateNet() = %v %d/%v, want %v %d/%v", profit,
+					pos.Positions, pos.AvgPrice, tt.profit, tt.pos, tt.avg)
+			}
+		})
+	}
+}
+
+func Test_simMarkPositions(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("cu2001")
+	si, err := GetSymbolInfo("cu2001")
+	if err != nil {
+		t.Skip("no cu2001", err)
+	}
+	_, acct, release := newTestAccount(-6)
+	defer release()
+	// no position, nothing marked
+	simMarkPositions(&si, 46000)
+	if _, ok := acct.pos[si.fKey]; ok {
+		t.Error("position created by mark")
+	}
+	acct.updatePos(&si, OrderDirBuy, 46000, 2)
+	pos := acct.pos[si.fKey]
+	simMarkPositions(&si, 46100)
+	if pos.Unrealized != si.CalcProfit(46000, 46100, 2) || pos.markPx != 46100 {
+		t.Error("mark diff", *pos)
+	}
+	// same price not marked again
+	pos.Unrealized = 0
+	simMarkPositions(&si, 46100)
+	if pos.Unrealized != 0 {
+		t.Error("marked at unchanged price", *pos)
+	}
+	// position changed, marked at same price
+	acct.updatePos(&si, OrderDirBuy, 46100, 1)
+	simMarkPositions(&si, 46100)
+	if pos.Unrealized == 0 || pos.Unrealized != si.CalcProfit(pos.AvgPrice, 46100, 3) {
+		t.Error("mark after fill diff", *pos)
+	}
+}
@@ -1,7 +1,14 @@
 package ats
 
-// Quotes ... No Level2 quotes yet
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Quotes ... Level1 quotes, Level2 depth via DepthBook
+//	Seq		sequence number of QuoteSnap, increased by every update
 type Quotes struct {
+	Seq        uint64
 	UpdateTime DateTimeMs
 	TodayOpen  float64
 	TodayHigh  float64
@@ -16,21 +23,80 @@ type Quotes struct {
 	AskVol     int64
 }
 
+// QuoteSnap ... versioned quotes snapshot
+//	broker update via atomic pointer swap, reader always get consistent
+//	Quotes, missed updates could be detected by Seq
+type QuoteSnap struct {
+	lock sync.Mutex
+	seq  uint64
+	val  atomic.Value
+}
+
+// Load ... current quotes snapshot, zero Quotes before first update
+func (q *QuoteSnap) Load() Quotes {
+	if p, ok := q.val.Load().(*Quotes); ok {
+		return *p
+	}
+	return Quotes{}
+}
+
+// Seq ... sequence number of current snapshot
+func (q *QuoteSnap) Seq() uint64 {
+	return atomic.LoadUint64(&q.seq)
+}
+
+// Store ... publish qq as new snapshot, return sequence number
+func (q *QuoteSnap) Store(qq Quotes) uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.publish(&qq)
+}
+
+// Update ... modify copy of current snapshot with fn then publish
+func (q *QuoteSnap) Update(fn func(qq *Quotes)) uint64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	qq := q.Load()
+	fn(&qq)
+	return q.publish(&qq)
+}
+
+// dayRotate ... reset quotes for new trading day, keep Pclose
+func (q *QuoteSnap) dayRotate(curT DateTimeMs) uint64 {
+	return q.Update(func(qq *Quotes) {
+		*qq = Quotes{Pclose: qq.Last, UpdateTime: curT}
+	})
+}
+
+func (q *QuoteSnap) publish(qq *Quotes) uint64 {
+	qq.Seq = q.seq + 1
+	q.val.Store(qq)
+	atomic.StoreUint64(&q.seq, qq.Seq)
+	return qq.Seq
+}
+
 // QuoteSubT ... subscribe quote struct
+//	QuotesPtr	quotes snapshot updated by broker
+//	DepthPtr	depth snapshot updated by broker, nil for no Level2 depth
 type QuoteSubT struct {
 	Symbol    string
-	QuotesPtr *Quotes
+	QuotesPtr *QuoteSnap
+	DepthPtr  *DepthSnap
 }
 
 // QuoteEvent used by broker to notify quote/tick/bar update
-// EventID    0   for quote/tick update, else bar period
+// EventID    0   for quote/tick update, EventDepth for depth update,
+//		-1 for end of feed, else bar period
 type QuoteEvent struct {
 	Symbol  string
 	EventID int
 }
 
+// EventDepth ... EventID of Level2 depth update
+const EventDepth = 1
+
 // no export func for update quotes
-// Feed should update quote using buffer pointed by QuoteSubType
+// Feed should update quote via QuoteSnap pointed by QuoteSubType
 /*
 func updateLastSales(sym string, last float64, vol float64) {
 	if si, err := GetSymbolInfo(sym); err != nil {
@@ -0,0 +1,47 @@
+package ats
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestQuoteSnap(t *testing.T) {
+	var qs QuoteSnap
+	if q := qs.Load(); q.Seq != 0 || qs.Seq() != 0 {
+		t.Error("initial snapshot diff", q)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		var lastSeq uint64
+		for lastSeq < 1000 {
+			q := qs.Load()
+			if q.Seq < lastSeq {
+				t.Error("seq decreased", q.Seq, lastSeq)
+				return
+			}
+			if q.Seq > 0 && (q.Ask != q.Bid+1 || q.Last != q.Bid ||
+				q.Volume != int64(q.Seq)) {
+				t.Error("inconsistent snapshot", q)
+				return
+			}
+			lastSeq = q.Seq
+		}
+	}()
+	for i := 1; i <= 1000; i++ {
+		qs.Update(func(q *Quotes) {
+			q.Bid = float64(i)
+			q.Ask = q.Bid + 1
+			q.Last = q.Bid
+			q.Volume++
+		})
+	}
+	wg.Wait()
+	if seq := qs.dayRotate(100); seq != 1001 {
+		t.Errorf("dayRotate seq %d, want 1001", seq)
+	}
+	if q := qs.Load(); q.Pclose != 1000 || q.Volume != 0 || q.Seq != qs.Seq() {
+		t.Error("dayRotate diff", q)
+	}
+}
@@ -0,0 +1,229 @@
+package ats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/kjx98/golib/julian"
+)
+
+// recorded quotes buffered per symbol before append to daily file
+const recBlockTicks = 4096
+
+// quoteRecord ... one recorded update, full Quotes with millisecond
+//	UpdateTime and depth levels, Bids/Asks nil for no depth
+type quoteRecord struct {
+	Quotes
+	Bids []DepthLevel
+	Asks []DepthLevel
+}
+
+// quoteRec ... record state of one symbol
+//	depth recorded with subscribed DepthSnap
+type quoteRec struct {
+	si    *SymbolInfo
+	quote *QuoteSnap
+	depth *DepthSnap
+	day   julian.JulianDay
+	last  quoteRecord
+	recs  []quoteRecord
+}
+
+// QuoteRecorder ... record quote updates to daily files
+//	file path: dir/Ticker/YYYY/Ticker-YYYYMMDD.qrec
+//	each record as little endian Quotes, uint16 number of bid/ask levels
+//	followed by depth levels
+type QuoteRecorder struct {
+	dir  string
+	lock sync.Mutex
+	recs map[SymbolKey]*quoteRec
+}
+
+var errRecorderClosed = errors.New("QuoteRecorder closed")
+
+func getRecordPath(dir, ticker string, day julian.JulianDay) string {
+	y, m, d := day.Date()
+	res := fmt.Sprintf("%s/%s/%04d/%s-%04d%02d%02d.qrec",
+		dir, ticker, y, ticker, y, m, d)
+	return res
+}
+
+// NewQuoteRecorder ... create recorder write to dir
+//		dir  "" for $HOME/forex/RecTick
+func NewQuoteRecorder(dir string) *QuoteRecorder {
+	if dir == "" {
+		dir = homePath + "/forex/RecTick"
+	}
+	return &QuoteRecorder{dir: dir, recs: map[SymbolKey]*quoteRec{}}
+}
+
+func (r *QuoteRecorder) getRec(si *SymbolInfo) *quoteRec {
+	if rec, ok := r.recs[si.fKey]; ok {
+		return rec
+	}
+	rec := &quoteRec{si: si}
+	r.recs[si.fKey] = rec
+	return rec
+}
+
+// Subscribe ... record quotes via QuotesPtr of subscribed symbols
+//		should be same QuoteSubT slice as Broker.SubscribeQuotes
+func (r *QuoteRecorder) Subscribe(subs []QuoteSubT) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.recs == nil {
+		return
+	}
+	for _, qs := range subs {
+		s, err := GetSymbolInfo(qs.Symbol)
+		if err != nil {
+			continue
+		}
+		si, _ := s.fKey.SymbolInfo()
+		rec := r.getRec(si)
+		rec.quote = qs.QuotesPtr
+		rec.depth = qs.DepthPtr
+	}
+}
+
+// OnQuote ... snapshot subscribed quotes and depth of sym,
+//		call on QuoteEvent 0 and EventDepth
+func (r *QuoteRecorder) OnQuote(sym string) error {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return err
+	}
+	r.lock.Lock()
+	rec, ok := r.recs[si.fKey]
+	r.lock.Unlock()
+	if !ok || rec.quote == nil {
+		return errNoSuchSymbol
+	}
+	q := rec.quote.Load()
+	return r.Record(sym, &q)
+}
+
+// Record ... record quote of sym, unchanged quote will be skipped
+func (r *QuoteRecorder) Record(sym string, q *Quotes) error {
+	s, err := GetSymbolInfo(sym)
+	if err != nil {
+		return err
+	}
+	si, _ := s.fKey.SymbolInfo()
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.recs == nil {
+		return errRecorderClosed
+	}
+	rec := r.getRec(si)
+	qr, ok := rec.buildRecord(q)
+	if !ok {
+		return nil
+	}
+	day := si.TradingDay(q.UpdateTime)
+	if rec.day != day {
+		if err := rec.flush(r.dir); err != nil {
+			return err
+		}
+		rec.day = day
+	}
+	rec.recs = append(rec.recs, qr)
+	rec.last = qr
+	if len(rec.recs) >= recBlockTicks {
+		return rec.flush(r.dir)
+	}
+	return nil
+}
+
+// buildRecord ... copy quotes and depth, false for zero time or no change
+func (rec *quoteRec) buildRecord(q *Quotes) (qr quoteRecord, ok bool) {
+	if q.UpdateTime == 0 {
+		return
+	}
+	qr.Quotes = *q
+	qr.Seq = 0
+	if rec.depth != nil {
+		// published DepthBook never modified, share levels
+		if d := rec.depth.Load(); d != nil {
+			qr.Bids, qr.Asks = d.Bids, d.Asks
+		}
+	}
+	if qr.Quotes == rec.last.Quotes && levelsEqual(qr.Bids, rec.last.Bids) &&
+		levelsEqual(qr.Asks, rec.last.Asks) {
+		return
+	}
+	ok = true
+	return
+}
+
+func levelsEqual(a, b []DepthLevel) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeRecords ... little endian records of recorded file
+func encodeRecords(recs []quoteRecord) []byte {
+	var buf bytes.Buffer
+	for i := range recs {
+		qr := &recs[i]
+		binary.Write(&buf, binary.LittleEndian, &qr.Quotes)
+		binary.Write(&buf, binary.LittleEndian, [2]uint16{uint16(len(qr.Bids)),
+			uint16(len(qr.Asks))})
+		binary.Write(&buf, binary.LittleEndian, qr.Bids)
+		binary.Write(&buf, binary.LittleEndian, qr.Asks)
+	}
+	return buf.Bytes()
+}
+
+func (rec *quoteRec) flush(dir string) (err error) {
+	if len(rec.recs) == 0 {
+		return
+	}
+	fileN := getRecordPath(dir, rec.si.Ticker, rec.day)
+	if err = os.MkdirAll(filepath.Dir(fileN), 0755); err != nil {
+		return
+	}
+	fd, err := os.OpenFile(fileN, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return
+	}
+	defer fd.Close()
+	if _, err = fd.Write(encodeRecords(rec.recs)); err != nil {
+		return
+	}
+	rec.recs = rec.recs[:0]
+	return
+}
+
+// Flush ... write all buffered records to daily files
+func (r *QuoteRecorder) Flush() (err error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, rec := range r.recs {
+		if errL := rec.flush(r.dir); errL != nil {
+			err = errL
+		}
+	}
+	return
+}
+
+// Close ... flush and stop recording
+func (r *QuoteRecorder) Close() error {
+	err := r.Flush()
+	r.lock.Lock()
+	r.recs = nil
+	r.lock.Unlock()
+	return err
+}
@@ -0,0 +1,224 @@
+package ats
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/kjx98/golib/julian"
+)
+
+func TestQuoteRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atsRecord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initSymbols()
+	newSymbolInfo("EURUSD")
+	newSymbolInfo("sh600600")
+	st := julian.FromUint32(20190102)
+	baseT := JulianToDateTimeMs(st)
+	rec := NewQuoteRecorder(dir)
+	var qFX, qEQ Quotes
+	var sFX, sEQ QuoteSnap
+	rec.Subscribe([]QuoteSubT{{Symbol: "EURUSD", QuotesPtr: &sFX},
+		{Symbol: "sh600600", QuotesPtr: &sEQ}})
+	// two days, time delta over 65536 seconds split block
+	for i := 0; i < 200; i++ {
+		qFX.UpdateTime = baseT.Add(i * 1000 * 600)
+		qFX.Bid = 1.13 + float64(i)*0.00001
+		qFX.Ask = qFX.Bid + 0.0002
+		sFX.Store(qFX)
+		if err := rec.OnQuote("EURUSD"); err != nil {
+			t.Error("OnQuote EURUSD", err)
+		}
+		qEQ.UpdateTime = qFX.UpdateTime
+		qEQ.Last = 12.5 + float64(i%10)*0.01
+		qEQ.Volume += 100
+		sEQ.Store(qEQ)
+		if err := rec.OnQuote("sh600600"); err != nil {
+			t.Error("OnQuote sh600600", err)
+		}
+	}
+	// unchanged quote skipped
+	rec.OnQuote("sh600600")
+	if err := rec.Close(); err != nil {
+		t.Error("Close recorder", err)
+	}
+	fxTick, err := LoadReplayTick("EURUSD", dir, 0, 0)
+	if err != nil {
+		t.Error("LoadReplayTick EURUSD", err)
+		return
+	}
+	if fxTick.Len() != 200 {
+		t.Errorf("EURUSD replay records %d, want 200", fxTick.Len())
+	}
+	if bid, ask, _, _ := fxTick.TickValue(); bid != 113000 || ask != 113020 {
+		t.Errorf("EURUSD first tick %d/%d", bid, ask)
+	}
+	if res, err := LoadReplayTick("EURUSD", dir, st.Add(1), 0); err != nil {
+		t.Error("LoadReplayTick EURUSD second day", err)
+	} else if res.Len() != 56 {
+		t.Errorf("EURUSD second day records %d, want 56", res.Len())
+	}
+
+	feed := NewReplayFeed(dir, ReplayMaxSpeed)
+	if err := feed.Load("EURUSD", 0, 0); err != nil {
+		t.Error("ReplayFeed Load", err)
+	}
+	if err := feed.Load("sh600600", 0, 0); err != nil {
+		t.Error("ReplayFeed Load", err)
+	}
+	var sRFX, sREQ QuoteSnap
+	feed.SubscribeQuotes([]QuoteSubT{{Symbol: "EURUSD", QuotesPtr: &sRFX},
+		{Symbol: "sh600600", QuotesPtr: &sREQ}})
+	ch := make(chan QuoteEvent, 16)
+	go feed.Run(ch)
+	nEvents := 0
+	for ev := range ch {
+		if ev.EventID < 0 {
+			break
+		}
+		nEvents++
+	}
+	if nEvents != 400 {
+		t.Errorf("ReplayFeed events %d, want 400", nEvents)
+	}
+	rFX, rEQ := sRFX.Load(), sREQ.Load()
+	if rFX.Seq != 200 {
+		t.Errorf("replay EURUSD seq %d, want 200", rFX.Seq)
+	}
+	if rFX.Bid != qFX.Bid || rFX.Ask != qFX.Ask {
+		t.Errorf("replay EURUSD %g/%g, want %g/%g", rFX.Bid, rFX.Ask, qFX.Bid, qFX.Ask)
+	}
+	if rEQ.Last != qEQ.Last || rEQ.Volume != qEQ.Volume {
+		t.Errorf("replay sh600600 %g/%d, want %g/%d", rEQ.Last, rEQ.Volume,
+			qEQ.Last, qEQ.Volume)
+	}
+	if ms := feed.TimeCurrent(); ms != qFX.UpdateTime {
+		t.Errorf("replay TimeCurrent %v, want %v", ms, qFX.UpdateTime)
+	}
+}
+
+func TestQuoteRecordReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "atsRecord")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	initSymbols()
+	newSymbolInfo("EURUSD")
+	newSymbolInfo("sh600600")
+	baseT := JulianToDateTimeMs(julian.FromUint32(20190102)).Add(3600 * 1000)
+	var want []Quotes
+	for i := 0; i < 20; i++ {
+		q := Quotes{UpdateTime: baseT.Add(i*250 + i%3), TodayOpen: 12.3,
+			TodayHigh: 12.6 + float64(i)*0.01, TodayLow: 12.1, Pclose: 12.25,
+			Last: 12.4 + float64(i%5)*0.01, Volume: int64(1000 + i*300),
+			Turnover: 123456.78 + float64(i)*3712.5, Bid: 12.39 + float64(i%5)*0.01,
+			Ask: 12.41 + float64(i%5)*0.01, BidVol: int64(100 + i), AskVol: int64(200 - i)}
+		want = append(want, q)
+	}
+	rec := NewQuoteRecorder(dir)
+	var sEQ, sFX QuoteSnap
+	dEQ := NewDepthSnap(2)
+	rec.Subscribe([]QuoteSubT{{Symbol: "sh600600", QuotesPtr: &sEQ, DepthPtr: dEQ},
+		{Symbol: "EURUSD", QuotesPtr: &sFX}})
+	depthOf := func(q Quotes) *DepthBook {
+		return &DepthBook{UpdateTime: q.UpdateTime,
+			Bids: []DepthLevel{{q.Bid, q.BidVol}, {q.Bid - 0.01, 500}},
+			Asks: []DepthLevel{{q.Ask, q.AskVol}, {q.Ask + 0.01, 600}}}
+	}
+	for _, q := range want {
+		sEQ.Store(q)
+		dEQ.Store(depthOf(q))
+		if err := rec.OnQuote("sh600600"); err != nil {
+			t.Error("OnQuote sh600600", err)
+		}
+		q.Last = 0
+		sFX.Store(q)
+		if err := rec.OnQuote("EURUSD"); err != nil {
+			t.Error("OnQuote EURUSD", err)
+		}
+	}
+	if err := rec.Close(); err != nil {
+		t.Error("Close recorder", err)
+	}
+	cmp := func(sym string, i int, got, q Quotes) {
+		if got.UpdateTime != q.UpdateTime {
+			t.Errorf("%s %d UpdateTime %v, want %v", sym, i, got.UpdateTime, q.UpdateTime)
+		}
+		if got.TodayOpen != q.TodayOpen || got.TodayHigh != q.TodayHigh ||
+			got.TodayLow != q.TodayLow || got.Pclose != q.Pclose {
+			t.Errorf("%s %d OHL/Pclose diff %v, want %v", sym, i, got, q)
+		}
+		if got.Last != q.Last || got.Volume != q.Volume || got.Turnover != q.Turnover {
+			t.Errorf("%s %d Last/Volume/Turnover diff %v, want %v", sym, i, got, q)
+		}
+		if got.Bid != q.Bid || got.Ask != q.Ask || got.BidVol != q.BidVol ||
+			got.AskVol != q.AskVol {
+			t.Errorf("%s %d Bid/Ask diff %v, want %v", sym, i, got, q)
+		}
+	}
+	for _, sym := range []string{"sh600600", "EURUSD"} {
+		res, err := LoadReplayTick(sym, dir, 0, 0)
+		if err != nil {
+			t.Error("LoadReplayTick", sym, err)
+			continue
+		}
+		if res.Len() != len(want) {
+			t.Errorf("%s records %d, want %d", sym, res.Len(), len(want))
+			continue
+		}
+		for i, q := range want {
+			if sym == "EURUSD" {
+				q.Last = 0
+			}
+			cmp(sym, i, res.TickQuotes(), q)
+			tk := res.TickDepth()
+			if sym == "EURUSD" && tk != nil {
+				t.Error("EURUSD depth recorded without DepthPtr", tk)
+			} else if sym == "sh600600" && (tk == nil || tk.BidsVol != uint32(q.BidVol+500) ||
+				tk.AsksVol != uint32(q.AskVol+600)) {
+				t.Error("sh600600 depth diff", i, tk)
+			}
+			res.Next()
+		}
+	}
+
+	feed := NewReplayFeed(dir, ReplayMaxSpeed)
+	feed.Load("sh600600", 0, 0)
+	var sR QuoteSnap
+	dR := NewDepthSnap(2)
+	feed.SubscribeQuotes([]QuoteSubT{{Symbol: "sh600600", QuotesPtr: &sR,
+		DepthPtr: dR}})
+	ch := make(chan QuoteEvent)
+	go feed.Run(ch)
+	i, nDepth := 0, 0
+	for ev := range ch {
+		if ev.EventID < 0 {
+			break
+		}
+		if ev.EventID == EventDepth {
+			nDepth++
+			continue
+		}
+		// feed may publish next record before Load, match by Seq
+		if got := sR.Load(); got.Seq > 0 && got.Seq <= uint64(len(want)) {
+			cmp("replay", int(got.Seq-1), got, want[got.Seq-1])
+		} else {
+			t.Error("replay seq out of range", got.Seq)
+		}
+		i++
+	}
+	if i != len(want) || nDepth != len(want) {
+		t.Errorf("replay events %d/%d, want %d", i, nDepth, len(want))
+	}
+	q := want[len(want)-1]
+	if db := dR.Load(); db == nil || !reflect.DeepEqual(db.Bids, depthOf(q).Bids) ||
+		!reflect.DeepEqual(db.Asks, depthOf(q).Asks) {
+		t.Error("replay sh600600 depth diff", db)
+	}
+}
@@ -0,0 +1,326 @@
+package ats
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kjx98/golib/julian"
+	"github.com/kjx98/golib/to"
+)
+
+// replay speed for ReplayFeed
+//	ReplayMaxSpeed	no wait between ticks
+//	ReplayOriginal	same pace as recorded
+const (
+	ReplayMaxSpeed float64 = 0
+	ReplayOriginal float64 = 1
+)
+
+// replayTick ... recorded quotes, simTicker for simBroker
+type replayTick struct {
+	multi float64
+	curP  int
+	recs  []quoteRecord
+}
+
+var (
+	errNoRecord   = errors.New("No recorded quotes")
+	errRecordSize = errors.New("Truncated quote record")
+)
+
+func (sti *replayTick) Reset() {
+	sti.curP = 0
+}
+
+func (sti *replayTick) Len() int {
+	return len(sti.recs)
+}
+
+func (sti *replayTick) Left() int {
+	return len(sti.recs) - sti.curP
+}
+
+func (sti *replayTick) Time() DateTimeMs {
+	return sti.record().UpdateTime
+}
+
+func (sti *replayTick) TimeAt(i int) DateTimeMs {
+	if i >= len(sti.recs) {
+		panic("Out of replayTick bound")
+	}
+	return sti.recs[i].UpdateTime
+}
+
+func (sti *replayTick) record() *quoteRecord {
+	if sti.curP >= len(sti.recs) {
+		panic("Out of replayTick bound")
+	}
+	return &sti.recs[sti.curP]
+}
+
+// TickValue ... recorded bid/ask/last as simTick
+//	vol traded since previous record, Volume for new trading day
+func (sti *replayTick) TickValue() (bid, ask, last int32, vol uint32) {
+	tp := sti.record()
+	bid = int32(math.Round(tp.Bid * sti.multi))
+	ask = int32(math.Round(tp.Ask * sti.multi))
+	last = int32(math.Round(tp.Last * sti.multi))
+	vol = uint32(tp.Volume)
+	if sti.curP > 0 {
+		if pv := sti.recs[sti.curP-1].Volume; tp.Volume >= pv {
+			vol = uint32(tp.Volume - pv)
+		}
+	}
+	return
+}
+
+// TickQuotes ... recorded quotes of current tick
+func (sti *replayTick) TickQuotes() Quotes {
+	return sti.record().Quotes
+}
+
+// TickDepth ... current tick with depth, nil for no recorded depth
+//	top level as Bid/Ask, deepest price and total volume of levels
+func (sti *replayTick) TickDepth() *TickExt {
+	tp := sti.record()
+	if len(tp.Bids) == 0 && len(tp.Asks) == 0 {
+		return nil
+	}
+	tick := TickExt{Time: timeT32(tp.UpdateTime.Unix())}
+	if len(tp.Bids) > 0 {
+		tick.Bid = int32(math.Round(tp.Bids[0].Price * sti.multi))
+		tick.BidVol = uint32(tp.Bids[0].Volume)
+		tick.BidDepth = int32(math.Round(tp.Bids[len(tp.Bids)-1].Price * sti.multi))
+	}
+	if len(tp.Asks) > 0 {
+		tick.Ask = int32(math.Round(tp.Asks[0].Price * sti.multi))
+		tick.AskVol = uint32(tp.Asks[0].Volume)
+		tick.AskDepth = int32(math.Round(tp.Asks[len(tp.Asks)-1].Price * sti.multi))
+	}
+	for _, l := range tp.Bids {
+		tick.BidsVol += uint32(l.Volume)
+	}
+	for _, l := range tp.Asks {
+		tick.AsksVol += uint32(l.Volume)
+	}
+	return &tick
+}
+
+func (sti *replayTick) Next() error {
+	sti.curP++
+	if sti.curP >= len(sti.recs) {
+		return io.EOF
+	}
+	return nil
+}
+
+// decodeRecords ... decode records of recorded daily file
+func decodeRecords(buf []byte) (res []quoteRecord, err error) {
+	rd := bytes.NewReader(buf)
+	for rd.Len() > 0 {
+		var qr quoteRecord
+		var nLv [2]uint16
+		if err = binary.Read(rd, binary.LittleEndian, &qr.Quotes); err != nil {
+			break
+		}
+		if err = binary.Read(rd, binary.LittleEndian, &nLv); err != nil {
+			break
+		}
+		if nLv[0] > 0 {
+			qr.Bids = make([]DepthLevel, nLv[0])
+			if err = binary.Read(rd, binary.LittleEndian, qr.Bids); err != nil {
+				break
+			}
+		}
+		if nLv[1] > 0 {
+			qr.Asks = make([]DepthLevel, nLv[1])
+			if err = binary.Read(rd, binary.LittleEndian, qr.Asks); err != nil {
+				break
+			}
+		}
+		res = append(res, qr)
+	}
+	if err != nil {
+		err = errRecordSize
+	}
+	return
+}
+
+// LoadReplayTick ... load recorded quotes of sym from dir
+//		dir				"" for default record path
+//		startD, endD	0 unlimit
+func LoadReplayTick(sym, dir string, startD, endD julian.JulianDay) (res *replayTick, err error) {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return
+	}
+	if dir == "" {
+		dir = NewQuoteRecorder("").dir
+	}
+	files, err := filepath.Glob(filepath.Join(dir, sym, "*", sym+"-*.qrec"))
+	if err != nil {
+		return
+	}
+	sort.Strings(files)
+	res = &replayTick{multi: si.Multi()}
+	for _, fileN := range files {
+		ss := strings.TrimSuffix(filepath.Base(fileN), ".qrec")
+		day := julian.FromUint32(uint32(to.Int(ss[len(sym)+1:])))
+		if (startD != 0 && day < startD) || (endD != 0 && day > endD) {
+			continue
+		}
+		buf, errL := ioutil.ReadFile(fileN)
+		if errL != nil {
+			err = errL
+			return
+		}
+		recs, errL := decodeRecords(buf)
+		if errL != nil {
+			log.Errorf("LoadReplayTick %s: %v", fileN, errL)
+			err = errL
+			return
+		}
+		res.recs = append(res.recs, recs...)
+	}
+	if len(res.recs) == 0 {
+		err = errNoRecord
+	}
+	return
+}
+
+// ReplayFeed ... play recorded quotes to subscribed QuotesPtr and
+//		emit QuoteEvent to Broker event channel
+//	Speed	ReplayMaxSpeed, ReplayOriginal or accelerate ratio
+type ReplayFeed struct {
+	current int64 // DateTimeMs, first for 64 bit alignment of atomic
+	Speed   float64
+	dir     string
+	status  int32
+	ticks   map[SymbolKey]*replayTick
+	quotes  map[SymbolKey]*QuoteSnap
+	depths  map[SymbolKey]*DepthSnap
+}
+
+// NewReplayFeed ... create replay feed from record dir
+func NewReplayFeed(dir string, speed float64) *ReplayFeed {
+	return &ReplayFeed{Speed: speed, dir: dir,
+		ticks:  map[SymbolKey]*replayTick{},
+		quotes: map[SymbolKey]*QuoteSnap{},
+		depths: map[SymbolKey]*DepthSnap{}}
+}
+
+// Load ... load recorded quotes of sym for replay
+func (f *ReplayFeed) Load(sym string, startD, endD julian.JulianDay) error {
+	if atomic.LoadInt32(&f.status) != VmIdle {
+		return errVMStatus
+	}
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return err
+	}
+	res, err := LoadReplayTick(sym, f.dir, startD, endD)
+	if err != nil {
+		return err
+	}
+	f.ticks[si.fKey] = res
+	return nil
+}
+
+// SubscribeQuotes ... quotes of symbol updated via QuotesPtr while replay
+func (f *ReplayFeed) SubscribeQuotes(qq []QuoteSubT) error {
+	if atomic.LoadInt32(&f.status) != VmIdle {
+		return errVMStatus
+	}
+	for _, qs := range qq {
+		if si, err := GetSymbolInfo(qs.Symbol); err == nil {
+			f.quotes[si.fKey] = qs.QuotesPtr
+			if qs.DepthPtr != nil {
+				f.depths[si.fKey] = qs.DepthPtr
+			}
+		}
+	}
+	return nil
+}
+
+// TimeCurrent ... time of last replayed quotes
+func (f *ReplayFeed) TimeCurrent() DateTimeMs {
+	return DateTimeMs(atomic.LoadInt64(&f.current))
+}
+
+// Stop ... stop running replay
+func (f *ReplayFeed) Stop() {
+	atomic.CompareAndSwapInt32(&f.status, VmRunning, VmStoping)
+}
+
+// Run ... replay all loaded quotes in time order, blocked until end or Stop
+//		publish recorded Quotes and depth as recorded,
+//		emit QuoteEvent 0 for every record, EventDepth for depth update,
+//		-1 for end of replay
+func (f *ReplayFeed) Run(ch chan<- QuoteEvent) error {
+	if !atomic.CompareAndSwapInt32(&f.status, VmIdle, VmRunning) {
+		return errVMStatus
+	}
+	defer atomic.StoreInt32(&f.status, VmIdle)
+	run := map[SymbolKey]*replayTick{}
+	for k, v := range f.ticks {
+		v.Reset()
+		run[k] = v
+	}
+	var lastT DateTimeMs
+	for len(run) > 0 && atomic.LoadInt32(&f.status) == VmRunning {
+		msNext := DateTimeMs(0)
+		for _, v := range run {
+			if msNext == 0 || v.Time() < msNext {
+				msNext = v.Time()
+			}
+		}
+		if f.Speed > 0 && lastT != 0 && msNext > lastT {
+			dur := time.Duration(float64(msNext-lastT) / f.Speed * float64(time.Millisecond))
+			time.Sleep(dur)
+		}
+		lastT = msNext
+		atomic.StoreInt64(&f.current, int64(msNext))
+		for k, v := range run {
+			if v.Time() != msNext {
+				continue
+			}
+			si, err := k.SymbolInfo()
+			if err != nil {
+				delete(run, k)
+				continue
+			}
+			qr := v.record()
+			if qq, ok := f.quotes[k]; ok {
+				qq.Store(qr.Quotes)
+			}
+			if ch != nil {
+				ch <- QuoteEvent{Symbol: si.Ticker}
+			}
+			if d, ok := f.depths[k]; ok {
+				if len(qr.Bids) > 0 || len(qr.Asks) > 0 {
+					d.Store(&DepthBook{UpdateTime: msNext, Bids: qr.Bids,
+						Asks: qr.Asks})
+					if ch != nil {
+						ch <- QuoteEvent{Symbol: si.Ticker, EventID: EventDepth}
+					}
+				}
+			}
+			if v.Next() != nil {
+				delete(run, k)
+			}
+		}
+	}
+	if ch != nil {
+		ch <- QuoteEvent{EventID: -1}
+	}
+	return nil
+}
@@ -0,0 +1,348 @@
+package ats
+
+import (
+	"errors"
+	"math"
+	"sync"
+
+	"github.com/kjx98/golib/ini"
+	"github.com/kjx98/golib/julian"
+)
+
+var (
+	errRiskOrderQty  = errors.New("Order quantity over limit")
+	errRiskPosition  = errors.New("Position over limit")
+	errRiskGross     = errors.New("Gross exposure over limit")
+	errRiskNet       = errors.New("Net exposure over limit")
+	errRiskRate      = errors.New("Orders per second over limit")
+	errRiskDailyLoss = errors.New("Daily loss limit reached")
+	errRiskKilled    = errors.New("Kill switch triggered")
+)
+
+// RiskLimits ... limits of risk layer in front of Broker, zero for no limit
+//	MaxOrderQty		max quantity of single order
+//	MaxPosition		max absolute position per symbol
+//	MaxGross		max sum of absolute market value of positions
+//	MaxNet			max absolute net market value of positions
+//	MaxOrdersSec	max orders per second
+//	MaxDailyLoss	max loss of equity from start of trading day, only orders
+//				reduce positions allowed after reached
+//	MaxDrawdown		drawdown of equity from peak, 0.2 for 20%, kill switch
+//				cancel all orders and flatten positions, no more orders
+//	Market			market of trading day for daily loss, "" for UTC day
+//	Currency		base currency of exposures, "" for no conversion
+type RiskLimits struct {
+	MaxOrderQty  int
+	MaxPosition  int
+	MaxGross     float64
+	MaxNet       float64
+	MaxOrdersSec int
+	MaxDailyLoss float64
+	MaxDrawdown  float64
+	Market       string
+	Currency     string
+}
+
+// loadRiskLimits ... RiskLimits from section Risk of ini, false for no
+//		limits configured
+func loadRiskLimits(cf *ini.IniConfig) (res RiskLimits, ok bool) {
+	res.MaxOrderQty = cf.GetConfigInt("Risk", "MaxOrderQty", 0)
+	res.MaxPosition = cf.GetConfigInt("Risk", "MaxPosition", 0)
+	res.MaxGross = cf.GetConfigDouble("Risk", "MaxGross", 0)
+	res.MaxNet = cf.GetConfigDouble("Risk", "MaxNet", 0)
+	res.MaxOrdersSec = cf.GetConfigInt("Risk", "MaxOrdersPerSec", 0)
+	res.MaxDailyLoss = cf.GetConfigDouble("Risk", "MaxDailyLoss", 0)
+	res.MaxDrawdown = cf.GetConfigDouble("Risk", "MaxDrawdown", 0)
+	ok = res != RiskLimits{}
+	res.Market = cf.GetConfig("Risk", "Market", "")
+	res.Currency = cf.GetConfig("Risk", "Currency", "")
+	return
+}
+
+// riskBroker ... Broker wrapper enforce RiskLimits before SendOrder
+type riskBroker struct {
+	Broker
+	limits    RiskLimits
+	lock      sync.Mutex
+	orderTime []DateTimeMs
+	day       julian.JulianDay
+	dayEquity float64
+	peak      float64
+	killed    bool
+	subs      []*subAccount
+}
+
+// NewRiskBroker ... wrap br with risk layer of limits
+func NewRiskBroker(br Broker, limits RiskLimits) Broker {
+	return &riskBroker{Broker: br, limits: limits}
+}
+
+// Open ... open wrapped broker, risk layer with same limits
+func (rb *riskBroker) Open(ch chan<- QuoteEvent) (Broker, error) {
+	br, err := rb.Broker.Open(ch)
+	if err != nil {
+		return nil, err
+	}
+	return NewRiskBroker(br, rb.limits), nil
+}
+
+// Killed ... true after kill switch triggered
+func (rb *riskBroker) Killed() bool {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	return rb.killed
+}
+
+// addSub ... sub-account on risk layer, positions flattened by kill
+//		switch with magic of sub-account
+func (rb *riskBroker) addSub(sa *subAccount) {
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	rb.subs = append(rb.subs, sa)
+}
+
+// Kill ... kill switch, cancel all orders and flatten positions, orders
+//		refused afterward, positions of sub-accounts flattened with magic
+//		of sub-account, rest of account without magic
+func (rb *riskBroker) Kill() {
+	rb.lock.Lock()
+	rb.killed = true
+	subs := rb.subs
+	rb.lock.Unlock()
+	for _, oid := range rb.Broker.GetOrders() {
+		if or := rb.Broker.GetOrder(oid); or != nil {
+			switch or.Status {
+			case OrderNew, OrderAccept, OrderPartFilled:
+				rb.Broker.CancelOrder(oid)
+			}
+		}
+	}
+	rest := map[SymbolKey]*PositionType{}
+	for _, pos := range rb.Broker.GetPositions() {
+		p := pos
+		rest[pos.fKey] = &p
+	}
+	for _, sa := range subs {
+		for _, pos := range sa.GetPositions() {
+			if p, ok := rest[pos.fKey]; ok {
+				p.Positions -= pos.Positions
+				p.Long.sub(&pos.Long)
+				p.Short.sub(&pos.Short)
+			}
+			for _, oid := range rb.flatten(&pos, sa.magic) {
+				sa.track(oid)
+			}
+		}
+	}
+	for _, pos := range rest {
+		rb.flatten(pos, 0)
+	}
+	log.Warning("risk kill switch, orders canceled and positions flattened")
+}
+
+// sub ... leg less leg of sub-account, never negative
+func (leg *PositionLeg) sub(o *PositionLeg) {
+	leg.Positions -= o.Positions
+	leg.Today -= o.Today
+	if leg.Positions < 0 {
+		leg.Positions = 0
+	}
+	if leg.Today > leg.Positions {
+		leg.Today = leg.Positions
+	} else if leg.Today < 0 {
+		leg.Today = 0
+	}
+}
+
+// flatten ... market orders offset position tagged with magic, bypass
+//		risk limits
+func (rb *riskBroker) flatten(pos *PositionType, magic int) (res []int) {
+	si, err := pos.fKey.SymbolInfo()
+	if err != nil {
+		return
+	}
+	send := func(dir OrderDirT, qty int) {
+		if oid := sendOrderMagic(rb.Broker, si.Ticker, dir, qty, 0, 0, magic); oid >= 0 {
+			res = append(res, oid)
+		}
+	}
+	if pos.Long.Positions == 0 && pos.Short.Positions == 0 {
+		switch {
+		case pos.Positions > 0:
+			send(OrderDirClose, pos.Positions)
+		case pos.Positions < 0:
+			send(OrderDirCover, -pos.Positions)
+		}
+		return
+	}
+	flattenLeg := func(leg *PositionLeg, dir, dirToday OrderDirT) {
+		qty := leg.Positions
+		// today separated for exchanges distinguish close today
+		if si.CloseToday && leg.Today > 0 {
+			send(dirToday, leg.Today)
+			qty -= leg.Today
+		}
+		if qty > 0 {
+			send(dir, qty)
+		}
+	}
+	flattenLeg(&pos.Long, OrderDirClose, OrderDirCloseToday)
+	flattenLeg(&pos.Short, OrderDirCover, OrderDirCoverToday)
+	return
+}
+
+// CheckRisk ... verify daily loss and drawdown with current equity,
+//		trigger kill switch for drawdown over limit
+func (rb *riskBroker) CheckRisk() error {
+	rb.lock.Lock()
+	if rb.killed {
+		rb.lock.Unlock()
+		return errRiskKilled
+	}
+	eq := rb.Broker.Equity()
+	// trading day of market, night session belongs to next day
+	day := marketTradingDay(rb.limits.Market, rb.Broker.TimeCurrent().Unix())
+	if day != rb.day {
+		rb.day, rb.dayEquity = day, eq
+	}
+	if eq > rb.peak {
+		rb.peak = eq
+	}
+	kill := rb.limits.MaxDrawdown > 0 && rb.peak > 0 &&
+		(rb.peak-eq)/rb.peak >= rb.limits.MaxDrawdown
+	lossOver := rb.limits.MaxDailyLoss > 0 &&
+		rb.dayEquity-eq >= rb.limits.MaxDailyLoss
+	rb.lock.Unlock()
+	if kill {
+		rb.Kill()
+		return errRiskKilled
+	}
+	if lossOver {
+		return errRiskDailyLoss
+	}
+	return nil
+}
+
+// exposure ... market value of position qty of symbol in currency, quotes
+//		published by broker or price
+func exposure(si *SymbolInfo, qty int, prc float64, currency string) float64 {
+	q := si.GetQuotes()
+	switch {
+	case q.Bid > 0 && q.Ask > 0:
+		prc = (q.Bid + q.Ask) / 2
+	case q.Last > 0:
+		prc = q.Last
+	}
+	amt, _ := convertCurrency(si.CalcProfit(0, prc, qty), si.Currency(), currency)
+	return amt
+}
+
+// checkOrder ... verify order against limits, orders reduce position
+//		bypass position and exposure limits, allowed after daily loss
+//		limit reached
+func (rb *riskBroker) checkOrder(si *SymbolInfo, dir OrderDirT, qty int, prc float64, lossOver bool) error {
+	if rb.limits.MaxOrderQty > 0 && qty > rb.limits.MaxOrderQty {
+		return errRiskOrderQty
+	}
+	var cur int
+	var hedged bool
+	var gross, net float64
+	for _, pos := range rb.Broker.GetPositions() {
+		ps, err := pos.fKey.SymbolInfo()
+		if err != nil {
+			continue
+		}
+		if ps.fKey == si.fKey {
+			cur = pos.Positions
+			hedged = pos.Long.Positions != 0 || pos.Short.Positions != 0
+		}
+		// legs of hedging position, long and short both in gross
+		for _, leg := range pos.legs() {
+			v := exposure(ps, leg.qty, leg.avgPrice, rb.limits.Currency)
+			gross += math.Abs(v)
+			net += v
+		}
+	}
+	after := cur + dir.Sign()*qty
+	// offset of hedging leg always reduce exposure
+	if (hedged && dir.IsOffset()) || abs(after) < abs(cur) {
+		return nil
+	}
+	if lossOver {
+		return errRiskDailyLoss
+	}
+	if rb.limits.MaxPosition > 0 && abs(after) > rb.limits.MaxPosition {
+		return errRiskPosition
+	}
+	v := exposure(si, dir.Sign()*qty, prc, rb.limits.Currency)
+	if rb.limits.MaxGross > 0 && gross+math.Abs(v) > rb.limits.MaxGross {
+		return errRiskGross
+	}
+	if rb.limits.MaxNet > 0 && math.Abs(net+v) > rb.limits.MaxNet {
+		return errRiskNet
+	}
+	return nil
+}
+
+// checkRate ... verify orders per second, record order time
+func (rb *riskBroker) checkRate() error {
+	n := rb.limits.MaxOrdersSec
+	if n <= 0 {
+		return nil
+	}
+	rb.lock.Lock()
+	defer rb.lock.Unlock()
+	now := rb.Broker.TimeCurrent()
+	if len(rb.orderTime) >= n && now-rb.orderTime[len(rb.orderTime)-n] < 1000 {
+		return errRiskRate
+	}
+	rb.orderTime = append(rb.orderTime, now)
+	if len(rb.orderTime) > n {
+		rb.orderTime = rb.orderTime[len(rb.orderTime)-n:]
+	}
+	return nil
+}
+
+// SendOrder ... send order to wrapped broker after risk limits verified
+//		return -1 for refused
+func (rb *riskBroker) SendOrder(sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64) int {
+	return rb.SendOrderMagic(sym, dir, qty, prc, stopL, 0)
+}
+
+// SendOrderMagic ... send order tagged with magic after risk limits verified
+func (rb *riskBroker) SendOrderMagic(sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64, magic int) int {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return -1
+	}
+	err = rb.CheckRisk()
+	if err == nil || err == errRiskDailyLoss {
+		err = rb.checkOrder(&si, dir, qty, prc, err == errRiskDailyLoss)
+	}
+	if err == nil {
+		err = rb.checkRate()
+	}
+	if err != nil {
+		log.Warningf("%s %s %d order refused by risk: %s", sym, dir, qty, err)
+		return -1
+	}
+	return sendOrderMagic(rb.Broker, sym, dir, qty, prc, stopL, magic)
+}
+
+// sendOrderMagic ... send order tagged with magic for MagicBroker
+func sendOrderMagic(br Broker, sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64, magic int) int {
+	if mb, ok := br.(MagicBroker); ok && magic != 0 {
+		return mb.SendOrderMagic(sym, dir, qty, prc, stopL, magic)
+	}
+	return br.SendOrder(sym, dir, qty, prc, stopL)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
@@ -0,0 +1,204 @@
+package ats
+
+import (
+	"testing"
+	"time"
+)
+
+// mockBroker ... record orders sent, fixed equity and positions
+type mockBroker struct {
+	Broker
+	equity   float64
+	curT     DateTimeMs
+	pos      []PositionType
+	orders   []OrderType
+	canceled []int
+	deals    []DealType
+}
+
+func (mb *mockBroker) Equity() float64              { return mb.equity }
+func (mb *mockBroker) TimeCurrent() DateTimeMs      { return mb.curT }
+func (mb *mockBroker) GetPositions() []PositionType { return mb.pos }
+func (mb *mockBroker) GetOrders() []int {
+	res := make([]int, len(mb.orders))
+	for i := range res {
+		res[i] = i
+	}
+	return res
+}
+func (mb *mockBroker) GetOrder(oid int) *OrderType { return &mb.orders[oid] }
+func (mb *mockBroker) GetDeals() []DealType        { return mb.deals }
+func (mb *mockBroker) CancelOrder(oid int) error {
+	mb.canceled = append(mb.canceled, oid)
+	return nil
+}
+func (mb *mockBroker) SendOrder(sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64) int {
+	mb.orders = append(mb.orders, OrderType{Symbol: sym, Dir: dir, Qty: qty,
+		Price: prc, Status: OrderAccept})
+	return len(mb.orders) - 1
+}
+func (mb *mockBroker) SendOrderMagic(sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64, magic int) int {
+	oid := mb.SendOrder(sym, dir, qty, prc, stopL)
+	mb.orders[oid].Magic = magic
+	return oid
+}
+
+func Test_riskBroker_SendOrder(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil {
+		t.Skip("no sh601318", err)
+	}
+	mb := &mockBroker{equity: 1e6, curT: 86400000,
+		pos: []PositionType{{fKey: si.fKey, Positions: 1000, AvgPrice: 50}}}
+	rb := NewRiskBroker(mb, RiskLimits{MaxOrderQty: 1000, MaxPosition: 2000,
+		MaxGross: 70000, MaxOrdersSec: 3, MaxDailyLoss: 10000,
+		MaxDrawdown: 0.1}).(*riskBroker)
+	tests := []struct {
+		name string
+		dir  OrderDirT
+		qty  int
+		prc  float64
+		want int
+	}{
+		{"within limits", OrderDirBuy, 200, 50, 0},
+		{"order qty", OrderDirBuy, 1100, 50, -1},
+		{"gross exposure", OrderDirBuy, 500, 50, -1},
+		{"reduce position", OrderDirClose, 500, 50, 1},
+		{"rate", OrderDirClose, 100, 50, 2},
+		{"rate over", OrderDirClose, 100, 50, -1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := rb.SendOrder("sh601318", tt.dir, tt.qty, tt.prc, 0); got != tt.want {
+				t.Errorf("SendOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// next second, daily loss reached, only reduce allowed
+	mb.curT += 1000
+	mb.equity -= 10000
+	if oid := rb.SendOrder("sh601318", OrderDirBuy, 100, 50, 0); oid != -1 {
+		t.Error("open after daily loss", oid)
+	}
+	if oid := rb.SendOrder("sh601318", OrderDirSell, 100, 50, 0); oid != 3 {
+		t.Error("reduce after daily loss", oid)
+	}
+	// drawdown kill switch
+	mb.equity = 1e6 * 0.89
+	if err := rb.CheckRisk(); err != errRiskKilled || !rb.Killed() {
+		t.Error("CheckRisk kill", err)
+	}
+	if len(mb.canceled) != 4 {
+		t.Error("orders canceled", mb.canceled)
+	}
+	if or := mb.orders[len(mb.orders)-1]; or.Dir != OrderDirClose || or.Qty != 1000 ||
+		or.Price != 0 {
+		t.Error("flatten order", or)
+	}
+	if oid := rb.SendOrder("sh601318", OrderDirClose, 100, 50, 0); oid != -1 {
+		t.Error("order after kill", oid)
+	}
+	// hedging position, long and short legs both in gross exposure
+	mb = &mockBroker{equity: 1e6, curT: 86400000,
+		pos: []PositionType{{fKey: si.fKey, Long: PositionLeg{Positions: 1000,
+			AvgPrice: 50}, Short: PositionLeg{Positions: 1000, AvgPrice: 50}}}}
+	rb = NewRiskBroker(mb, RiskLimits{MaxGross: 70000}).(*riskBroker)
+	if oid := rb.SendOrder("sh601318", OrderDirBuy, 100, 50, 0); oid != -1 {
+		t.Error("gross of hedging legs", oid)
+	}
+}
+
+func Test_riskBroker_KillSubAccount(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil {
+		t.Skip("no sh601318", err)
+	}
+	mb := &mockBroker{equity: 1e6, curT: 86400000}
+	rb := NewRiskBroker(mb, RiskLimits{MaxDrawdown: 0.1}).(*riskBroker)
+	sa := newSubAccount(rb, "strat1", 7, 1e6, 1)
+	oid := sa.SendOrder("sh601318", OrderDirBuy, 1000, 50, 0)
+	mb.orders[oid].QtyFilled, mb.orders[oid].AvgPrice = 1000, 50
+	mb.orders[oid].Status = OrderFilled
+	// 500 shares not owned by sub-account
+	mb.pos = []PositionType{{fKey: si.fKey, Positions: 1500, AvgPrice: 50}}
+	rb.Kill()
+	tests := []struct {
+		name  string
+		qty   int
+		magic int
+	}{
+		{"sub-account", 1000, 7},
+		{"rest of account", 500, 0},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			or := mb.orders[oid+1+i]
+			if or.Dir != OrderDirClose || or.Qty != tt.qty || or.Magic != tt.magic {
+				t.Error("flatten order", or)
+			}
+		})
+	}
+	mb.orders[oid+1].QtyFilled, mb.orders[oid+1].AvgPrice = 1000, 45
+	mb.orders[oid+1].Status = OrderFilled
+	if pos := sa.GetPosition("sh601318"); pos.Positions != 0 {
+		t.Error("sub-account position after kill", pos)
+	}
+}
+
+func Test_riskBroker_MarketCurrency(t *testing.T) {
+	sh, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("LoadLocation", err)
+	}
+	at := func(hh, mm int) DateTimeMs {
+		return TimeToDateTimeMs(time.Date(2019, 3, 8, hh, mm, 0, 0, sh))
+	}
+	// night session of SHFE belongs to next trading day, UTC day not
+	tests := []struct {
+		name   string
+		market string
+		want   error
+	}{
+		{"SHFE", "SHFE", nil},
+		{"UTC", "", errRiskDailyLoss},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mb := &mockBroker{equity: 1e6, curT: at(20, 0)}
+			rb := NewRiskBroker(mb, RiskLimits{MaxDailyLoss: 1000,
+				Market: tt.market}).(*riskBroker)
+			rb.CheckRisk()
+			mb.curT, mb.equity = at(21, 30), 1e6-1000
+			if err := rb.CheckRisk(); err != tt.want {
+				t.Errorf("CheckRisk() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+	// exposure in base currency by quotes published on SymbolInfo
+	initSymbols()
+	newSymbolInfo("USDJPY")
+	si, err := GetSymbolInfo("USDJPY")
+	if err != nil || si.symbolBase == nil {
+		t.Skip("no USDJPY", err)
+	}
+	qp := si.getQuotesPtr()
+	qp.Store(Quotes{Bid: 110, Ask: 110})
+	defer qp.Store(Quotes{})
+	lotUSD := si.CalcProfit(0, 110, 1) / 110
+	mb := &mockBroker{equity: 1e6, curT: at(10, 0),
+		pos: []PositionType{{fKey: si.fKey, Positions: 1, AvgPrice: 110}}}
+	rb := NewRiskBroker(mb, RiskLimits{MaxGross: 2.5 * lotUSD, Currency: "USD"})
+	if oid := rb.SendOrder("USDJPY", OrderDirBuy, 1, 110, 0); oid < 0 {
+		t.Error("gross in USD refused", oid)
+	}
+	rb = NewRiskBroker(mb, RiskLimits{MaxGross: 2.5 * lotUSD})
+	if oid := rb.SendOrder("USDJPY", OrderDirBuy, 1, 110, 0); oid != -1 {
+		t.Error("gross in JPY should be refused", oid)
+	}
+}
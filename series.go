@@ -35,3 +35,19 @@ func NewSlice(s Series) (res []float64) {
 	}
 	return
 }
+
+// FloatSeries ... Series of float slice, negative index for reverse order
+type FloatSeries []float64
+
+// Len ... length of Series
+func (s FloatSeries) Len() int {
+	return len(s)
+}
+
+// DataAt ... data at index i, -1 for last data
+func (s FloatSeries) DataAt(i int) float64 {
+	if i < 0 {
+		i += len(s)
+	}
+	return s[i]
+}
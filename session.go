@@ -0,0 +1,333 @@
+package ats
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/kjx98/golib/julian"
+)
+
+// tradeSession ... trading session, seconds from midnight of market local time
+//	close less than open for session cross midnight
+type tradeSession struct {
+	open  int64
+	close int64
+}
+
+func (s tradeSession) duration() int64 {
+	if d := s.close - s.open; d > 0 {
+		return d
+	}
+	return s.close - s.open + 86400
+}
+
+// marketSessions ... trading sessions of market, in order of trading day
+//	leading night sessions opened in evening before trading day,
+//	trades of night sessions belong to next trading day
+//	trading days by calendar of market
+type marketSessions struct {
+	market   string
+	loc      *time.Location
+	sessions []tradeSession
+	nNight   int
+	total    int64 // trading seconds of trading day
+}
+
+var errSessionFormat = errors.New("Invalid session format, HH:MM-HH:MM")
+
+func parseSessionTime(s string) (int64, error) {
+	var hh, mm int
+	if n, err := fmt.Sscanf(s, "%d:%d", &hh, &mm); err != nil || n != 2 {
+		return 0, errSessionFormat
+	}
+	if hh < 0 || hh > 24 || mm < 0 || mm >= 60 {
+		return 0, errSessionFormat
+	}
+	return int64(hh*3600 + mm*60), nil
+}
+
+// newMarketSessions ... parse sessions like "21:00-01:00", "09:00-10:15"
+//		tz	time zone of sessions, "" for UTC
+func newMarketSessions(tz string, sess []string) (*marketSessions, error) {
+	if len(sess) == 0 {
+		return nil, nil
+	}
+	res := marketSessions{loc: time.UTC}
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, err
+		}
+		res.loc = loc
+	}
+	for _, ss := range sess {
+		var open, close string
+		if n, _ := fmt.Sscanf(ss, "%5s-%5s", &open, &close); n != 2 {
+			return nil, errSessionFormat
+		}
+		var s tradeSession
+		var err error
+		if s.open, err = parseSessionTime(open); err != nil {
+			return nil, err
+		}
+		if s.close, err = parseSessionTime(close); err != nil {
+			return nil, err
+		}
+		res.sessions = append(res.sessions, s)
+		res.total += s.duration()
+	}
+	// night session open after close of trading day
+	dayClose := res.sessions[len(res.sessions)-1].close
+	for _, s := range res.sessions {
+		if s.open < dayClose {
+			break
+		}
+		res.nNight++
+	}
+	return &res, nil
+}
+
+// nextWorkDay ... next weekday after jd
+func nextWorkDay(jd julian.JulianDay) julian.JulianDay {
+	jd = jd.Add(1)
+	for jd.Weekday() == time.Saturday || jd.Weekday() == time.Sunday {
+		jd = jd.Add(1)
+	}
+	return jd
+}
+
+// prevWorkDay ... previous weekday before jd
+func prevWorkDay(jd julian.JulianDay) julian.JulianDay {
+	jd = jd.Add(-1)
+	for jd.Weekday() == time.Saturday || jd.Weekday() == time.Sunday {
+		jd = jd.Add(-1)
+	}
+	return jd
+}
+
+// isWorkDay ... weekday of jd, Saturday and Sunday excluded
+func isWorkDay(jd julian.JulianDay) bool {
+	wd := jd.Weekday()
+	return wd != time.Saturday && wd != time.Sunday
+}
+
+// localDay ... local date and seconds from local midnight
+func (ms *marketSessions) localDay(t int64) (julian.JulianDay, int64) {
+	lt := time.Unix(t, 0).In(ms.loc)
+	y, m, d := lt.Date()
+	return julian.NewJulianDay(y, int(m), d),
+		int64(lt.Hour()*3600 + lt.Minute()*60 + lt.Second())
+}
+
+// localTime ... unix time of local seconds from midnight of day jd
+func (ms *marketSessions) localTime(jd julian.JulianDay, tod int64) int64 {
+	y, m, d := jd.Date()
+	return time.Date(y, time.Month(m), d, 0, 0, 0, 0, ms.loc).Unix() + tod
+}
+
+// tradingDay ... trading day of t, night session trades to next trading day
+func (ms *marketSessions) tradingDay(t int64) julian.JulianDay {
+	jd, tod := ms.localDay(t)
+	if ms.nNight == 0 {
+		return jd
+	}
+	if tod >= ms.sessions[0].open {
+		return NextTradingDay(ms.market, jd)
+	}
+	for _, s := range ms.sessions[:ms.nNight] {
+		if s.close < s.open && tod <= s.close {
+			// after midnight of night session
+			return NextTradingDay(ms.market, jd.Add(-1))
+		}
+	}
+	return jd
+}
+
+// sessionOpens ... open time of sessions for trading day jd
+func (ms *marketSessions) sessionOpens(jd julian.JulianDay) []int64 {
+	res := make([]int64, len(ms.sessions))
+	nightDay := PrevTradingDay(ms.market, jd)
+	for i, s := range ms.sessions {
+		if i < ms.nNight {
+			res[i] = ms.localTime(nightDay, s.open)
+		} else {
+			res[i] = ms.localTime(jd, s.open)
+		}
+	}
+	return res
+}
+
+// elapsed ... trading seconds of t from open of trading day jd
+//		t before session open counted as session open, after session close
+//		counted as last second of session
+func (ms *marketSessions) elapsed(jd julian.JulianDay, t int64) int64 {
+	opens := ms.sessionOpens(jd)
+	var res int64
+	for i, s := range ms.sessions {
+		dur := s.duration()
+		if t < opens[i] {
+			if i > 0 && res > 0 {
+				// break between sessions, belongs to previous session
+				return res - 1
+			}
+			return res
+		}
+		if t < opens[i]+dur {
+			return res + t - opens[i]
+		}
+		res += dur
+	}
+	return res - 1
+}
+
+// elapsedTime ... time of trading seconds from open of trading day jd
+func (ms *marketSessions) elapsedTime(jd julian.JulianDay, el int64) int64 {
+	opens := ms.sessionOpens(jd)
+	for i, s := range ms.sessions {
+		dur := s.duration()
+		if el < dur {
+			return opens[i] + el
+		}
+		el -= dur
+	}
+	return opens[len(opens)-1] + ms.sessions[len(opens)-1].duration()
+}
+
+// baseTime ... bar start time of t for period, aligned to session opens
+//		Daily/Weekly/Monthly by trading day
+func (ms *marketSessions) baseTime(t int64, period Period) int64 {
+	jd := ms.tradingDay(t)
+	if period >= Daily {
+		res, _ := periodBaseTime(jd.UTC().Unix(), period)
+		return res
+	}
+	el := ms.elapsed(jd, t)
+	return ms.elapsedTime(jd, el-el%int64(period))
+}
+
+// nextTime ... start time of next bar after bar contains t
+func (ms *marketSessions) nextTime(t int64, period Period) int64 {
+	jd := ms.tradingDay(t)
+	if period == Daily {
+		return NextTradingDay(ms.market, jd).UTC().Unix()
+	}
+	if period > Daily {
+		return periodNextTime(jd.UTC().Unix(), period)
+	}
+	el := ms.elapsed(jd, t)
+	el += int64(period) - el%int64(period)
+	if el >= ms.total {
+		return ms.sessionOpens(NextTradingDay(ms.market, jd))[0]
+	}
+	res := ms.elapsedTime(jd, el)
+	if tod, ok := HalfDayClose(ms.market, jd); ok && res >= ms.localTime(jd, tod) {
+		// early close of half day
+		return ms.sessionOpens(NextTradingDay(ms.market, jd))[0]
+	}
+	return res
+}
+
+// location ... time zone of market, UTC if not defined
+func (bp *symbolBase) location() *time.Location {
+	if bp == nil || bp.loc == nil {
+		return time.UTC
+	}
+	return bp.loc
+}
+
+// tradingDay ... trading day of t in local time of market
+func (bp *symbolBase) tradingDay(t int64) julian.JulianDay {
+	if bp != nil && bp.sess != nil {
+		return bp.sess.tradingDay(t)
+	}
+	return DateTimeMs(t * 1000).LocalJulianDay(bp.location())
+}
+
+// getMarketBase ... symbolBase of first template of market, nil for none
+func getMarketBase(market string) *symbolBase {
+	for i := range initTemp {
+		if initTemp[i].Base.Market == market {
+			return &initTemp[i].Base
+		}
+	}
+	return nil
+}
+
+// marketTradingDay ... trading day of t in local time of market
+func marketTradingDay(market string, t int64) julian.JulianDay {
+	return getMarketBase(market).tradingDay(t)
+}
+
+// dayEndTime ... end of trading day contains t, open of night session for
+//		market with night sessions, else local midnight of next trading day
+func dayEndTime(market string, t int64) int64 {
+	bp := getMarketBase(market)
+	next := NextTradingDay(market, bp.tradingDay(t))
+	if bp != nil && bp.sess != nil && bp.sess.nNight > 0 {
+		return bp.sess.sessionOpens(next)[0]
+	}
+	return LocalToDateTimeMs(next, 0, bp.location()).Unix()
+}
+
+// localBaseTime ... bar start time of t for period in local time loc
+//		Daily/Weekly/Monthly as UTC date of local day
+func localBaseTime(loc *time.Location, t int64, period Period) int64 {
+	_, off := time.Unix(t, 0).In(loc).Zone()
+	res, _ := periodBaseTime(t+int64(off), period)
+	if period >= Daily {
+		return res
+	}
+	return res - int64(off)
+}
+
+// localNextTime ... start time of next bar in local time loc
+func localNextTime(loc *time.Location, t int64, period Period) int64 {
+	_, off := time.Unix(t, 0).In(loc).Zone()
+	res := periodNextTime(t+int64(off), period)
+	if period >= Daily {
+		return res
+	}
+	return res - int64(off)
+}
+
+// getSessions ... trading sessions of symbol, nil for no session defined
+func getSessions(fKey SymbolKey) *marketSessions {
+	if si, err := fKey.SymbolInfo(); err == nil && si.symbolBase != nil {
+		return si.sess
+	}
+	return nil
+}
+
+// getLocation ... time zone of symbol, UTC if not defined
+func getLocation(fKey SymbolKey) *time.Location {
+	if si, err := fKey.SymbolInfo(); err == nil {
+		return si.Location()
+	}
+	return time.UTC
+}
+
+// barBaseTime ... bar start time of t, session aligned if sessions defined
+//		else aligned to local time of market
+func barBaseTime(fKey SymbolKey, t int64, period Period) int64 {
+	if ms := getSessions(fKey); ms != nil {
+		return ms.baseTime(t, period)
+	}
+	if loc := getLocation(fKey); loc != time.UTC {
+		return localBaseTime(loc, t, period)
+	}
+	res, _ := periodBaseTime(t, period)
+	return res
+}
+
+// barNextTime ... start time of next bar, session aligned if sessions defined
+//		else aligned to local time of market
+func barNextTime(fKey SymbolKey, t int64, period Period) int64 {
+	if ms := getSessions(fKey); ms != nil {
+		return ms.nextTime(t, period)
+	}
+	if loc := getLocation(fKey); loc != time.UTC {
+		return localNextTime(loc, t, period)
+	}
+	return periodNextTime(t, period)
+}
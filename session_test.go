@@ -0,0 +1,184 @@
+package ats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/kjx98/golib/julian"
+)
+
+func sessionBars(sym string, loc *time.Location, spans [][2]time.Time) *Bars {
+	si, _ := GetSymbolInfo(sym)
+	b := &Bars{symKey: si.fKey, period: Min1}
+	for _, sp := range spans {
+		for tt := sp[0]; tt.Before(sp[1]); tt = tt.Add(time.Minute) {
+			b.Date = append(b.Date, timeT64FromTime(tt))
+			b.Open = append(b.Open, 1)
+			b.High = append(b.High, 2)
+			b.Low = append(b.Low, 1)
+			b.Close = append(b.Close, 1.5)
+			b.Volume = append(b.Volume, 1)
+		}
+	}
+	return b
+}
+
+func barsLocalTime(b *Bars, loc *time.Location) (res []string) {
+	for _, d := range b.Date {
+		res = append(res, d.Time().In(loc).Format("01-02 15:04"))
+	}
+	return
+}
+
+func TestSessionReSample(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh600600")
+	newSymbolInfo("cu1905")
+	loc, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("no zoneinfo", err)
+	}
+	at := func(d, hh, mm int) time.Time {
+		return time.Date(2019, 3, d, hh, mm, 0, 0, loc)
+	}
+	// Friday 2019-03-08
+	sh := sessionBars("sh600600", loc, [][2]time.Time{{at(8, 9, 30), at(8, 11, 30)},
+		{at(8, 13, 0), at(8, 15, 0)}})
+	// night session Friday 2019-03-08, day session Monday 2019-03-11
+	cu := sessionBars("cu1905", loc, [][2]time.Time{{at(8, 21, 0), at(9, 1, 0)},
+		{at(11, 9, 0), at(11, 10, 15)}, {at(11, 10, 30), at(11, 11, 30)},
+		{at(11, 13, 30), at(11, 15, 0)}})
+	tests := []struct {
+		name   string
+		bars   *Bars
+		period Period
+		want   []string
+	}{
+		{"shHour1", sh, Hour1, []string{"03-08 09:30", "03-08 10:30", "03-08 13:00",
+			"03-08 14:00"}},
+		{"shHour2", sh, Hour2, []string{"03-08 09:30", "03-08 13:00"}},
+		{"shDaily", sh, Daily, []string{"03-08 08:00"}},
+		{"cuHour1", cu, Hour1, []string{"03-08 21:00", "03-08 22:00", "03-08 23:00",
+			"03-09 00:00", "03-11 09:00", "03-11 10:00", "03-11 11:15", "03-11 14:15"}},
+		{"cuDaily", cu, Daily, []string{"03-11 08:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := tt.bars.reSample(tt.period)
+			if err != nil {
+				t.Error("reSample", err)
+				return
+			}
+			if got := barsLocalTime(res, loc); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reSample() = %v, want %v", got, tt.want)
+			}
+			var vol float64
+			for _, v := range res.Volume {
+				vol += v
+			}
+			if int(vol) != len(tt.bars.Date) {
+				t.Errorf("volume %d, want %d", int(vol), len(tt.bars.Date))
+			}
+		})
+	}
+}
+
+func TestMarketSessions(t *testing.T) {
+	ms, err := newMarketSessions("Asia/Shanghai", []string{"21:00-01:00",
+		"09:00-10:15", "10:30-11:30", "13:30-15:00"})
+	if err != nil {
+		t.Skip("newMarketSessions", err)
+	}
+	if ms.nNight != 1 || ms.total != 465*60 {
+		t.Error("sessions diff", ms.nNight, ms.total)
+	}
+	if _, err := newMarketSessions("", []string{"9:00"}); err == nil {
+		t.Error("invalid session should fail")
+	}
+	at := func(d, hh, mm int) int64 {
+		return time.Date(2019, 3, d, hh, mm, 0, 0, ms.loc).Unix()
+	}
+	days := []struct {
+		t    int64
+		want julian.JulianDay
+	}{
+		{at(8, 10, 0), julian.NewJulianDay(2019, 3, 8)},
+		{at(7, 21, 30), julian.NewJulianDay(2019, 3, 8)},
+		{at(8, 21, 30), julian.NewJulianDay(2019, 3, 11)},
+		{at(9, 0, 30), julian.NewJulianDay(2019, 3, 11)},
+		{at(12, 0, 30), julian.NewJulianDay(2019, 3, 12)},
+	}
+	for _, d := range days {
+		if got := ms.tradingDay(d.t); got != d.want {
+			t.Errorf("tradingDay(%v) = %v, want %v", time.Unix(d.t, 0).In(ms.loc),
+				got, d.want)
+		}
+	}
+	nexts := []struct {
+		t      int64
+		period Period
+		want   int64
+	}{
+		{at(8, 10, 10), Min15, at(8, 10, 30)},
+		{at(8, 11, 20), Min30, at(8, 13, 45)},
+		{at(8, 14, 50), Min15, at(8, 21, 0)},
+		{at(9, 0, 50), Hour1, at(11, 9, 0)},
+		{at(8, 22, 10), Daily, time.Date(2019, 3, 12, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+	for _, n := range nexts {
+		if got := ms.nextTime(n.t, n.period); got != n.want {
+			t.Errorf("nextTime(%v, %s) = %v, want %v", time.Unix(n.t, 0).In(ms.loc),
+				n.period, time.Unix(got, 0).In(ms.loc), time.Unix(n.want, 0).In(ms.loc))
+		}
+	}
+}
+
+func TestMarketLocalTime(t *testing.T) {
+	initSymbols()
+	sh, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("LoadLocation", err)
+	}
+	at := func(d, hh, mm int) int64 {
+		return time.Date(2019, 3, d, hh, mm, 0, 0, sh).Unix()
+	}
+	tests := []struct {
+		name   string
+		market string
+		t      int64
+		day    julian.JulianDay
+		dayEnd int64
+	}{
+		{"SHSE", "SHSE", at(8, 10, 0), julian.NewJulianDay(2019, 3, 8), at(11, 0, 0)},
+		{"SHSE morning", "SHSE", at(8, 7, 0), julian.NewJulianDay(2019, 3, 8), at(11, 0, 0)},
+		{"SHFE day", "SHFE", at(8, 10, 0), julian.NewJulianDay(2019, 3, 8), at(8, 21, 0)},
+		{"SHFE night", "SHFE", at(8, 21, 30), julian.NewJulianDay(2019, 3, 11), at(11, 21, 0)},
+		{"UTC", "", at(8, 7, 0), julian.NewJulianDay(2019, 3, 7),
+			time.Date(2019, 3, 8, 0, 0, 0, 0, time.UTC).Unix()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := marketTradingDay(tt.market, tt.t); got != tt.day {
+				t.Errorf("marketTradingDay() = %v, want %v", got, tt.day)
+			}
+			if got := dayEndTime(tt.market, tt.t); got != tt.dayEnd {
+				t.Errorf("dayEndTime() = %v, want %v", time.Unix(got, 0).In(sh),
+					time.Unix(tt.dayEnd, 0).In(sh))
+			}
+		})
+	}
+	if si, err := GetSymbolInfo("sh600600"); err == nil && si.Location().String() != "Asia/Shanghai" {
+		t.Error("Location of sh600600", si.Location())
+	}
+	// Hour4 aligned to local midnight
+	if got := localBaseTime(sh, at(8, 10, 0), Hour4); got != at(8, 8, 0) {
+		t.Error("localBaseTime Hour4 diff", time.Unix(got, 0).In(sh))
+	}
+	if got := localBaseTime(sh, at(8, 7, 0), Daily); got != julian.NewJulianDay(2019, 3, 8).UTC().Unix() {
+		t.Error("localBaseTime Daily diff", time.Unix(got, 0).UTC())
+	}
+	if got := localNextTime(sh, at(8, 10, 0), Hour4); got != at(8, 12, 0) {
+		t.Error("localNextTime Hour4 diff", time.Unix(got, 0).In(sh))
+	}
+}
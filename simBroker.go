@@ -4,6 +4,7 @@ import (
 	"encoding/csv"
 	"errors"
 	"io"
+	"math"
 	"math/rand"
 	"os"
 	"runtime"
@@ -30,10 +31,16 @@ type account struct {
 	lossTrades int
 	profit     float64
 	loss       float64
+	hedging    bool   // long and short legs per symbol
+	currency   string // base currency, simCurrency for ""
+	openTrips  map[tripKey]*TradeType
+	roundTrips []TradeType
+	contPos    map[SymbolKey]int // qty of contract held by continuous symbol
 
 	evChan chan<- QuoteEvent
 	orders []int
 	pos    map[SymbolKey]*PositionType
+	deals  []DealType
 }
 
 // order struct for simulation
@@ -42,6 +49,7 @@ type simOrderType struct {
 	simBroker
 	oid   int
 	price int32
+	cont  bool // sent by continuous symbol, mapped to active contract
 	OrderType
 }
 
@@ -157,6 +165,11 @@ type simTicker interface {
 	TickValue() (bid, ask, last int32, vol uint32)
 }
 
+// quoteTicker ... simTicker with recorded Quotes, published as recorded
+type quoteTicker interface {
+	TickQuotes() Quotes
+}
+
 func bidCompare(a, b interface{}) int {
 	ora, ok := a.(*simOrderType)
 	// maybe panic, if not simOrderType
@@ -212,6 +225,23 @@ var defaultFund = float64(1e6)
 var startTime, endTime timeT64
 var simPeriod Period
 
+// simPeriods bar periods subscribed, emit events while bars closed
+var simPeriods []Period
+
+// simBarSpecs non-time bars subscribed, built from ticks
+var simBarSpecs []BarSpec
+
+// simAdjusted sim data adjusted, corporate actions not applied
+var simAdjusted bool
+
+// simMarket calendar and time zone of sim, day rotation and Daily bars
+//	at end of trading day of market
+var simMarket string
+
+// simCurrency base currency of sim accounts, "" for P&L in currency of
+//	instruments without conversion, cross pairs must be loaded for Start
+var simCurrency string
+
 // current time DateTimeMs of sim Run VM
 var simCurrent DateTimeMs
 var simVmLock sync.RWMutex
@@ -227,7 +257,13 @@ var simStatus int32
 var onceLoad sync.Once
 
 // simSymbolQ symbol fKey map
-var simSymbolsQ = map[SymbolKey]*Quotes{}
+var simSymbolsQ = map[SymbolKey]*QuoteSnap{}
+
+// simSymbolsDepth symbol fKey map to subscribed DepthSnap
+var simSymbolsDepth = map[SymbolKey]*DepthSnap{}
+
+// simDepthLevels levels of depth walked by simMatchOrder
+var simDepthLevels = DefDepthLevels
 
 // orderBook map with symbol key
 var simOrderBook = map[string]orderBook{}
@@ -246,6 +282,8 @@ var (
 	errTickOrder    = errors.New("Tick Data order error")
 	errNoOrder      = errors.New("No such order")
 	errCancelOrder  = errors.New("can't cancel,canceled or filled")
+	errNoAvailable  = errors.New("Sell over available position")
+	errPriceLimit   = errors.New("Price out of daily limits")
 )
 
 // InitSimBroker ... set default fund, startTime, endTime  etc
@@ -327,10 +365,23 @@ func dumpSimBroker() {
 			"win/loss(%d/%d) Profit/Loss(%.3f/%.3f)", int(k), acct.fundStart, acct.fund,
 			acct.trades, len(acct.orders), acct.winTrades, acct.lossTrades,
 			acct.profit, acct.loss)
+		if acct.fundStart > 0 {
+			ret := acct.fund/acct.fundStart - 1
+			log.Infof("SimBroker(%d) return %.2f%% annualized %.2f%%", int(k), ret*100,
+				AnnualizedReturn(simMarket, ret,
+					marketTradingDay(simMarket, startTime.Unix()),
+					marketTradingDay(simMarket, simCurrent.Unix()))*100)
+		}
 		for fk, pp := range acct.pos {
 			si, _ := fk.SymbolInfo()
-			log.Infof("simBroker(%d) position(%s) %d avrPrice(%.3f)", int(k), si.Ticker,
-				pp.Positions, pp.AvgPrice)
+			log.Infof("simBroker(%d) position(%s) %d avrPrice(%.3f) P&L(%.3f/%.3f) "+
+				"MFE/MAE(%.3f/%.3f) fees(%.3f)", int(k), si.Ticker, pp.Positions,
+				pp.AvgPrice, pp.Realized, pp.Unrealized, pp.MFE, pp.MAE, pp.Fees)
+		}
+		for sym, st := range TradeStats(acct.roundTrips) {
+			log.Infof("simBroker(%d) %s trades(%d) win(%d) profit(%.3f) "+
+				"MFE/MAE(%.3f/%.3f) holding(%v)", int(k), sym, st.Trades, st.Wins,
+				st.Profit, st.AvgMFE, st.AvgMAE, st.AvgHolding)
 		}
 	}
 }
@@ -415,6 +466,14 @@ func simLoadSymbols() {
 							// try load ticks for Non FX
 						}
 					}
+					if strings.Contains(line[1], "r") {
+						// replay recorded ticks
+						if res, err := LoadReplayTick(line[0], "", st, dt); err == nil {
+							simTickMap[si.FastKey()] = res
+							bNeedForge = false
+							log.Infof("Load %s recorded ticks %d", line[0], res.Len())
+						}
+					}
 					if strings.Contains(line[1], "m") {
 						// loadMindata
 						if si.IsForex {
@@ -630,9 +689,23 @@ func (b simBroker) Start(c Config) error {
 	//maxSysHeap = 0
 	//timeAtMaxAlloc = 0
 	atomic.StoreInt32(&simStatus, VmStart)
+	simAdjusted = c.GetInt("AdjustedData", 0) != 0
+	simMarket = c.GetString("Market", "")
+	simCurrency = c.GetString("Currency", "")
+	if c.GetInt("Hedging", 0) != 0 {
+		for bb := range simAccounts {
+			if err := bb.SetHedging(true); err != nil {
+				log.Warningf("SimBroker(%d) hedging: %s", int(bb), err)
+			}
+		}
+	}
 	// load Bars
 	// build ticks
 	simLoadSymbols()
+	if err := simCheckCurrency(); err != nil {
+		atomic.StoreInt32(&simStatus, VmIdle)
+		return err
+	}
 	startMs := DateTimeMs(0)
 	msStart := startTime.DateTimeMs()
 	//msEnd := endTime.DateTimeMs()
@@ -683,18 +756,28 @@ func simDoTickLoop() {
 	if endTime.Unix() != 0 {
 		msEnd = endTime.DateTimeMs()
 	}
-	nextPeriod, _ := periodBaseTime(simCurrent.Unix(), simPeriod)
-	nextPeriod += int64(simPeriod)
-	nextDay, _ := periodBaseTime(simCurrent.Unix(), Daily)
-	nextDay += int64(Daily)
+	// base period of sim data and subscribed periods
+	barT := newMarketBarTimer(simMarket, []Period{simPeriod, Daily}, simCurrent.Unix())
+	for _, p := range simPeriods {
+		if p >= simPeriod {
+			barT.add(p)
+		}
+	}
+	barT.reset(simCurrent.Unix())
+	nextDay := dayEndTime(simMarket, simCurrent.Unix())
+	simLoc := getMarketBase(simMarket).location()
 	if len(simTickRun) == 0 {
 		log.Info("Empty simTickRun, status to Idle")
 	} else {
-		log.Info("simStart:", simCurrent, " --> simEnd:", msEnd)
+		log.Info("simStart:", simCurrent.StringIn(simLoc), " --> simEnd:",
+			msEnd.StringIn(simLoc))
 		log.Info("number of Subscribed quote:", len(simSymbolsQ))
 	}
+	// subscribed symbols ticked at simCurrent
+	var ticked []string
 	for len(simTickRun) > 0 && atomic.LoadInt32(&simStatus) == VmRunning {
 		msNext := DateTimeMs(0)
+		ticked = ticked[:0]
 		for k, v := range simTickRun {
 			var ticker string
 			var si *SymbolInfo
@@ -709,11 +792,14 @@ func simDoTickLoop() {
 				totalTicks++
 				// should update quote & Bars
 				simUpdateQuote(si, v)
+				simUpdateDepth(si, v)
+				simUpdateAltBars(si, v)
 				// shall emit Min1/Min5 event?
 				// process OrderBook
 				simMatchOrder(si, v)
-				// emit a tick
-				//simEmitEvent(QuoteEvent{Symbol: ticker, EventID: 0})
+				if _, ok := simSymbolsQ[k]; ok {
+					ticked = append(ticked, ticker)
+				}
 				// move to next
 				if err := v.Next(); err != nil {
 					log.Infof("delete simTickRun for symbol(%s) EOF", ticker)
@@ -727,18 +813,21 @@ func simDoTickLoop() {
 
 		}
 		simCurrent = msNext
-		if simCur := simCurrent.Unix(); simCur >= nextPeriod {
-			nextPeriod, _ = periodBaseTime(simCur, simPeriod)
-			nextPeriod += int64(simPeriod)
-			simEmitEvents(QuoteEvent{EventID: int(simPeriod)})
-			if simCur > nextDay {
-				totalDays++
-				simDayRotate()
-				nextDay, _ = periodBaseTime(simCur, Daily)
-				nextDay += int64(Daily)
-				simEmitEvents(QuoteEvent{EventID: int(Daily)})
+		simCur := simCurrent.Unix()
+		if simPeriod == 0 {
+			// tick data, emit a tick for symbols ticked only
+			for _, ticker := range ticked {
+				simEmitEvents(QuoteEvent{Symbol: ticker, EventID: 0})
 			}
 		}
+		for _, p := range barT.closed(simCur) {
+			simEmitEvents(QuoteEvent{EventID: int(p)})
+		}
+		if simCur >= nextDay {
+			totalDays++
+			simDayRotate()
+			nextDay = dayEndTime(simMarket, simCur)
+		}
 		if msEnd != 0 && msNext > msEnd {
 			break
 		}
@@ -761,25 +850,69 @@ func simDoTickLoop() {
 
 func simUpdateQuote(si *SymbolInfo, tick simTicker) {
 	if qq, ok := simSymbolsQ[si.FastKey()]; ok {
-		qq.UpdateTime = simCurrent
-		bid, ask, last, vol := tick.TickValue()
-		if si.IsForex {
-			last = bid
-		}
-		fBid := float64(bid) * si.Divi()
-		fAsk := float64(ask) * si.Divi()
-		fLast := float64(last) * si.Divi()
-		qq.Bid, qq.Ask, qq.Last = fBid, fAsk, fLast
-		qq.Volume += int64(vol)
-		if qq.TodayOpen == 0 {
-			qq.TodayOpen = fLast
-		}
-		if qq.TodayHigh < fLast {
-			qq.TodayHigh = fLast
-		}
-		if qq.TodayLow == 0 || qq.TodayLow > fLast {
-			qq.TodayLow = fLast
+		if qt, ok := tick.(quoteTicker); ok {
+			qq.Store(qt.TickQuotes())
+			return
 		}
+		qq.Update(func(q *Quotes) { updateQuoteTick(q, si, tick, simCurrent) })
+	}
+}
+
+// simUpdateDepth ... publish subscribed depth and emit depth event
+func simUpdateDepth(si *SymbolInfo, tick simTicker) {
+	d, ok := simSymbolsDepth[si.FastKey()]
+	if !ok {
+		return
+	}
+	dt, ok := tick.(depthTicker)
+	if !ok {
+		return
+	}
+	if tk := dt.TickDepth(); tk != nil {
+		d.storeTickExt(si, tk, simCurrent)
+		simEmitOneEvent(QuoteEvent{Symbol: si.Ticker, EventID: EventDepth})
+	}
+}
+
+// simUpdateAltBars ... build non-time bars of subscribed symbol with tick,
+//		emit bar events for bars closed
+func simUpdateAltBars(si *SymbolInfo, tick simTicker) {
+	if len(simBarSpecs) == 0 {
+		return
+	}
+	if _, ok := simSymbolsQ[si.FastKey()]; !ok {
+		return
+	}
+	bid, _, last, vol := tick.TickValue()
+	if si.IsForex {
+		last = bid
+	}
+	as := getAltBarSet(si, simBarSpecs)
+	for _, p := range as.onTick(simCurrent.Unix(), float64(last)*si.Divi(), float64(vol)) {
+		simEmitOneEvent(QuoteEvent{Symbol: si.Ticker, EventID: int(p)})
+	}
+}
+
+// updateQuoteTick ... update quotes with current tick of simTicker
+func updateQuoteTick(qq *Quotes, si *SymbolInfo, tick simTicker, curT DateTimeMs) {
+	qq.UpdateTime = curT
+	bid, ask, last, vol := tick.TickValue()
+	if si.IsForex {
+		last = bid
+	}
+	fBid := float64(bid) * si.Divi()
+	fAsk := float64(ask) * si.Divi()
+	fLast := float64(last) * si.Divi()
+	qq.Bid, qq.Ask, qq.Last = fBid, fAsk, fLast
+	qq.Volume += int64(vol)
+	if qq.TodayOpen == 0 {
+		qq.TodayOpen = fLast
+	}
+	if qq.TodayHigh < fLast {
+		qq.TodayHigh = fLast
+	}
+	if qq.TodayLow == 0 || qq.TodayLow > fLast {
+		qq.TodayLow = fLast
 	}
 }
 
@@ -788,6 +921,29 @@ func simUpdateAcctPos(si *SymbolInfo, or *simOrderType, last int32, vol int) (pr
 		return
 	}
 	acct := simAccounts[or.simBroker]
+	fLast := float64(last) * si.Divi()
+	profit = acct.updatePos(si, or.Dir, fLast, vol)
+	if or.cont {
+		acct.addContPos(si.fKey, or.Dir.Sign()*vol)
+	}
+	acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: si.Ticker,
+		Dir: or.Dir, Qty: vol, Price: fLast, Profit: profit, Oid: or.oid})
+	return
+}
+
+// addContPos ... add signed qty of contract traded by continuous symbol
+func (acct *account) addContPos(fKey SymbolKey, qty int) {
+	if acct.contPos == nil {
+		acct.contPos = map[SymbolKey]int{}
+	}
+	if acct.contPos[fKey] += qty; acct.contPos[fKey] == 0 {
+		delete(acct.contPos, fKey)
+	}
+}
+
+// updatePos ... update position of account with filled volume at fLast
+//		return profit for close offset in base currency
+func (acct *account) updatePos(si *SymbolInfo, dir OrderDirT, fLast float64, vol int) (profit float64) {
 	acct.trades++
 	var pos *PositionType
 	if po, ok := acct.pos[si.FastKey()]; ok {
@@ -796,99 +952,215 @@ func simUpdateAcctPos(si *SymbolInfo, or *simOrderType, last int32, vol int) (pr
 		pos = &PositionType{fKey: si.FastKey()}
 		acct.pos[si.FastKey()] = pos
 	}
-	fLast := float64(last) * si.Divi()
-	switch or.Dir.Sign() {
-	case 1: // for buy
-		if pos.Positions >= 0 {
-			// increase position
-			avg := pos.AvgPrice*float64(pos.Positions) + fLast*float64(vol)
-			pos.Positions += vol
-			pos.AvgPrice = avg / float64(pos.Positions)
-		} else {
-			// close offset
-			profit = si.CalcProfit(pos.AvgPrice, fLast, -vol)
-			pos.Positions += vol
-			acct.fund += profit
-			acct.balance += profit
-			if profit >= 0 {
-				acct.profit += profit
-				acct.winTrades++
-			} else {
-				acct.loss += profit
-				acct.lossTrades++
-			}
+	wasFlat := len(pos.legs()) == 0
+	if acct.hedging {
+		profit = acct.updateLeg(si, pos, dir, fLast, vol)
+	} else {
+		profit = acct.updateNet(si, pos, dir, fLast, vol)
+	}
+	pos.Realized += profit
+	pos.markPx = 0
+	if len(pos.legs()) == 0 {
+		pos.Unrealized = 0
+	} else if wasFlat {
+		pos.OpenTime = simCurrent
+		pos.Unrealized, pos.MFE, pos.MAE = 0, 0, 0
+	}
+	return
+}
+
+// updateNet ... update net position, offset of opposite position first
+//		then remain volume open reversed position
+func (acct *account) updateNet(si *SymbolInfo, pos *PositionType, dir OrderDirT, fLast float64, vol int) (profit float64) {
+	sign := dir.Sign()
+	closed := 0
+	if pos.Positions*sign < 0 {
+		closed = vol
+		if n := pos.Positions * -sign; n < closed {
+			closed = n
 		}
-	case -1: // for sell
-		if pos.Positions <= 0 {
-			// increase position
-			avg := pos.AvgPrice*float64(-pos.Positions) + fLast*float64(vol)
-			pos.Positions -= vol
-			pos.AvgPrice = avg / float64(-pos.Positions)
-		} else {
-			// close offset
-			profit = si.CalcProfit(pos.AvgPrice, fLast, vol)
-			pos.Positions -= vol
-			acct.fund += profit
-			acct.balance += profit
-			if profit >= 0 {
-				acct.profit += profit
-				acct.winTrades++
-			} else {
-				acct.loss += profit
-				acct.lossTrades++
+	}
+	if closed > 0 {
+		// close offset
+		profit = acct.toBase(si, si.CalcProfit(pos.AvgPrice, fLast, -sign*closed))
+		pos.Positions += sign * closed
+		if pos.PosFreeze > pos.Positions {
+			pos.PosFreeze = pos.Positions
+			if pos.PosFreeze < 0 {
+				pos.PosFreeze = 0
 			}
 		}
-	default:
-		// should be error
+		acct.realize(profit)
+		acct.tradeClose(si, -sign, closed, fLast, profit, pos.Positions == 0)
+	}
+	if opened := vol - closed; opened > 0 {
+		// increase position
+		n := pos.Positions * sign
+		avg := pos.AvgPrice*float64(n) + fLast*float64(opened)
+		pos.Positions += sign * opened
+		pos.AvgPrice = avg / float64(n+opened)
+		if sign > 0 && si.SettleT1 {
+			// T+1, bought today frozen till next trading day
+			pos.PosFreeze += opened
+		}
+		acct.tradeOpen(si, sign, opened, fLast)
 	}
 	return
 }
 
+// realize ... realized profit of offset to fund and balance
+func (acct *account) realize(profit float64) {
+	acct.fund += profit
+	acct.balance += profit
+	if profit >= 0 {
+		acct.profit += profit
+		acct.winTrades++
+	} else {
+		acct.loss += profit
+		acct.lossTrades++
+	}
+}
+
 var simLogMatchs int
 
 func simMatchOrder(si *SymbolInfo, tick simTicker) {
 	setFill := func(or *simOrderType, last int32, vol int) {
-		or.OrderType.QtyFilled = or.OrderType.Qty
-		vol = or.OrderType.Qty
-		or.OrderType.Status = OrderFilled
-		or.DoneTime = simCurrent
+		if left := or.OrderType.Qty - or.OrderType.QtyFilled; vol <= 0 || vol > left {
+			vol = left
+		}
+		fLast := float64(last) * si.Divi()
+		or.OrderType.AvgPrice = (or.OrderType.AvgPrice*float64(or.OrderType.QtyFilled) +
+			fLast*float64(vol)) / float64(or.OrderType.QtyFilled+vol)
+		or.OrderType.QtyFilled += vol
+		if or.OrderType.QtyFilled >= or.OrderType.Qty {
+			or.OrderType.Status = OrderFilled
+			or.DoneTime = simCurrent
+		} else {
+			or.OrderType.Status = OrderPartFilled
+		}
 		pl := simUpdateAcctPos(si, or, last, vol)
 		simLogMatchs++
 		if simLogMatchs <= 10 {
-			log.Infof("Filled No:%d %s %d %s %g %d P&L(%.3f) via broker(%d)", or.oid, or.Symbol,
-				or.price, or.Dir, or.Price, or.Qty, pl, int(or.simBroker))
+			log.Infof("Filled No:%d %s %d %s %g %d/%d P&L(%.3f) via broker(%d)", or.oid,
+				or.Symbol, or.price, or.Dir, or.Price, vol, or.Qty, pl, int(or.simBroker))
 		}
 	}
-	if orB, ok := simOrderBook[si.Ticker]; ok {
-		bid, ask, last, vol := tick.TickValue()
-		if si.IsForex {
-			last = ask
-		}
-		iter := orB.bids.Iterator(avl.Forward)
-		for node := iter.First(); node != nil; node = iter.Next() {
-			v := node.Value.(*simOrderType)
-			if v.price >= last {
-				// match
-				setFill(v, last, int(vol))
-				orB.bids.Remove(node)
-			} else {
-				break
-			}
+	if bid, ask, last, _ := tick.TickValue(); last > 0 {
+		simMarkPositions(si, float64(last)*si.Divi())
+	} else if bid > 0 && ask > 0 {
+		simMarkPositions(si, float64(bid+ask)/2*si.Divi())
+	}
+	orB, ok := simOrderBook[si.Ticker]
+	if !ok {
+		return
+	}
+	// locked at limit up/down, no fills of locked side except volume
+	// traded at limit price
+	var lockBuy, lockSell bool
+	if upper, lower := si.limits(); !si.IsForex && upper > 0 {
+		_, _, last, vol := tick.TickValue()
+		fill := func(v *simOrderType, n int) { setFill(v, last, n) }
+		if upI := int32(math.Floor(upper*si.Multi() + 0.5)); last >= upI {
+			lockBuy = true
+			simLockedFill(orB.bids, int(vol), func(p int32) bool {
+				return p == 0 || p >= last
+			}, fill)
+		} else if loI := int32(math.Floor(lower*si.Multi() + 0.5)); last > 0 && last <= loI {
+			lockSell = true
+			simLockedFill(orB.asks, int(vol), func(p int32) bool {
+				return p <= last
+			}, fill)
 		}
-		if si.IsForex {
-			last = bid
-		}
-		iter = orB.asks.Iterator(avl.Forward)
-		for node := iter.First(); node != nil; node = iter.Next() {
-			v := node.Value.(*simOrderType)
-			if v.price <= last {
-				// match
-				setFill(v, last, int(vol))
-				orB.asks.Remove(node)
-			} else {
-				break
+	}
+	var tkD *TickExt
+	if dt, ok := tick.(depthTicker); ok {
+		tkD = dt.TickDepth()
+	}
+	if tkD != nil {
+		// walk depth levels, large order may partial filled
+		asks := tickExtLevels(tkD.Ask, tkD.AskDepth, tkD.AskVol, tkD.AsksVol, simDepthLevels)
+		bids := tickExtLevels(tkD.Bid, tkD.BidDepth, tkD.BidVol, tkD.BidsVol, simDepthLevels)
+		walk := func(tr *avl.Tree, lv []depthLevel, match func(p, lp int32) bool) {
+			iter := tr.Iterator(avl.Forward)
+			for node := iter.First(); node != nil && len(lv) > 0; node = iter.Next() {
+				v := node.Value.(*simOrderType)
+				for len(lv) > 0 && v.Qty > v.QtyFilled && match(v.price, lv[0].price) {
+					vol := v.Qty - v.QtyFilled
+					if int64(vol) > lv[0].vol {
+						vol = int(lv[0].vol)
+					}
+					setFill(v, lv[0].price, vol)
+					if lv[0].vol -= int64(vol); lv[0].vol <= 0 {
+						lv = lv[1:]
+					}
+				}
+				if v.Qty > v.QtyFilled {
+					break
+				}
+				tr.Remove(node)
 			}
 		}
+		// price 0 for market order
+		if !lockBuy {
+			walk(orB.bids, asks, func(p, lp int32) bool { return p == 0 || p >= lp })
+		}
+		if !lockSell {
+			walk(orB.asks, bids, func(p, lp int32) bool { return p <= lp })
+		}
+		return
+	}
+	bid, ask, last, _ := tick.TickValue()
+	if si.IsForex {
+		last = ask
+	}
+	iter := orB.bids.Iterator(avl.Forward)
+	for node := iter.First(); node != nil && !lockBuy; node = iter.Next() {
+		v := node.Value.(*simOrderType)
+		// price 0 for market order
+		if v.price == 0 || v.price >= last {
+			// match
+			setFill(v, last, 0)
+			orB.bids.Remove(node)
+		} else {
+			break
+		}
+	}
+	if si.IsForex {
+		last = bid
+	}
+	iter = orB.asks.Iterator(avl.Forward)
+	for node := iter.First(); node != nil && !lockSell; node = iter.Next() {
+		v := node.Value.(*simOrderType)
+		if v.price <= last {
+			// match
+			setFill(v, last, 0)
+			orB.asks.Remove(node)
+		} else {
+			break
+		}
+	}
+}
+
+// simLockedFill ... fill matched orders of tree at locked limit price,
+//		only vol traded at limit price, in price/time priority
+func simLockedFill(tr *avl.Tree, vol int, match func(p int32) bool,
+	fill func(v *simOrderType, n int)) {
+	iter := tr.Iterator(avl.Forward)
+	for node := iter.First(); node != nil && vol > 0; node = iter.Next() {
+		v := node.Value.(*simOrderType)
+		if !match(v.price) {
+			break
+		}
+		n := v.Qty - v.QtyFilled
+		if n > vol {
+			n = vol
+		}
+		fill(v, n)
+		vol -= n
+		if v.Qty > v.QtyFilled {
+			break
+		}
+		tr.Remove(node)
 	}
 }
 
@@ -916,19 +1188,347 @@ func simEmitOneEvent(ev QuoteEvent) {
 }
 
 func simDayRotate() {
-	for fk, qq := range simSymbolsQ {
-		la := qq.Last
-		*qq = Quotes{}
-		qq.Pclose = la
-		qq.UpdateTime = simCurrent
-		if si, err := fk.SymbolInfo(); err == nil {
-			var ev = QuoteEvent{Symbol: si.Ticker, EventID: int(Daily)}
-			// emit event
-			simEmitOneEvent(ev)
+	day := marketTradingDay(simMarket, simCurrent.Unix())
+	for fKey, qq := range simSymbolsQ {
+		qq.dayRotate(simCurrent)
+		si, err := fKey.SymbolInfo()
+		if err != nil {
+			continue
+		}
+		// limits of previous day not applied to ex-date price
+		si.setDailyLimits(0)
+		if ca, ok := corpActionOn(si.Ticker, day); ok && !simAdjusted {
+			// ex-date reference price as Pclose
+			qq.Update(func(q *Quotes) {
+				if q.Pclose > 0 {
+					q.Pclose = si.PriceNormal(ca.exPrice(q.Pclose))
+				}
+			})
+		}
+		si.setDailyLimits(qq.Load().Pclose)
+	}
+	if !simAdjusted {
+		simCorpActions(day)
+	}
+	simContRolls(day)
+	simExpiryCloses(day)
+	simBorrowFees(day)
+	simSwaps(day)
+	simSettle()
+}
+
+// simSettle ... unfreeze T+1 positions bought before new trading day,
+//		legs opened today of hedging account opened before
+func simSettle() {
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	for _, acct := range simAccounts {
+		for _, pos := range acct.pos {
+			pos.PosFreeze = 0
+			pos.Long.Today = 0
+			pos.Short.Today = 0
+		}
+	}
+}
+
+// availableToSell ... long position of symbol available to sell, T+1
+//		frozen and pending sell orders excluded, caller hold simVmLock
+func (acct *account) availableToSell(si *SymbolInfo) int {
+	avail, _ := acct.sellPosition(si)
+	return avail
+}
+
+// sellPosition ... long position available to sell and net position
+//		after pending sell orders, caller hold simVmLock
+func (acct *account) sellPosition(si *SymbolInfo) (avail, net int) {
+	acctLock.RLock()
+	if pos, ok := acct.pos[si.fKey]; ok {
+		net = pos.Positions
+		if pos.Positions > 0 {
+			avail = pos.Positions - pos.PosFreeze
+		}
+	}
+	acctLock.RUnlock()
+	for _, oid := range acct.orders {
+		or, ok := simOrders[oid]
+		if !ok || or.Symbol != si.Ticker || or.Dir.Sign() >= 0 {
+			continue
+		}
+		switch or.Status {
+		case OrderAccept, OrderPartFilled:
+			avail -= or.Qty - or.QtyFilled
+			net -= or.Qty - or.QtyFilled
+		}
+	}
+	return
+}
+
+// checkSell ... verify sell order of qty, T+1 long sold within available
+//		and never cross to short, short over long by short mode of template
+func (acct *account) checkSell(si *SymbolInfo, qty int) error {
+	if !si.SettleT1 && si.ShortMode == ShortFree {
+		return nil
+	}
+	avail, net := acct.sellPosition(si)
+	if qty <= avail {
+		return nil
+	}
+	if si.SettleT1 && net > 0 {
+		return errNoAvailable
+	}
+	// short position after order
+	return si.checkShort(qty - net)
+}
+
+// simExpiryCloses ... force close positions of contracts expired before
+//		day at settlement price, close of last trading day, pending
+//		orders of expired contracts canceled
+func simExpiryCloses(day julian.JulianDay) {
+	simVmLock.Lock()
+	for _, or := range simOrders {
+		switch or.Status {
+		case OrderFilled, OrderCanceled:
+			continue
+		}
+		si, err := GetSymbolInfo(or.Symbol)
+		if err != nil {
+			continue
+		}
+		if lt := si.LastTradeDay(day); lt != 0 && lt < day {
+			simRemoveOrder(or)
+			or.Status = OrderCanceled
+			or.DoneTime = simCurrent
+		}
+	}
+	simVmLock.Unlock()
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	for _, acct := range simAccounts {
+		for fKey, pos := range acct.pos {
+			if len(pos.legs()) == 0 {
+				continue
+			}
+			si, err := fKey.SymbolInfo()
+			if err != nil {
+				continue
+			}
+			if lt := si.LastTradeDay(day); lt == 0 || lt >= day {
+				continue
+			}
+			settleP := pos.AvgPrice
+			if qq, ok := simSymbolsQ[fKey]; ok {
+				if q := qq.Load(); q.Pclose > 0 {
+					settleP = q.Pclose
+				}
+			}
+			for _, leg := range pos.legs() {
+				acct.expiryClose(si, leg.qty, settleP)
+			}
+		}
+	}
+}
+
+// expiryClose ... close position of expired contract at settlement price
+func (acct *account) expiryClose(si *SymbolInfo, qty int, settleP float64) {
+	dir := OrderDirClose
+	if qty < 0 {
+		dir = OrderDirCover
+		qty = -qty
+	}
+	profit := acct.updatePos(si, dir, settleP, qty)
+	acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: si.Ticker,
+		Dir: dir, Qty: qty, Price: settleP, Profit: profit, Oid: -1,
+		Reason: "expiry"})
+	log.Infof("expiry close %d %s@%g", qty, si.Ticker, settleP)
+}
+
+// simContRolls ... roll positions of contracts of continuous futures
+//		rolled on day, close old contract and open new at closes of
+//		trading day before roll
+func simContRolls(day julian.JulianDay) {
+	var rolls []contRoll
+	contLock.Lock()
+	for _, cs := range contSeriesMap {
+		if !cs.built && cs.build() != nil {
+			continue
+		}
+		for _, r := range cs.rolls {
+			if r.day == day {
+				rolls = append(rolls, r)
+			}
+		}
+	}
+	contLock.Unlock()
+	if len(rolls) == 0 {
+		return
+	}
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	for _, r := range rolls {
+		from, err1 := r.from.SymbolInfo()
+		to, err2 := r.to.SymbolInfo()
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for _, acct := range simAccounts {
+			acct.rollCont(from, to, r.fromP, r.toP)
+		}
+	}
+}
+
+// rollCont ... roll position of contract from held by continuous symbol,
+//		position opened by contract itself kept
+func (acct *account) rollCont(from, to *SymbolInfo, fromP, toP float64) {
+	cq := acct.contPos[from.fKey]
+	pos, ok := acct.pos[from.fKey]
+	if cq == 0 || !ok {
+		return
+	}
+	for _, leg := range pos.legs() {
+		qty := leg.qty
+		if qty*cq <= 0 {
+			continue
+		}
+		if abs(qty) > abs(cq) {
+			qty = cq
+		}
+		acct.rollPos(from, to, qty, fromP, toP)
+		acct.addContPos(from.fKey, -qty)
+		acct.addContPos(to.fKey, qty)
+		cq -= qty
+	}
+	// rest closed by contract itself
+	delete(acct.contPos, from.fKey)
+}
+
+// rollPos ... close qty of contract from and open same of contract to,
+//		deals of roll in journal
+func (acct *account) rollPos(from, to *SymbolInfo, qty int, fromP, toP float64) {
+	closeDir, openDir := OrderDirClose, OrderDirBuy
+	if qty < 0 {
+		closeDir, openDir = OrderDirCover, OrderDirSell
+		qty = -qty
+	}
+	profit := acct.updatePos(from, closeDir, fromP, qty)
+	acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: from.Ticker,
+		Dir: closeDir, Qty: qty, Price: fromP, Profit: profit, Oid: -1,
+		Reason: "roll"})
+	acct.updatePos(to, openDir, toP, qty)
+	acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: to.Ticker,
+		Dir: openDir, Qty: qty, Price: toP, Oid: -1, Reason: "roll"})
+	log.Infof("roll %d %s@%g to %s@%g", qty, from.Ticker, fromP, to.Ticker, toP)
+}
+
+// simCorpActions ... apply corporate actions on ex-date to positions of
+//		all accounts, cash dividend credited, shares of bonus/split added
+//		rights never subscribed
+func simCorpActions(day julian.JulianDay) {
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	for _, acct := range simAccounts {
+		for fKey, pos := range acct.pos {
+			if pos.Positions == 0 {
+				continue
+			}
+			si, err := fKey.SymbolInfo()
+			if err != nil {
+				continue
+			}
+			if ca, ok := corpActionOn(si.Ticker, day); ok {
+				acct.applyCorpAction(si, pos, &ca)
+			}
+		}
+	}
+}
+
+// applyCorpAction ... apply corporate action to position, cost kept
+func (acct *account) applyCorpAction(si *SymbolInfo, pos *PositionType, ca *CorpAction) {
+	if ca.Cash != 0 {
+		cash := acct.toBase(si, si.CalcProfit(0, ca.Cash, pos.Positions))
+		acct.fund += cash
+		acct.balance += cash
+		acct.equity += cash
+		acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: si.Ticker,
+			Dir: corpDir(pos.Positions), Qty: abs(pos.Positions), Price: ca.Cash,
+			Profit: cash, Oid: -1, Reason: "dividend"})
+		log.Infof("%s dividend %.2f for %d shares", si.Ticker, cash, pos.Positions)
+	}
+	if f := ca.shareFactor(); f != 1 {
+		newPos := int(math.Floor(float64(pos.Positions) * f))
+		if pos.Positions < 0 {
+			newPos = -int(math.Floor(float64(-pos.Positions) * f))
+		}
+		if newPos != 0 {
+			pos.AvgPrice *= float64(pos.Positions) / float64(newPos)
 		}
+		pos.PosFreeze = int(math.Floor(float64(pos.PosFreeze) * f))
+		log.Infof("%s shares %d to %d", si.Ticker, pos.Positions, newPos)
+		acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: si.Ticker,
+			Dir: corpDir(pos.Positions), Qty: abs(newPos - pos.Positions), Price: f,
+			Oid: -1, Reason: "split"})
+		pos.Positions = newPos
+		pos.markPx = 0
 	}
 }
 
+// corpDir ... direction of deal of corporate action for position
+func corpDir(qty int) OrderDirT {
+	if qty < 0 {
+		return OrderDirSell
+	}
+	return OrderDirBuy
+}
+
+// simBorrowFees ... charge borrow fee of short positions on borrowed
+//		shares, annual rate on short market value of previous close,
+//		calendar days since previous trading day by 360 days a year
+func simBorrowFees(day julian.JulianDay) {
+	days := day.Sub(PrevTradingDay(simMarket, day))
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	for _, acct := range simAccounts {
+		for fKey, pos := range acct.pos {
+			short := 0
+			for _, leg := range pos.legs() {
+				if leg.qty < 0 {
+					short = -leg.qty
+				}
+			}
+			if short == 0 {
+				continue
+			}
+			si, err := fKey.SymbolInfo()
+			if err != nil {
+				continue
+			}
+			rate := si.borrowRate()
+			if rate <= 0 {
+				continue
+			}
+			price := pos.AvgPrice
+			if qq, ok := simSymbolsQ[fKey]; ok {
+				if q := qq.Load(); q.Pclose > 0 {
+					price = q.Pclose
+				}
+			}
+			acct.borrowFee(si, short, price, rate*float64(days)/360)
+		}
+	}
+}
+
+// borrowFee ... charge fee of short qty at price by rate of days
+func (acct *account) borrowFee(si *SymbolInfo, qty int, price, rate float64) {
+	fee := acct.toBase(si, si.CalcProfit(0, price, qty)*rate)
+	acct.fund -= fee
+	acct.balance -= fee
+	acct.equity -= fee
+	acct.addFee(si, -1, fee)
+	acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: si.Ticker,
+		Dir: OrderDirSell, Qty: qty, Price: price, Profit: -fee, Oid: -1,
+		Reason: "borrow"})
+	log.Infof("%s borrow fee %.2f for %d shares", si.Ticker, fee, qty)
+}
+
 func simEmitEvents(ev QuoteEvent) {
 	if ev.Symbol != "" {
 		// emit one event
@@ -976,14 +1576,65 @@ func (b simBroker) SubscribeQuotes(qq []QuoteSubT) error {
 			if _, ok := simSymbolsQ[si.fKey]; !ok {
 				simSymbolsQ[si.fKey] = qs.QuotesPtr
 			}
+			if _, ok := simSymbolsDepth[si.fKey]; !ok && qs.DepthPtr != nil {
+				simSymbolsDepth[si.fKey] = qs.DepthPtr
+			}
+		}
+	}
+	return nil
+}
+
+// SubscribePeriods ... emit bar events of periods, period less than
+//		sim data period ignored
+func (b simBroker) SubscribePeriods(periods []Period) error {
+	if atomic.LoadInt32(&simStatus) != VmIdle {
+		return errVMStatus
+	}
+	simVmLock.Lock()
+	defer simVmLock.Unlock()
+	for _, p := range periods {
+		if p.isAlt() || p.String() == "Inv Period" {
+			return errInvalidPeriod
+		}
+	}
+	for _, p := range periods {
+		simPeriods = addPeriod(simPeriods, p)
+	}
+	return nil
+}
+
+// SubscribeBarSpecs ... build non-time bars of specs from ticks of
+//		subscribed symbols, emit bar events while closed
+func (b simBroker) SubscribeBarSpecs(specs []BarSpec) error {
+	if atomic.LoadInt32(&simStatus) != VmIdle {
+		return errVMStatus
+	}
+	simVmLock.Lock()
+	defer simVmLock.Unlock()
+	for _, spec := range specs {
+		if !spec.valid() {
+			return errInvalidBarSpec
+		}
+	}
+	for _, spec := range specs {
+		found := false
+		for _, ss := range simBarSpecs {
+			if ss == spec {
+				found = true
+				break
+			}
+		}
+		if !found {
+			simBarSpecs = append(simBarSpecs, spec)
 		}
 	}
 	return nil
 }
 
+// Equity ... balance with unrealized P&L of positions at current quotes
 func (b simBroker) Equity() float64 {
 	acct := simAccounts[b]
-	return acct.equity
+	return acct.balance + acct.unrealized()
 }
 
 func (b simBroker) Balance() float64 {
@@ -998,15 +1649,50 @@ func (b simBroker) Cash() float64 {
 
 func (b simBroker) FreeMargin() float64 {
 	acct := simAccounts[b]
-	return acct.equity - acct.margin
+	return acct.balance + acct.unrealized() - acct.margin
 }
 
 func (b simBroker) SendOrder(sym string, dir OrderDirT, qty int, prc float64,
 	stopL float64) int {
+	return b.SendOrderMagic(sym, dir, qty, prc, stopL, 0)
+}
+
+// contOrderSymbol ... active contract of continuous symbol for order
+func contOrderSymbol(sym string) (string, error) {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return "", err
+	}
+	return ContActive(sym, si.TradingDay(simCurrent))
+}
+
+// SendOrderMagic ... send order tagged with magic of strategy
+//		order of continuous symbol placed on its active contract
+func (b simBroker) SendOrderMagic(sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64, magic int) int {
+	cont := isContSymbol(sym)
+	if cont {
+		active, err := contOrderSymbol(sym)
+		if err != nil {
+			log.Warningf("%s %s order refused: %s", sym, dir, err)
+			return -1
+		}
+		sym = active
+	}
 	si, err := GetSymbolInfo(sym)
 	if err != nil {
 		return -1
 	}
+	if err := si.checkExpiry(dir, si.TradingDay(simCurrent)); err != nil {
+		log.Warningf("%s %s order refused: %s", sym, dir, err)
+		return -1
+	}
+	if prc != 0 && si.Upper > 0 && (prc > si.Upper+si.PriceStep/2 ||
+		prc < si.Lower-si.PriceStep/2) {
+		log.Warningf("%s %s order refused: %s %g(%g/%g)", sym, dir, errPriceLimit,
+			prc, si.Lower, si.Upper)
+		return -1
+	}
 	var prcI = int32(prc * si.Multi())
 	// tobe fix
 	// verify, put to orderbook
@@ -1015,15 +1701,27 @@ func (b simBroker) SendOrder(sym string, dir OrderDirT, qty int, prc float64,
 	}
 	simVmLock.Lock()
 	defer simVmLock.Unlock()
+	acct := simAccounts[b]
+	if acct.hedging {
+		if err := acct.checkHedge(&si, dir, qty); err != nil {
+			log.Warningf("%s %s %d order refused: %s", sym, dir, qty, err)
+			return -1
+		}
+	} else if dir.Sign() < 0 {
+		if err := acct.checkSell(&si, qty); err != nil {
+			log.Warningf("%s %s %d order refused: %s", sym, dir, qty, err)
+			return -1
+		}
+	}
 	orderNo++
-	var or = simOrderType{simBroker: b, oid: orderNo, price: prcI,
+	var or = simOrderType{simBroker: b, oid: orderNo, price: prcI, cont: cont,
 		OrderType: OrderType{Symbol: sym, Price: prc, StopPrice: stopL,
-			Dir: dir, Qty: qty}}
+			Dir: dir, Qty: qty, Magic: magic}}
 	or.AckTime = simCurrent
+	or.Status = OrderAccept
 	simOrders[orderNo] = &or
 	// put to orderBook
 	simInsertOrder(&or)
-	acct := simAccounts[b]
 	acct.orders = append(acct.orders, orderNo)
 	return orderNo
 }
@@ -1140,6 +1838,39 @@ func (b simBroker) GetPositions() (res []PositionType) {
 	return
 }
 
+// GetTrades ... round trips of positions closed
+func (b simBroker) GetTrades() []TradeType {
+	acctLock.RLock()
+	defer acctLock.RUnlock()
+	acct := simAccounts[b]
+	res := make([]TradeType, len(acct.roundTrips))
+	copy(res, acct.roundTrips)
+	return res
+}
+
+// dealsFrom ... deals of journal from index idx
+func (b simBroker) dealsFrom(idx int) []DealType {
+	acctLock.RLock()
+	defer acctLock.RUnlock()
+	acct, ok := simAccounts[b]
+	if !ok || idx >= len(acct.deals) {
+		return nil
+	}
+	res := make([]DealType, len(acct.deals)-idx)
+	copy(res, acct.deals[idx:])
+	return res
+}
+
+// GetDeals ... journal of deals, order fills and rolls
+func (b simBroker) GetDeals() []DealType {
+	acctLock.RLock()
+	defer acctLock.RUnlock()
+	acct := simAccounts[b]
+	res := make([]DealType, len(acct.deals))
+	copy(res, acct.deals)
+	return res
+}
+
 //go:noinline
 func (b simBroker) TimeCurrent() DateTimeMs {
 	return simCurrent
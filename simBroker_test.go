@@ -282,3 +282,189 @@ func Test_simBroker_Start(t *testing.T) {
 	dumpSimOrderStats()
 	dumpSimBroker()
 }
+
+// newTestAccount ... empty sim account of broker id, release to remove
+func newTestAccount(id int) (simBroker, *account, func()) {
+	tb := simBroker(id)
+	acct := &account{pos: map[SymbolKey]*PositionType{}}
+	acctLock.Lock()
+	simAccounts[tb] = acct
+	acctLock.Unlock()
+	return tb, acct, func() {
+		acctLock.Lock()
+		delete(simAccounts, tb)
+		acctLock.Unlock()
+	}
+}
+
+func Test_simBroker_SettleT1(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh600600")
+	newSymbolInfo("XAUUSD")
+	si, err := GetSymbolInfo("sh600600")
+	if err != nil {
+		t.Skip("no sh600600", err)
+	}
+	fx, _ := GetSymbolInfo("XAUUSD")
+	tb, acct, release := newTestAccount(-2)
+	defer release()
+	acct.updatePos(&si, OrderDirBuy, 12.5, 1000)
+	if pos := acct.pos[si.fKey]; pos.PosFreeze != 1000 {
+		t.Error("T+1 PosFreeze diff", *pos)
+	}
+	if fx.symbolBase != nil {
+		acct.updatePos(&fx, OrderDirBuy, 1300, 1)
+		if pos := acct.pos[fx.fKey]; pos.PosFreeze != 0 {
+			t.Error("T+0 PosFreeze diff", *pos)
+		}
+	}
+	if oid := tb.SendOrder("sh600600", OrderDirClose, 500, 12.6, 0); oid != -1 {
+		t.Error("sell of frozen should be refused", oid)
+	}
+	if oid := tb.SendOrder("sh600600", OrderDirSell, 100, 12.6, 0); oid != -1 {
+		t.Error("sell without position should be refused", oid)
+	}
+	simSettle()
+	simVmLock.Lock()
+	avail := acct.availableToSell(&si)
+	simVmLock.Unlock()
+	if avail != 1000 {
+		t.Error("availableToSell after settle", avail)
+	}
+	acct.updatePos(&si, OrderDirClose, 12.6, 400)
+	if pos := acct.pos[si.fKey]; pos.Positions != 600 || pos.PosFreeze != 0 {
+		t.Error("position after sell", *pos)
+	}
+}
+
+func Test_simBroker_PriceLimit(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sz000002")
+	newSymbolInfo("cu2003")
+	ss, err := GetSymbolInfo("sz000002")
+	if err != nil {
+		t.Skip("no sz000002", err)
+	}
+	si, _ := ss.fKey.SymbolInfo()
+	tests := []struct {
+		name   string
+		sym    string
+		pclose float64
+		upper  float64
+		lower  float64
+	}{
+		{"A share", "sz000002", 10, 11, 9},
+		{"A share round", "sz000002", 10.13, 11.14, 9.12},
+		{"no pclose", "sz000002", 0, 0, 0},
+		{"futures", "cu2003", 46000, 48800, 43200},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := GetSymbolInfo(tt.sym)
+			if err != nil {
+				t.Skip("no", tt.sym, err)
+			}
+			s.setDailyLimits(tt.pclose)
+			if round(s.Upper) != tt.upper || round(s.Lower) != tt.lower {
+				t.Errorf("setDailyLimits() = %g/%g, want %g/%g", s.Upper, s.Lower,
+					tt.upper, tt.lower)
+			}
+		})
+	}
+	si.setDailyLimits(10)
+	defer si.setDailyLimits(0)
+	if s, _ := GetSymbolInfo("sz000002"); s.Upper != si.Upper {
+		t.Error("limits not shared", s.Upper, si.Upper)
+	}
+	tb, acct, release := newTestAccount(-3)
+	defer func() {
+		release()
+		delete(simOrderBook, "sz000002")
+	}()
+	if oid := tb.SendOrder("sz000002", OrderDirBuy, 100, 11.5, 0); oid != -1 {
+		t.Error("order over limit up should be refused", oid)
+	}
+	if oid := tb.SendOrder("sz000002", OrderDirBuy, 100, 8.9, 0); oid != -1 {
+		t.Error("order below limit down should be refused", oid)
+	}
+	// locked limit up, only volume traded at limit filled
+	or1 := &simOrderType{simBroker: tb, oid: 1000001, price: 1100,
+		OrderType: OrderType{Symbol: "sz000002", Dir: OrderDirBuy, Qty: 300, Price: 11}}
+	or2 := &simOrderType{simBroker: tb, oid: 1000002, price: 1100,
+		OrderType: OrderType{Symbol: "sz000002", Dir: OrderDirBuy, Qty: 200, Price: 11}}
+	simInsertOrder(or1)
+	simInsertOrder(or2)
+	tk := &simTick{ticks: []Tick{{Last: 1100}, {Last: 1100, Volume: 400}}}
+	simMatchOrder(si, tk)
+	if or1.QtyFilled != 0 || or2.QtyFilled != 0 {
+		t.Error("locked limit up should not fill", or1.QtyFilled, or2.QtyFilled)
+	}
+	tk.curP++
+	simMatchOrder(si, tk)
+	if or1.QtyFilled != 300 || or2.QtyFilled != 100 || or2.Status != OrderPartFilled {
+		t.Error("locked limit fills diff", or1.QtyFilled, or2.QtyFilled)
+	}
+	if pos := acct.pos[si.fKey]; pos == nil || pos.Positions != 400 {
+		t.Error("locked limit position diff", pos)
+	}
+}
+
+func Test_simBroker_ShortSell(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	newSymbolInfo("cu2002")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil {
+		t.Skip("no sh601318", err)
+	}
+	cu, _ := GetSymbolInfo("cu2002")
+	repo := SymbolInfo{Ticker: "sh204001", symbolBase: &symbolBase{ShortMode: ShortNone}}
+	tb, acct, release := newTestAccount(-4)
+	defer release()
+	SetBorrow("sh601318", BorrowAvail{Qty: 1000, Rate: 0.09})
+	defer SetBorrow("sh601318", BorrowAvail{})
+	tests := []struct {
+		name string
+		si   *SymbolInfo
+		qty  int
+		want error
+	}{
+		{"borrow", &si, 1000, nil},
+		{"over borrow", &si, 1100, errBorrowExceeded},
+		{"futures", &cu, 5, nil},
+		{"not allowed", &repo, 10, errShortNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.si.symbolBase == nil {
+				t.Skip("no", tt.si.Ticker)
+			}
+			simVmLock.Lock()
+			got := acct.checkSell(tt.si, tt.qty)
+			simVmLock.Unlock()
+			if got != tt.want {
+				t.Errorf("checkSell() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	// short over existing short
+	acct.updatePos(&si, OrderDirSell, 50, 600)
+	simVmLock.Lock()
+	if err := acct.checkSell(&si, 500); err != errBorrowExceeded {
+		t.Error("short over borrow", err)
+	}
+	simVmLock.Unlock()
+	SetBorrow("sh601318", BorrowAvail{})
+	if oid := tb.SendOrder("sh601318", OrderDirSell, 100, 50, 0); oid != -1 {
+		t.Error("short without borrow should be refused", oid)
+	}
+	// borrow fee of template rate, 3 days over weekend
+	eq := acct.equity
+	acct.borrowFee(&si, 600, 50, si.borrowRate()*3/360)
+	if fee := round(eq - acct.equity); fee != round(600*50*0.08*3/360) {
+		t.Error("borrow fee diff", fee)
+	}
+	if d := acct.deals[len(acct.deals)-1]; d.Reason != "borrow" || d.Oid != -1 {
+		t.Error("borrow deal diff", d)
+	}
+}
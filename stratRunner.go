@@ -6,15 +6,40 @@ import (
 	"runtime"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/kjx98/golib/ini"
+	"github.com/kjx98/golib/julian"
 )
 
 type strategyRunner struct {
 	evChan   chan QuoteEvent
-	symStrat map[string]bool
+	symStrat map[string][]string // owner strategies of symbol
 	strats   map[string]Strategyer
 	contxt   *Context
+	recorder *QuoteRecorder
+	// bar periods of strategies, OnBar only for declared periods
+	stratPeriods map[string][]Period
+	barPeriods   []Period
+	// bar builder per symbol, for broker without BarBroker
+	barBuilders map[string]*barBuilder
+	// non-time bars of strategies, built from quotes for broker
+	// without AltBarBroker
+	barSpecs   []BarSpec
+	buildAlter bool
+	// context with sub-account per strategy, capital rebalanced every
+	// rebalanceDays trading days, 0 for never
+	stratCtx      map[string]*Context
+	subAccts      []*subAccount
+	rebalanceDays int
+	lastRebalance julian.JulianDay
+	curDay        julian.JulianDay
+	// market of trading days and base currency, from section Risk
+	market   string
+	currency string
+	// symbol in universe of multiple strategies allowed, events to all
+	// owners
+	sharedSymbols bool
 }
 
 // buildParam ...	build params from ini config
@@ -67,8 +92,10 @@ func setParam(c Config, stratName string, param []Parameter) []float64 {
 func newStrategyRunner() *strategyRunner {
 	var res strategyRunner
 	res.evChan = make(chan QuoteEvent, 10)
-	res.symStrat = map[string]bool{}
+	res.symStrat = map[string][]string{}
 	res.strats = map[string]Strategyer{}
+	res.stratPeriods = map[string][]Period{}
+	res.stratCtx = map[string]*Context{}
 	return &res
 }
 
@@ -77,8 +104,9 @@ func newStrategyRunner() *strategyRunner {
 func (sc *strategyRunner) SetStrategyParam(c Config) error {
 	for stName, b := range sc.strats {
 		params := setParam(c, stName, b.ParamSet())
-		sc.contxt.Put("Param", params)
-		if ss, err := b.Init(sc.contxt); err == nil {
+		ctx := sc.stratCtx[stName]
+		ctx.Put("Param", params)
+		if ss, err := b.Init(ctx); err == nil {
 			sc.strats[stName] = ss
 		} else {
 			return err
@@ -101,7 +129,14 @@ func (sc *strategyRunner) loadStrategy(fname string) (err error) {
 	if err != nil {
 		return
 	}
-	sc.contxt = newContext(br)
+	limits, ok := loadRiskLimits(cf)
+	sc.market, sc.currency = limits.Market, limits.Currency
+	if ok {
+		// strategies send orders via risk layer, subscriptions to broker
+		sc.contxt = newContext(NewRiskBroker(br, limits))
+	} else {
+		sc.contxt = newContext(br)
+	}
 	var autoNew bool
 	if cf.GetConfigInt("Config", "NewSymbolInfo", 0) != 0 {
 		autoNew = true
@@ -109,18 +144,37 @@ func (sc *strategyRunner) loadStrategy(fname string) (err error) {
 	if cf.GetConfigInt("Config", "RunTick", 0) != 0 {
 		sc.contxt.Put("RunTick", 1)
 	}
+	// byte budget of data caches in MB, 0 for unlimited
+	if budget := cf.GetConfigInt("Config", "CacheBudget", -1); budget >= 0 {
+		SetCacheBudget(int64(budget) << 20)
+	}
+	sc.rebalanceDays = cf.GetConfigInt("Config", "RebalanceDays", 0)
+	sc.sharedSymbols = cf.GetConfigInt("Config", "SharedSymbols", 0) != 0
 	stratsN := strings.Split(cf.GetConfig("Config", "Strategy", ""), ",")
-	for _, stName := range stratsN {
+	equity := sc.contxt.Equity()
+	for i, stName := range stratsN {
 		if b, ok := stratsMap[stName]; ok {
+			// sub-account of strategy, capital by weight of equity default
+			weight := cf.GetConfigDouble(stName, "Weight", 1/float64(len(stratsN)))
+			capital := cf.GetConfigDouble(stName, "Capital", equity*weight)
+			magic := cf.GetConfigInt(stName, "Magic", i+1)
+			sa := newSubAccount(sc.contxt.Broker, stName, magic, capital, weight)
+			sa.acct.currency = sc.currency
+			ctx := newContext(sa)
+			for k, v := range sc.contxt.Config {
+				ctx.Put(k, v)
+			}
 			universe := strings.Split(cf.GetConfig(stName, "Universe", ""), ",")
-			sc.contxt.Put("Universe", universe)
+			ctx.Put("Universe", universe)
 			// build param for Strategy
 			params := buildParam(cf, stName, b.ParamSet())
-			sc.contxt.Put("Param", params)
-			if ss, err := b.Init(sc.contxt); err == nil {
+			ctx.Put("Param", params)
+			if ss, err := b.Init(ctx); err == nil {
 				// process universe
 				sc.strats[stName] = ss
-				universe = sc.contxt.GetStrings("Universe")
+				sc.stratCtx[stName] = ctx
+				sc.subAccts = append(sc.subAccts, sa)
+				universe = ctx.GetStrings("Universe")
 				for _, sym := range universe {
 					if _, err := GetSymbolInfo(sym); err != nil {
 						if autoNew {
@@ -133,11 +187,9 @@ func (sc *strategyRunner) loadStrategy(fname string) (err error) {
 							continue
 						}
 					}
-					if _, ok := sc.symStrat[sym]; ok {
-						// already
-						continue
+					if err := sc.assignSymbol(sym, stName); err != nil {
+						return err
 					}
-					sc.symStrat[sym] = true
 				}
 			}
 		}
@@ -146,8 +198,23 @@ func (sc *strategyRunner) loadStrategy(fname string) (err error) {
 		err = errNoActiveStrategy
 		return
 	}
+	for stName, ss := range sc.strats {
+		periods := defaultBarPeriods
+		if ps, ok := ss.(PeriodStrategyer); ok {
+			periods = ps.Periods()
+		}
+		sc.stratPeriods[stName] = periods
+		for _, p := range periods {
+			if spec, ok := p.BarSpec(); ok {
+				sc.addBarSpec(spec)
+			} else {
+				sc.barPeriods = addPeriod(sc.barPeriods, p)
+			}
+		}
+	}
 	// subscribe quotes
 	subs := []QuoteSubT{}
+	depthLevels := cf.GetConfigInt("Config", "DepthLevels", 0)
 	for sym := range sc.symStrat {
 		si, err := GetSymbolInfo(sym)
 		if err != nil {
@@ -155,30 +222,158 @@ func (sc *strategyRunner) loadStrategy(fname string) (err error) {
 		}
 		var subo = QuoteSubT{Symbol: sym}
 		subo.QuotesPtr = si.getQuotesPtr()
+		if depthLevels > 0 {
+			subo.DepthPtr = si.getDepthPtr(depthLevels)
+		}
 		subs = append(subs, subo)
 	}
 	if err = br.SubscribeQuotes(subs); err != nil {
 		log.Error("Broker SubscribeQuotes", err)
 		return
 	}
+	if bb, ok := br.(BarBroker); ok {
+		if err = bb.SubscribePeriods(sc.barPeriods); err != nil {
+			log.Error("Broker SubscribePeriods", err)
+			return
+		}
+	} else {
+		sc.barBuilders = map[string]*barBuilder{}
+	}
+	if len(sc.barSpecs) > 0 {
+		if ab, ok := br.(AltBarBroker); ok {
+			if err = ab.SubscribeBarSpecs(sc.barSpecs); err != nil {
+				log.Error("Broker SubscribeBarSpecs", err)
+				return
+			}
+		} else {
+			sc.buildAlter = true
+		}
+	}
+	if cf.GetConfigInt("Config", "RecordQuotes", 0) != 0 {
+		sc.recorder = NewQuoteRecorder(cf.GetConfig("Config", "RecordPath", ""))
+		sc.recorder.Subscribe(subs)
+	}
 	return
 }
 
+func (sc *strategyRunner) addBarSpec(spec BarSpec) {
+	for _, ss := range sc.barSpecs {
+		if ss == spec {
+			return
+		}
+	}
+	sc.barSpecs = append(sc.barSpecs, spec)
+}
+
 var errNoEventChannel = errors.New("No Event Channel")
 var errNoStrategy = errors.New("No Strategy loaded")
 var errNoActiveStrategy = errors.New("No active Strategy")
+var errSymbolOverlap = errors.New("Symbol in universe of multiple Strategies")
 
+// assignSymbol ... strategy stName owns symbol, symbol owned by other
+//		strategy refused unless sharedSymbols
+func (sc *strategyRunner) assignSymbol(sym, stName string) error {
+	owners := sc.symStrat[sym]
+	for _, st := range owners {
+		if st == stName {
+			return nil
+		}
+	}
+	if len(owners) > 0 && !sc.sharedSymbols {
+		log.Errorf("symbol %s in universe of %s and %s, SharedSymbols required",
+			sym, owners[0], stName)
+		return errSymbolOverlap
+	}
+	sc.symStrat[sym] = append(owners, stName)
+	return nil
+}
+
+// emitEvent ... route event of symbol to strategies own the symbol
 func (sc *strategyRunner) emitEvent(si *SymbolInfo, evID int) {
-	for _, strat := range sc.strats {
+	for _, stName := range sc.symStrat[si.Ticker] {
+		strat, ok := sc.strats[stName]
+		if !ok {
+			continue
+		}
 		switch Period(evID) {
 		case 0:
 			strat.OnTick(si.Ticker)
-		case Min1, Min5, Hour1, Daily:
-			strat.OnBar(si.Ticker, Period(evID))
+		case EventDepth:
+			if ds, ok := strat.(DepthStrategyer); ok {
+				ds.OnDepth(si.Ticker)
+			}
+		default:
+			for _, p := range sc.stratPeriods[stName] {
+				if p == Period(evID) {
+					strat.OnBar(si.Ticker, p)
+					break
+				}
+			}
 		}
 	}
 }
 
+// emitLiveBars ... build bars from quotes, emit bar events of symbol
+//		closed by current tick, for broker without BarBroker
+//		bar closed by wall clock timer, or first tick after
+func (sc *strategyRunner) emitLiveBars(si *SymbolInfo) {
+	bb, ok := sc.barBuilders[si.Ticker]
+	if !ok {
+		bb = newBarBuilder(si.fKey, sc.barPeriods)
+		sc.barBuilders[si.Ticker] = bb
+	}
+	q := si.GetQuotes()
+	curT := q.UpdateTime.Unix()
+	if q.UpdateTime == 0 {
+		curT = sc.contxt.TimeCurrent().Unix()
+	}
+	for _, p := range bb.onQuote(&q, curT) {
+		sc.emitEvent(si, int(p))
+	}
+}
+
+// nextBarClose ... earliest close of live bars, 0 for none
+func (sc *strategyRunner) nextBarClose() (res int64) {
+	for _, bb := range sc.barBuilders {
+		if t := bb.nextClose(); t > 0 && (res == 0 || t < res) {
+			res = t
+		}
+	}
+	return
+}
+
+// emitTimedBars ... close live bars ended till t without tick, emit bar
+//		events of symbols
+func (sc *strategyRunner) emitTimedBars(t int64) {
+	for ticker, bb := range sc.barBuilders {
+		closed := bb.closeBars(t)
+		if len(closed) == 0 {
+			continue
+		}
+		si, err := GetSymbolInfo(ticker)
+		if err != nil {
+			continue
+		}
+		for _, p := range closed {
+			sc.emitEvent(&si, int(p))
+		}
+	}
+}
+
+// emitAltBars ... build non-time bars from quotes, emit bar events of
+//		symbol closed by current tick, for broker without AltBarBroker
+func (sc *strategyRunner) emitAltBars(si *SymbolInfo) {
+	as := getAltBarSet(si, sc.barSpecs)
+	q := si.GetQuotes()
+	curT := q.UpdateTime.Unix()
+	if q.UpdateTime == 0 {
+		curT = sc.contxt.TimeCurrent().Unix()
+	}
+	for _, p := range as.onQuote(&q, curT) {
+		sc.emitEvent(si, int(p))
+	}
+}
+
 var wg sync.WaitGroup
 
 func (sc *strategyRunner) runStrategy() error {
@@ -194,8 +389,30 @@ func (sc *strategyRunner) runStrategy() error {
 	go func() {
 		// process event
 		defer wg.Done()
+		// wall clock timer of next live bar close
+		var closeTimer *time.Timer
+		var closeC <-chan time.Time
+		var closeDue int64
+		schedule := func() {
+			next := sc.nextBarClose()
+			if next == closeDue {
+				return
+			}
+			if closeTimer != nil {
+				closeTimer.Stop()
+				closeC = nil
+			}
+			if closeDue = next; next > 0 {
+				closeTimer = time.NewTimer(time.Until(time.Unix(next, 0)))
+				closeC = closeTimer.C
+			}
+		}
 		for {
 			select {
+			case <-closeC:
+				closeDue = 0
+				sc.emitTimedBars(time.Now().Unix())
+				schedule()
 			case ev, ok := <-sc.evChan:
 				if !ok {
 					return
@@ -204,10 +421,27 @@ func (sc *strategyRunner) runStrategy() error {
 					// run out of sample Bars
 					return
 				}
+				if rb, ok := sc.contxt.Broker.(*riskBroker); ok {
+					// drawdown kill switch checked with events
+					rb.CheckRisk()
+				}
+				sc.checkRebalance()
+				if (ev.EventID == 0 || ev.EventID == EventDepth) && sc.recorder != nil {
+					sc.recorder.OnQuote(ev.Symbol)
+				}
 				// process ev
 				if si, err := GetSymbolInfo(ev.Symbol); err == nil {
+					if ev.EventID == 0 && sc.barBuilders != nil {
+						sc.emitLiveBars(&si)
+					}
+					if ev.EventID == 0 && sc.buildAlter {
+						sc.emitAltBars(&si)
+					}
 					sc.emitEvent(&si, ev.EventID)
 				}
+				if sc.barBuilders != nil {
+					schedule()
+				}
 			}
 			runtime.Gosched()
 		}
@@ -216,6 +450,25 @@ func (sc *strategyRunner) runStrategy() error {
 	return nil
 }
 
+// checkRebalance ... rebalance capital of sub-accounts every rebalanceDays
+//		trading days of market
+func (sc *strategyRunner) checkRebalance() {
+	if sc.rebalanceDays <= 0 || len(sc.subAccts) < 2 {
+		return
+	}
+	day := marketTradingDay(sc.market, sc.contxt.TimeCurrent().Unix())
+	if day == sc.curDay {
+		return
+	}
+	sc.curDay = day
+	if sc.lastRebalance == 0 {
+		sc.lastRebalance = day
+	} else if TradingDaysBetween(sc.market, sc.lastRebalance, day) >= sc.rebalanceDays {
+		rebalanceCapital(sc.subAccts)
+		sc.lastRebalance = day
+	}
+}
+
 func (sc *strategyRunner) stopStrategy() {
 	//for multiple running, never close evChan
 	//close(sc.evChan)
@@ -223,4 +476,11 @@ func (sc *strategyRunner) stopStrategy() {
 	for _, ss := range sc.strats {
 		ss.DeInit()
 	}
+	// per strategy equity
+	for _, sa := range sc.subAccts {
+		sa.report()
+	}
+	if sc.recorder != nil {
+		sc.recorder.Close()
+	}
 }
@@ -0,0 +1,135 @@
+package ats
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// tickStrat ... strategy record symbols of OnTick
+type tickStrat struct {
+	ticks []string
+}
+
+func (t *tickStrat) ParamSet() []Parameter               { return nil }
+func (t *tickStrat) Init(c *Context) (Strategyer, error) { return t, nil }
+func (t *tickStrat) OnTick(sym string)                   { t.ticks = append(t.ticks, sym) }
+func (t *tickStrat) OnBar(sym string, period Period)     {}
+func (t *tickStrat) DeInit()                             {}
+
+func Test_strategyRunner_assignSymbol(t *testing.T) {
+	tests := []struct {
+		name    string
+		shared  bool
+		assigns [][2]string
+		wantErr error
+		want    map[string][]string
+	}{
+		{"disjoint", false, [][2]string{{"cu", "s1"}, {"al", "s2"}}, nil,
+			map[string][]string{"cu": {"s1"}, "al": {"s2"}}},
+		{"duplicate in universe", false, [][2]string{{"cu", "s1"}, {"cu", "s1"}}, nil,
+			map[string][]string{"cu": {"s1"}}},
+		{"overlap", false, [][2]string{{"cu", "s1"}, {"cu", "s2"}}, errSymbolOverlap,
+			map[string][]string{"cu": {"s1"}}},
+		{"shared", true, [][2]string{{"cu", "s1"}, {"cu", "s2"}}, nil,
+			map[string][]string{"cu": {"s1", "s2"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc := newStrategyRunner()
+			sc.sharedSymbols = tt.shared
+			var err error
+			for _, as := range tt.assigns {
+				if err = sc.assignSymbol(as[0], as[1]); err != nil {
+					break
+				}
+			}
+			if err != tt.wantErr {
+				t.Errorf("assignSymbol() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(sc.symStrat, tt.want) {
+				t.Errorf("symStrat = %v, want %v", sc.symStrat, tt.want)
+			}
+		})
+	}
+}
+
+func Test_strategyRunner_emitEvent(t *testing.T) {
+	sc := newStrategyRunner()
+	s1, s2 := &tickStrat{}, &tickStrat{}
+	sc.strats["s1"], sc.strats["s2"] = s1, s2
+	sc.assignSymbol("cu", "s1")
+	sc.assignSymbol("al", "s2")
+	for _, sym := range []string{"cu", "al", "zn", "cu"} {
+		sc.emitEvent(&SymbolInfo{Ticker: sym}, 0)
+	}
+	if want := []string{"cu", "cu"}; !reflect.DeepEqual(s1.ticks, want) {
+		t.Errorf("s1 ticks = %v, want %v", s1.ticks, want)
+	}
+	if want := []string{"al"}; !reflect.DeepEqual(s2.ticks, want) {
+		t.Errorf("s2 ticks = %v, want %v", s2.ticks, want)
+	}
+}
+
+func Test_strategyRunner_checkRebalance(t *testing.T) {
+	mb := &mockBroker{equity: 1e6}
+	sc := newStrategyRunner()
+	sc.contxt = newContext(mb)
+	sa1 := newSubAccount(mb, "s1", 1, 600000, 1)
+	sa2 := newSubAccount(mb, "s2", 2, 400000, 1)
+	sc.subAccts = []*subAccount{sa1, sa2}
+	sc.rebalanceDays = 2
+	tests := []struct {
+		name string
+		day  int
+		want float64
+	}{
+		{"Friday", 4, 600000},
+		{"Saturday", 5, 600000},
+		{"Monday one trading day", 7, 600000},
+		{"Tuesday two trading days", 8, 500000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mb.curT = TimeToDateTimeMs(time.Date(2019, 1, tt.day, 12, 0, 0, 0, time.UTC))
+			sc.checkRebalance()
+			if got := sa1.Balance(); round(got) != tt.want {
+				t.Errorf("Balance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_strategyRunner_rebalanceMarket(t *testing.T) {
+	sh, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("LoadLocation", err)
+	}
+	// Friday night session of SHFE is trading day of Monday
+	tests := []struct {
+		name   string
+		market string
+		want   float64
+	}{
+		{"SHFE", "SHFE", 500000},
+		{"UTC", "", 600000},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mb := &mockBroker{equity: 1e6}
+			sc := newStrategyRunner()
+			sc.contxt = newContext(mb)
+			sa1 := newSubAccount(mb, "s1", 1, 600000, 1)
+			sa2 := newSubAccount(mb, "s2", 2, 400000, 1)
+			sc.subAccts = []*subAccount{sa1, sa2}
+			sc.rebalanceDays, sc.market = 2, tt.market
+			mb.curT = TimeToDateTimeMs(time.Date(2019, 3, 7, 10, 0, 0, 0, sh))
+			sc.checkRebalance()
+			mb.curT = TimeToDateTimeMs(time.Date(2019, 3, 8, 21, 30, 0, 0, sh))
+			sc.checkRebalance()
+			if got := sa1.Balance(); round(got) != tt.want {
+				t.Errorf("Balance() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -9,6 +9,7 @@ type Parameter struct {
 }
 
 // Context ... context store broker and  config
+//	Broker	sub-account of strategy, orders tagged with magic of strategy
 type Context struct {
 	Broker
 	Config
@@ -16,7 +17,8 @@ type Context struct {
 }
 
 // Strategyer ...	universe of Strategyer should never intersection
-// one symbol/ticker can only be processed by one Strategyer
+// one symbol/ticker can only be processed by one Strategyer, OnTick/OnBar
+// only for symbols of universe, SharedSymbols of Config for shared
 // 		Context.Config items   "Universe":[]string, "Param":[]float64
 type Strategyer interface {
 	ParamSet() []Parameter               // Return parameter set for strategy
@@ -26,16 +28,38 @@ type Strategyer interface {
 	DeInit()                             // Destroy interface/state
 }
 
+// DepthStrategyer ...	optional for Strategyer, receive Level2 depth update
+type DepthStrategyer interface {
+	OnDepth(sym string) // sym Level2 depth updated
+}
+
+// PeriodStrategyer ...	optional for Strategyer, declare periods for OnBar
+//	Strategyer without Periods receive defaultBarPeriods
+//	BarSpec.Period() for non-time bars of BarSpec
+type PeriodStrategyer interface {
+	Periods() []Period // OnBar called when bars of periods closed
+}
+
+var defaultBarPeriods = []Period{Min1, Min5, Hour1, Daily}
+
 var errStratExist = errors.New("Strategy registered")
 var errStratNotExist = errors.New("Strategy not registered")
 var stratsMap = map[string]Strategyer{}
 
+// stratGetBars ... Bars of time period, or closed bars of BarSpec period
 func (c *Context) stratGetBars(sym string, period Period) (*Bars, error) {
+	if period.isAlt() {
+		si, err := GetSymbolInfo(sym)
+		if err != nil {
+			return nil, err
+		}
+		return getAltBars(si.fKey, period)
+	}
 	return getBars(sym, period, c.TimeCurrent())
 }
 
 func newContext(br Broker) *Context {
-	var c = Context{Broker: br}
+	var c = Context{Broker: br, Config: Config{}}
 	c.GetBars = c.stratGetBars
 	return &c
 }
@@ -0,0 +1,455 @@
+package ats
+
+import (
+	"errors"
+	"math"
+	"sync"
+)
+
+var errSubMargin = errors.New("Margin over free margin of sub-account")
+
+// subAccount ... virtual sub-account of strategy on shared broker account
+//	orders tagged with magic, positions and P&L built from fills of own
+//	orders, fund as capital allocated, broker generated deals of journal
+//	like rolls, expiry, corporate actions, swaps and borrow fees applied
+//	to own positions
+type subAccount struct {
+	Broker
+	name    string
+	magic   int
+	weight  float64
+	lock    sync.Mutex
+	acct    account
+	pending []int
+	fills   map[int]subFill
+	dealIdx int
+}
+
+// subFill ... filled quantity and amount of order synced
+type subFill struct {
+	qty int
+	amt float64
+}
+
+// newSubAccount ... sub-account of strategy name with capital on br
+//		weight for capital rebalancing
+func newSubAccount(br Broker, name string, magic int, capital, weight float64) *subAccount {
+	sa := &subAccount{Broker: br, name: name, magic: magic, weight: weight,
+		fills: map[int]subFill{}}
+	sa.acct = account{fundStart: capital, fund: capital, balance: capital,
+		equity: capital, pos: map[SymbolKey]*PositionType{}}
+	sa.acct.hedging = hedgingOf(br)
+	sa.dealIdx += len(journalFrom(br, 0))
+	if rb, ok := br.(*riskBroker); ok {
+		rb.addSub(sa)
+	}
+	return sa
+}
+
+// hedgingOf ... position mode of broker, unwrap risk layer
+func hedgingOf(br Broker) bool {
+	for {
+		switch b := br.(type) {
+		case HedgeBroker:
+			return b.Hedging()
+		case *riskBroker:
+			br = b.Broker
+		default:
+			return false
+		}
+	}
+}
+
+// journalFrom ... deals of broker journal from index idx, unwrap risk layer
+func journalFrom(br Broker, idx int) []DealType {
+	for {
+		switch b := br.(type) {
+		case simBroker:
+			return b.dealsFrom(idx)
+		case *riskBroker:
+			br = b.Broker
+		case JournalBroker:
+			if deals := b.GetDeals(); idx < len(deals) {
+				return deals[idx:]
+			}
+			return nil
+		default:
+			return nil
+		}
+	}
+}
+
+// legOf ... signed qty of leg of side, 1 for long and -1 for short
+func legOf(pos *PositionType, side int) int {
+	for _, leg := range pos.legs() {
+		if leg.qty*side > 0 {
+			return leg.qty
+		}
+	}
+	return 0
+}
+
+// replay ... apply broker generated deal to own positions, open deal to
+//		for close deal of roll
+func (sa *subAccount) replay(d, to *DealType) {
+	si, err := GetSymbolInfo(d.Symbol)
+	if err != nil {
+		return
+	}
+	pos, ok := sa.acct.pos[si.fKey]
+	if !ok {
+		return
+	}
+	side := d.Dir.Sign()
+	if d.Dir.IsOffset() {
+		// offset deal of long leg sell, of short leg buy
+		side = -side
+	}
+	qty := legOf(pos, side)
+	switch d.Reason {
+	case "roll":
+		if tsi, err := GetSymbolInfo(to.Symbol); err == nil && qty != 0 {
+			sa.acct.rollPos(&si, &tsi, qty, d.Price, to.Price)
+		}
+	case "expiry":
+		if qty != 0 {
+			sa.acct.expiryClose(&si, qty, d.Price)
+		}
+	case "swap":
+		if qty != 0 {
+			sa.acct.swap(&si, qty, d.Price)
+		}
+	case "borrow":
+		if qty != 0 && d.Qty > 0 {
+			amt := sa.acct.toBase(&si, si.CalcProfit(0, d.Price, d.Qty))
+			if amt != 0 {
+				sa.acct.borrowFee(&si, -qty, d.Price, -d.Profit/amt)
+			}
+		}
+	case "dividend":
+		if pos.Positions != 0 {
+			sa.acct.applyCorpAction(&si, pos, &CorpAction{Cash: d.Price})
+		}
+	case "split":
+		if pos.Positions != 0 {
+			sa.acct.applyCorpAction(&si, pos, &CorpAction{Split: d.Price})
+		}
+	}
+}
+
+// sync ... fills of own orders since last sync to positions of
+//		sub-account, then broker generated deals of journal, caller
+//		hold lock
+func (sa *subAccount) sync() {
+	var res []int
+	for _, oid := range sa.pending {
+		or := sa.Broker.GetOrder(oid)
+		if or == nil {
+			continue
+		}
+		f := sa.fills[oid]
+		if delta := or.QtyFilled - f.qty; delta > 0 {
+			if si, err := GetSymbolInfo(or.Symbol); err == nil {
+				amt := or.AvgPrice * float64(or.QtyFilled)
+				price := (amt - f.amt) / float64(delta)
+				profit := sa.acct.updatePos(&si, or.Dir, price, delta)
+				sa.acct.deals = append(sa.acct.deals, DealType{
+					Time: sa.Broker.TimeCurrent(), Symbol: or.Symbol, Dir: or.Dir,
+					Qty: delta, Price: price, Profit: profit, Oid: oid})
+				f = subFill{or.QtyFilled, amt}
+				sa.fills[oid] = f
+			}
+		}
+		switch or.Status {
+		case OrderFilled, OrderCanceled, OrderRejected:
+			delete(sa.fills, oid)
+		default:
+			res = append(res, oid)
+		}
+	}
+	sa.pending = res
+	deals := journalFrom(sa.Broker, sa.dealIdx)
+	sa.dealIdx += len(deals)
+	for i := 0; i < len(deals); i++ {
+		d := &deals[i]
+		if d.Oid != -1 {
+			continue
+		}
+		if d.Reason == "roll" {
+			// close deal of roll followed by open deal
+			if !d.Dir.IsOffset() || i+1 >= len(deals) {
+				continue
+			}
+			i++
+			sa.replay(d, &deals[i])
+			continue
+		}
+		sa.replay(d, nil)
+	}
+}
+
+// unrealized ... unrealized P&L of positions at quotes, caller hold lock
+func (sa *subAccount) unrealized() (res float64) {
+	for fKey, pos := range sa.acct.pos {
+		si, err := fKey.SymbolInfo()
+		if err != nil {
+			continue
+		}
+		q := si.GetQuotes()
+		p := q.Last
+		if q.Bid > 0 && q.Ask > 0 {
+			p = (q.Bid + q.Ask) / 2
+		}
+		if p <= 0 {
+			continue
+		}
+		for _, leg := range pos.legs() {
+			amt, _ := convertCurrency(si.CalcProfit(leg.avgPrice, p, leg.qty),
+				si.Currency(), sa.acct.baseCurrency())
+			res += amt
+		}
+	}
+	return
+}
+
+// Equity ... balance of sub-account with unrealized P&L
+func (sa *subAccount) Equity() float64 {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	return sa.acct.balance + sa.unrealized()
+}
+
+// Balance ... capital allocated with realized P&L
+func (sa *subAccount) Balance() float64 {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	return sa.acct.balance
+}
+
+// Cash ... capital allocated with realized P&L
+func (sa *subAccount) Cash() float64 {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	return sa.acct.fund
+}
+
+// margin ... margin of positions and pending open orders, caller hold lock
+func (sa *subAccount) margin() (res float64) {
+	for fKey, pos := range sa.acct.pos {
+		si, err := fKey.SymbolInfo()
+		if err != nil {
+			continue
+		}
+		for _, leg := range pos.legs() {
+			res += math.Abs(exposure(si, leg.qty, leg.avgPrice, sa.acct.baseCurrency())) * si.marginRate()
+		}
+	}
+	for _, oid := range sa.pending {
+		or := sa.Broker.GetOrder(oid)
+		if or == nil || or.Dir.IsOffset() {
+			continue
+		}
+		if si, err := GetSymbolInfo(or.Symbol); err == nil {
+			res += math.Abs(exposure(&si, or.Qty-or.QtyFilled, or.Price, sa.acct.baseCurrency())) *
+				si.marginRate()
+		}
+	}
+	return
+}
+
+// FreeMargin ... equity of sub-account less margin
+func (sa *subAccount) FreeMargin() float64 {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	return sa.acct.balance + sa.unrealized() - sa.margin()
+}
+
+// checkMargin ... verify margin of order within free margin, offset
+//		orders and orders reduce position always allowed, caller hold lock
+func (sa *subAccount) checkMargin(si *SymbolInfo, dir OrderDirT, qty int, prc float64) error {
+	var cur int
+	if pos, ok := sa.acct.pos[si.fKey]; ok {
+		cur = pos.Positions
+	}
+	if dir.IsOffset() || abs(cur+dir.Sign()*qty) < abs(cur) {
+		return nil
+	}
+	need := math.Abs(exposure(si, qty, prc, sa.acct.baseCurrency())) * si.marginRate()
+	if need > sa.acct.balance+sa.unrealized()-sa.margin() {
+		return errSubMargin
+	}
+	return nil
+}
+
+// SendOrder ... send order tagged with magic of sub-account, margin of
+//		order within free margin of sub-account
+func (sa *subAccount) SendOrder(sym string, dir OrderDirT, qty int, prc float64,
+	stopL float64) int {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return -1
+	}
+	sa.lock.Lock()
+	sa.sync()
+	err = sa.checkMargin(&si, dir, qty, prc)
+	sa.lock.Unlock()
+	if err != nil {
+		log.Warningf("%s %s %d order of %s refused: %s", sym, dir, qty, sa.name, err)
+		return -1
+	}
+	oid := sendOrderMagic(sa.Broker, sym, dir, qty, prc, stopL, sa.magic)
+	if oid >= 0 {
+		sa.track(oid)
+	}
+	return oid
+}
+
+// track ... order of sub-account, fills synced to positions
+func (sa *subAccount) track(oid int) {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.acct.orders = append(sa.acct.orders, oid)
+	sa.pending = append(sa.pending, oid)
+}
+
+func (sa *subAccount) ownOrder(oid int) bool {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	for _, id := range sa.acct.orders {
+		if id == oid {
+			return true
+		}
+	}
+	return false
+}
+
+// CancelOrder ... cancel own order of sub-account
+func (sa *subAccount) CancelOrder(oid int) error {
+	if !sa.ownOrder(oid) {
+		return errNoOrder
+	}
+	return sa.Broker.CancelOrder(oid)
+}
+
+// CloseOrder ... close own order of sub-account
+func (sa *subAccount) CloseOrder(oid int) {
+	if sa.ownOrder(oid) {
+		sa.Broker.CloseOrder(oid)
+	}
+}
+
+// GetOrder ... own order of sub-account, tagged with magic
+func (sa *subAccount) GetOrder(oid int) *OrderType {
+	if !sa.ownOrder(oid) {
+		return nil
+	}
+	or := sa.Broker.GetOrder(oid)
+	if or != nil && or.Magic != sa.magic {
+		// broker without MagicBroker
+		res := *or
+		res.Magic = sa.magic
+		return &res
+	}
+	return or
+}
+
+// GetOrders ... orders of sub-account
+func (sa *subAccount) GetOrders() []int {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	res := make([]int, len(sa.acct.orders))
+	copy(res, sa.acct.orders)
+	return res
+}
+
+// GetPosition ... position of symbol in sub-account
+func (sa *subAccount) GetPosition(sym string) (vPos PositionType) {
+	si, err := GetSymbolInfo(sym)
+	if err != nil {
+		return
+	}
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	if v, ok := sa.acct.pos[si.fKey]; ok {
+		vPos = *v
+	}
+	return
+}
+
+// GetPositions ... positions of sub-account
+func (sa *subAccount) GetPositions() (res []PositionType) {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	for _, v := range sa.acct.pos {
+		res = append(res, *v)
+	}
+	return
+}
+
+// GetDeals ... deals of own orders
+func (sa *subAccount) GetDeals() []DealType {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	res := make([]DealType, len(sa.acct.deals))
+	copy(res, sa.acct.deals)
+	return res
+}
+
+// GetTrades ... round trips of sub-account
+func (sa *subAccount) GetTrades() []TradeType {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.sync()
+	res := make([]TradeType, len(sa.acct.roundTrips))
+	copy(res, sa.acct.roundTrips)
+	return res
+}
+
+// transfer ... capital transfer in, negative for out
+func (sa *subAccount) transfer(amt float64) {
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	sa.acct.fundStart += amt
+	sa.acct.fund += amt
+	sa.acct.balance += amt
+	sa.acct.equity += amt
+}
+
+// report ... log capital, equity and P&L of sub-account
+func (sa *subAccount) report() {
+	eq := sa.Equity()
+	sa.lock.Lock()
+	defer sa.lock.Unlock()
+	log.Infof("Strategy %s magic(%d) capital(%.2f) equity(%.2f) orders(%d) "+
+		"win/loss(%d/%d) Profit/Loss(%.3f/%.3f)", sa.name, sa.magic,
+		sa.acct.fundStart, eq, len(sa.acct.orders), sa.acct.winTrades,
+		sa.acct.lossTrades, sa.acct.profit, sa.acct.loss)
+}
+
+// rebalanceCapital ... transfer capital between sub-accounts, equity of
+//		each sub-account to share of total equity by weight
+func rebalanceCapital(subs []*subAccount) {
+	var total, weights float64
+	equities := make([]float64, len(subs))
+	for i, sa := range subs {
+		equities[i] = sa.Equity()
+		total += equities[i]
+		weights += sa.weight
+	}
+	if weights <= 0 {
+		return
+	}
+	for i, sa := range subs {
+		if diff := total*sa.weight/weights - equities[i]; diff != 0 {
+			sa.transfer(diff)
+			log.Infof("Strategy %s rebalance capital %.2f", sa.name, diff)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package ats
+
+import "testing"
+
+func Test_subAccount(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil {
+		t.Skip("no sh601318", err)
+	}
+	mb := &mockBroker{equity: 1e6}
+	sa1 := newSubAccount(mb, "strat1", 1, 600000, 0.5)
+	sa2 := newSubAccount(mb, "strat2", 2, 400000, 0.5)
+	oid1 := sa1.SendOrder("sh601318", OrderDirBuy, 1000, 50, 0)
+	oid2 := sa2.SendOrder("sh601318", OrderDirSell, 500, 51, 0)
+	if or := sa1.GetOrder(oid1); or == nil || or.Magic != 1 {
+		t.Error("order magic", or)
+	}
+	if or := sa1.GetOrder(oid2); or != nil {
+		t.Error("order of other sub-account", or)
+	}
+	if err := sa2.CancelOrder(oid1); err != errNoOrder {
+		t.Error("cancel order of other sub-account", err)
+	}
+	// partial then full fill
+	mb.orders[oid1].QtyFilled, mb.orders[oid1].AvgPrice = 400, 50
+	mb.orders[oid1].Status = OrderPartFilled
+	if pos := sa1.GetPosition("sh601318"); pos.Positions != 400 {
+		t.Error("partial fill position", pos)
+	}
+	mb.orders[oid1].QtyFilled, mb.orders[oid1].AvgPrice = 1000, 49.4
+	mb.orders[oid1].Status = OrderFilled
+	pos := sa1.GetPosition("sh601318")
+	if pos.Positions != 1000 || round(pos.AvgPrice) != 49.4 {
+		t.Error("filled position", pos)
+	}
+	if deals := sa1.GetDeals(); len(deals) != 2 || round(deals[1].Price) != 49 {
+		t.Error("sub-account deals", deals)
+	}
+	mb.orders[oid2].QtyFilled, mb.orders[oid2].AvgPrice = 500, 51
+	mb.orders[oid2].Status = OrderFilled
+	if pos := sa2.GetPosition("sh601318"); pos.Positions != -500 {
+		t.Error("sub-account 2 position", pos)
+	}
+	// close with profit, rebalance to equal weight
+	oid3 := sa1.SendOrder("sh601318", OrderDirClose, 1000, 50.4, 0)
+	mb.orders[oid3].QtyFilled, mb.orders[oid3].AvgPrice = 1000, 50.4
+	mb.orders[oid3].Status = OrderFilled
+	profit := si.CalcProfit(49.4, 50.4, 1000)
+	if eq := sa1.Equity(); round(eq) != round(600000+profit) {
+		t.Error("sub-account equity", eq)
+	}
+	tests := []struct {
+		name string
+		sa   *subAccount
+		want float64
+	}{
+		{"strat1", sa1, (1e6 + profit) / 2},
+		{"strat2", sa2, (1e6 + profit) / 2},
+	}
+	rebalanceCapital([]*subAccount{sa1, sa2})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sa.Balance(); round(got) != round(tt.want) {
+				t.Errorf("Balance() after rebalance = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_subAccount_journal(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil {
+		t.Skip("no sh601318", err)
+	}
+	mb := &mockBroker{equity: 1e6}
+	sa1 := newSubAccount(mb, "strat1", 1, 600000, 0.5)
+	sa2 := newSubAccount(mb, "strat2", 2, 400000, 0.5)
+	oid1 := sa1.SendOrder("sh601318", OrderDirBuy, 1000, 50, 0)
+	oid2 := sa2.SendOrder("sh601318", OrderDirSell, 500, 51, 0)
+	mb.orders[oid1].QtyFilled, mb.orders[oid1].AvgPrice = 1000, 50
+	mb.orders[oid1].Status = OrderFilled
+	mb.orders[oid2].QtyFilled, mb.orders[oid2].AvgPrice = 500, 51
+	mb.orders[oid2].Status = OrderFilled
+	fee := si.CalcProfit(0, 50, 500) * 0.001
+	mb.deals = []DealType{{Symbol: "sh601318", Dir: OrderDirBuy, Qty: 1000, Price: 50,
+		Oid: oid1},
+		{Symbol: "sh601318", Dir: OrderDirSell, Qty: 500, Price: 50, Profit: -fee,
+			Oid: -1, Reason: "borrow"},
+		{Symbol: "sh601318", Dir: OrderDirBuy, Qty: 500, Price: 0.5,
+			Profit: si.CalcProfit(0, 0.5, 500), Oid: -1, Reason: "dividend"},
+		{Symbol: "sh601318", Dir: OrderDirBuy, Qty: 500, Price: 2, Oid: -1,
+			Reason: "split"}}
+	tests := []struct {
+		name    string
+		sa      *subAccount
+		pos     int
+		balance float64
+	}{
+		{"long", sa1, 2000, 600000 + si.CalcProfit(0, 0.5, 1000)},
+		{"short", sa2, -1000, 400000 - fee - si.CalcProfit(0, 0.5, 500)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if pos := tt.sa.GetPosition("sh601318"); pos.Positions != tt.pos {
+				t.Errorf("GetPosition() = %v, want %v", pos.Positions, tt.pos)
+			}
+			if got := tt.sa.Balance(); round(got) != round(tt.balance) {
+				t.Errorf("Balance() = %v, want %v", got, tt.balance)
+			}
+		})
+	}
+	// roll of contract, position of sub-account moved to new contract
+	newSymbolInfo("cu2001")
+	newSymbolInfo("cu2002")
+	oid3 := sa1.SendOrder("cu2001", OrderDirBuy, 2, 100, 0)
+	mb.orders[oid3].QtyFilled, mb.orders[oid3].AvgPrice = 2, 100
+	mb.orders[oid3].Status = OrderFilled
+	mb.deals = append(mb.deals, DealType{Symbol: "cu2001", Dir: OrderDirClose, Qty: 2,
+		Price: 102, Oid: -1, Reason: "roll"}, DealType{Symbol: "cu2002",
+		Dir: OrderDirBuy, Qty: 2, Price: 112, Oid: -1, Reason: "roll"})
+	if pos := sa1.GetPosition("cu2001"); pos.Positions != 0 {
+		t.Error("position of rolled contract", pos)
+	}
+	if pos := sa1.GetPosition("cu2002"); pos.Positions != 2 || pos.AvgPrice != 112 {
+		t.Error("position of new contract", pos)
+	}
+	if pos := sa2.GetPosition("cu2002"); pos.Positions != 0 {
+		t.Error("roll of other sub-account", pos)
+	}
+}
+
+func Test_subAccount_margin(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("sh601318")
+	si, err := GetSymbolInfo("sh601318")
+	if err != nil {
+		t.Skip("no sh601318", err)
+	}
+	mb := &mockBroker{equity: 1e6}
+	sa := newSubAccount(mb, "strat1", 1, si.CalcProfit(0, 50, 1000), 1)
+	tests := []struct {
+		name string
+		dir  OrderDirT
+		qty  int
+		want int
+	}{
+		{"within capital", OrderDirBuy, 800, 0},
+		{"pending over capital", OrderDirBuy, 300, -1},
+		{"rest of capital", OrderDirBuy, 200, 1},
+		{"reduce position", OrderDirClose, 500, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := sa.SendOrder("sh601318", tt.dir, tt.qty, 50, 0); got != tt.want {
+				t.Errorf("SendOrder() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+	mb.orders[0].QtyFilled, mb.orders[0].AvgPrice = 800, 50
+	mb.orders[0].Status = OrderFilled
+	mb.orders[1].Status = OrderCanceled
+	if fm := sa.FreeMargin(); round(fm) != round(si.CalcProfit(0, 50, 200)) {
+		t.Error("FreeMargin", fm)
+	}
+}
+
+func Test_subAccount_currency(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("USDJPY")
+	si, err := GetSymbolInfo("USDJPY")
+	if err != nil || si.symbolBase == nil {
+		t.Skip("no USDJPY", err)
+	}
+	qp := si.getQuotesPtr()
+	qp.Store(Quotes{Bid: 110, Ask: 110})
+	defer qp.Store(Quotes{})
+	mb := &mockBroker{equity: 1e6}
+	sa := newSubAccount(mb, "strat1", 1, 1e6, 1)
+	sa.acct.currency = "USD"
+	sa.acct.pos[si.fKey] = &PositionType{fKey: si.fKey, Positions: 1, AvgPrice: 100}
+	// unrealized in JPY converted by quotes published on SymbolInfo
+	want := 1e6 + si.CalcProfit(100, 110, 1)/110
+	if got := sa.Equity(); round(got) != round(want) {
+		t.Errorf("Equity() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,120 @@
+package ats
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/kjx98/golib/julian"
+)
+
+// tripleSwapDay rollover of Wednesday charged 3 days for weekend, spot
+//	value date of Wednesday rolled over Saturday and Sunday
+const tripleSwapDay = time.Wednesday
+
+// SwapRate ... swap of long/short position per lot per day in points,
+//	negative for charge
+type SwapRate struct {
+	Long  float64 `json:"long"`
+	Short float64 `json:"short"`
+}
+
+var swapOnce sync.Once
+var swapLock sync.RWMutex
+var swapRates = map[string]SwapRate{}
+
+// loadSwaps ... load swaps.json, symbol to swap rates override template
+//		{"EURUSD": {"long": -6.5, "short": 1.2}}
+func loadSwaps() {
+	swapOnce.Do(func() {
+		bb, err := ioutil.ReadFile("swaps.json")
+		if err != nil {
+			return
+		}
+		var recMap map[string]SwapRate
+		if err := json.Unmarshal(bb, &recMap); err != nil {
+			log.Warning("Decode swaps.json", err)
+			return
+		}
+		for sym, sw := range recMap {
+			SetSwap(sym, sw)
+		}
+	})
+}
+
+// SetSwap ... set swap rates of symbol
+func SetSwap(sym string, sw SwapRate) {
+	swapLock.Lock()
+	defer swapLock.Unlock()
+	swapRates[sym] = sw
+}
+
+// SwapRates ... swap rates of symbol, swaps.json or SwapLong/SwapShort
+//		of template
+func (s *SymbolInfo) SwapRates() SwapRate {
+	loadSwaps()
+	swapLock.RLock()
+	sw, ok := swapRates[s.Ticker]
+	swapLock.RUnlock()
+	if ok || s.symbolBase == nil {
+		return sw
+	}
+	return SwapRate{Long: s.SwapLong, Short: s.SwapShort}
+}
+
+// swapDays ... days of swap for rollover into trading day, 3 for rollover
+//		of Wednesday
+func swapDays(day julian.JulianDay) int {
+	if PrevTradingDay(simMarket, day).Weekday() == tripleSwapDay {
+		return 3
+	}
+	return 1
+}
+
+// simSwaps ... apply swaps of positions held over daily rollover into day
+func simSwaps(day julian.JulianDay) {
+	days := swapDays(day)
+	acctLock.Lock()
+	defer acctLock.Unlock()
+	for _, acct := range simAccounts {
+		for fKey, pos := range acct.pos {
+			si, err := fKey.SymbolInfo()
+			if err != nil {
+				continue
+			}
+			sw := si.SwapRates()
+			for _, leg := range pos.legs() {
+				pts := sw.Long
+				if leg.qty < 0 {
+					pts = sw.Short
+				}
+				if pts == 0 {
+					continue
+				}
+				acct.swap(si, leg.qty, pts*float64(days))
+			}
+		}
+	}
+}
+
+// swap ... credit swap of qty position by points, negative for charge
+func (acct *account) swap(si *SymbolInfo, qty int, pts float64) {
+	dir := OrderDirBuy
+	if qty < 0 {
+		dir = OrderDirSell
+		qty = -qty
+	}
+	amt := acct.toBase(si, si.CalcProfit(0, pts*si.PriceStep, qty))
+	acct.fund += amt
+	acct.balance += amt
+	acct.equity += amt
+	if dir == OrderDirBuy {
+		acct.addFee(si, 1, -amt)
+	} else {
+		acct.addFee(si, -1, -amt)
+	}
+	acct.deals = append(acct.deals, DealType{Time: simCurrent, Symbol: si.Ticker,
+		Dir: dir, Qty: qty, Price: pts, Profit: amt, Oid: -1, Reason: "swap"})
+	log.Infof("%s swap %.2f for %d lots", si.Ticker, amt, qty)
+}
@@ -0,0 +1,55 @@
+package ats
+
+import (
+	"testing"
+
+	"github.com/kjx98/golib/julian"
+)
+
+func Test_swapDays(t *testing.T) {
+	tests := []struct {
+		name string
+		day  julian.JulianDay
+		want int
+	}{
+		{"Thursday", julian.NewJulianDay(2019, 11, 14), 3},
+		{"Friday", julian.NewJulianDay(2019, 11, 15), 1},
+		{"Monday", julian.NewJulianDay(2019, 11, 18), 1},
+		{"Wednesday", julian.NewJulianDay(2019, 11, 20), 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := swapDays(tt.day); got != tt.want {
+				t.Errorf("swapDays() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSymbolInfo_SwapRates(t *testing.T) {
+	initSymbols()
+	newSymbolInfo("XAGUSD")
+	si, err := GetSymbolInfo("XAGUSD")
+	if err != nil {
+		t.Skip("no XAGUSD", err)
+	}
+	if sw := si.SwapRates(); sw != (SwapRate{Long: si.SwapLong, Short: si.SwapShort}) {
+		t.Error("template swap diff", sw)
+	}
+	SetSwap("XAGUSD", SwapRate{Long: -5, Short: 1.5})
+	defer func() {
+		swapLock.Lock()
+		delete(swapRates, "XAGUSD")
+		swapLock.Unlock()
+	}()
+	acct := &account{pos: map[SymbolKey]*PositionType{}}
+	acct.swap(&si, -2, si.SwapRates().Short*3)
+	if amt := round(acct.balance); amt != round(si.CalcProfit(0, 4.5*si.PriceStep, 2)) {
+		t.Error("short swap diff", amt)
+	}
+	acct.swap(&si, 2, si.SwapRates().Long)
+	if d := acct.deals[1]; d.Reason != "swap" || d.Dir != OrderDirBuy ||
+		round(d.Profit) != round(si.CalcProfit(0, -5*si.PriceStep, 2)) {
+		t.Error("long swap deal diff", d)
+	}
+}
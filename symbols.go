@@ -12,7 +12,9 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/kjx98/golib/julian"
 	"github.com/op/go-logging"
 	//yaml "gopkg.in/yaml.v2"
 )
@@ -31,22 +33,48 @@ const (
 // Margin	suppose initial margin and maintain margin are same, no support for options
 // IsForex	Forex/CFD ... OTC instrument without last/sales
 // CommissionType		0	per Amount, 1 Per Lot, 2 Per Trade
+// TimeZone	time zone of market, IANA name like Asia/Shanghai
+// Sessions	trading sessions in market local time, night session first
+//		like ["21:00-01:00", "09:00-10:15", "10:30-11:30", "13:30-15:00"]
+// LastTrade	rule of last trading day for futures, "15", "3Fri", "-1"
+// ExpiryNoOpen	new opens refused in last trading days till last trading day
+// SettleT1	T+1 settlement, shares bought today available to sell next trading day
+// LimitPct	daily price limit of previous close, 0.1 for 10%, 0 for no limit
+// ShortMode	"" short freely, "none" not allowed, "borrow" by borrow list
+// BorrowRate	annual fee rate of short market value for borrowed shares
+// CurrencySym	currency of P&L, quote currency of ticker for Forex if empty
+// SwapLong	swap of long position per lot per day in points, overnight
+// SwapShort	swap of short position per lot per day in points
+// CloseToday	exchange distinguish close today and close yesterday, like SHFE
 type symbolBase struct {
-	Market         string  `json:"market,omitempty"`
-	VolMin         int     `json:"volumeMin"`
-	VolMax         int     `json:"volumeMax"`
-	VolStep        int     `json:"volumeStep"`
-	PriceStep      float64 `json:"priceStep"`
-	PriceDigits    int     `json:"digits,omitempty"`
-	VolDigits      int     `json:"volumeDigits,omitempty"`
-	LotSize        int     `json:"lotSize,omitempty"`
-	Margin         float64 `json:"margin,omitempty"`
-	IsForex        bool    `json:"forex,omitempty"`
-	DefSpread      int32   `json:"defSpread,omitempty"`
-	CurrencySym    string  `json:"currency,omitempty"`
-	CommissionType int     `json:"commisssionType,omitempty"`
-	CommissionRate float64 `json:"commissionRate,omitempty"`
+	Market         string   `json:"market,omitempty"`
+	VolMin         int      `json:"volumeMin"`
+	VolMax         int      `json:"volumeMax"`
+	VolStep        int      `json:"volumeStep"`
+	PriceStep      float64  `json:"priceStep"`
+	PriceDigits    int      `json:"digits,omitempty"`
+	VolDigits      int      `json:"volumeDigits,omitempty"`
+	LotSize        int      `json:"lotSize,omitempty"`
+	Margin         float64  `json:"margin,omitempty"`
+	IsForex        bool     `json:"forex,omitempty"`
+	DefSpread      int32    `json:"defSpread,omitempty"`
+	CurrencySym    string   `json:"currency,omitempty"`
+	CommissionType int      `json:"commisssionType,omitempty"`
+	CommissionRate float64  `json:"commissionRate,omitempty"`
+	TimeZone       string   `json:"timezone,omitempty"`
+	Sessions       []string `json:"sessions,omitempty"`
+	LastTrade      string   `json:"lastTrade,omitempty"`
+	ExpiryNoOpen   int      `json:"expiryNoOpen,omitempty"`
+	SettleT1       bool     `json:"t1,omitempty"`
+	LimitPct       float64  `json:"limitPct,omitempty"`
+	ShortMode      string   `json:"short,omitempty"`
+	BorrowRate     float64  `json:"borrowRate,omitempty"`
+	SwapLong       float64  `json:"swapLong,omitempty"`
+	SwapShort      float64  `json:"swapShort,omitempty"`
+	CloseToday     bool     `json:"closeToday,omitempty"`
 	bMargin        bool
+	loc            *time.Location
+	sess           *marketSessions
 }
 
 // SymbolKey ... fast key for symbol, based from 1
@@ -61,7 +89,8 @@ type SymbolInfo struct {
 	fKey         SymbolKey
 	Upper        float64
 	Lower        float64
-	quote        Quotes
+	quote        *QuoteSnap
+	depth        *DepthSnap
 }
 
 // FastKey for internal
@@ -85,6 +114,17 @@ func (s *SymbolInfo) Divi() float64 {
 	return digitDiv(s.PriceDigits)
 }
 
+// Location ... time zone of market, UTC if not defined
+func (s *SymbolInfo) Location() *time.Location {
+	return s.symbolBase.location()
+}
+
+// TradingDay ... trading day of t in local time of market
+//	night session trades belong to next trading day
+func (s *SymbolInfo) TradingDay(t DateTimeMs) julian.JulianDay {
+	return s.symbolBase.tradingDay(t.Unix())
+}
+
 // PriceNormal normal Price for order
 func (s *SymbolInfo) PriceNormal(p float64) float64 {
 	p = math.Floor(p/s.PriceStep) * s.PriceStep
@@ -96,14 +136,65 @@ func (s *SymbolInfo) PriceNormal(p float64) float64 {
 	return p
 }
 
+// setDailyLimits ... Upper/Lower of trading day from previous close,
+//	rounded to PriceStep, no limits for LimitPct or pclose 0
+func (s *SymbolInfo) setDailyLimits(pclose float64) {
+	if s.symbolBase == nil || s.LimitPct <= 0 || pclose <= 0 {
+		limitLock.Lock()
+		s.Upper, s.Lower = 0, 0
+		limitLock.Unlock()
+		return
+	}
+	round := func(p float64) float64 {
+		p = math.Floor(p/s.PriceStep+0.5) * s.PriceStep
+		return math.Floor(p*s.Multi()+0.5) * s.Divi()
+	}
+	upper, lower := round(pclose*(1+s.LimitPct)), round(pclose*(1-s.LimitPct))
+	limitLock.Lock()
+	s.Upper, s.Lower = upper, lower
+	limitLock.Unlock()
+}
+
+// limits ... Upper/Lower of trading day, for SymbolInfo shared by day rotation
+func (s *SymbolInfo) limits() (upper, lower float64) {
+	limitLock.RLock()
+	defer limitLock.RUnlock()
+	return s.Upper, s.Lower
+}
+
 // GetQuotes return quotes for symbol
+//	consistent snapshot, Seq for detect missed updates
 func (s *SymbolInfo) GetQuotes() Quotes {
-	return s.quote
+	if s.quote == nil {
+		return Quotes{}
+	}
+	return s.quote.Load()
 }
 
 // return ref for quotes of symbol, used by broker quotes feed
-func (s *SymbolInfo) getQuotesPtr() *Quotes {
-	return &s.quote
+//	shared by copies of SymbolInfo
+func (s *SymbolInfo) getQuotesPtr() *QuoteSnap {
+	return s.quote
+}
+
+// GetDepth return Level2 depth snapshot for symbol, nil for not subscribed
+//	or no depth update yet, returned DepthBook must not be modified
+func (s *SymbolInfo) GetDepth() *DepthBook {
+	if s.depth == nil {
+		return nil
+	}
+	return s.depth.Load()
+}
+
+// return ref for depth of symbol, used by broker depth feed
+func (s *SymbolInfo) getDepthPtr(n int) *DepthSnap {
+	if si, err := s.fKey.SymbolInfo(); err == nil {
+		if si.depth == nil {
+			si.depth = NewDepthSnap(n)
+		}
+		s.depth = si.depth
+	}
+	return s.depth
 }
 
 // CalcProfit calc order profit according to price and volume position
@@ -121,6 +212,14 @@ func (s *SymbolInfo) CalcProfit(openP, closeP float64, volume int) float64 {
 	return res
 }
 
+// marginRate ... margin of market value, 1 for full margin
+func (s *SymbolInfo) marginRate() float64 {
+	if s.bMargin {
+		return s.Margin
+	}
+	return 1
+}
+
 // CalcVolume calc order quantity according to price and value amount in full margin
 func (s *SymbolInfo) CalcVolume(amt float64, p float64) float64 {
 	if s.LotSize > 0 {
@@ -296,6 +395,8 @@ var initTemp = symbolTemps{
 	{TickerPrefix: "cu",
 		Name: "copper future contract",
 		Base: symbolBase{Market: "SHFE",
+			CurrencySym: "CNY",
+			CloseToday:  true,
 			VolMin:      1,
 			VolMax:      2000,
 			VolStep:     1,
@@ -309,12 +410,17 @@ var initTemp = symbolTemps{
 	{TickerPrefix: "sh6",
 		Name: "Shanghai A stock",
 		Base: symbolBase{Market: "SHSE",
+			CurrencySym: "CNY",
 			VolMin:      100,
 			VolMax:      1000000,
 			VolStep:     100,
 			PriceStep:   0.01,
 			PriceDigits: 2,
-			VolDigits:   0},
+			VolDigits:   0,
+			SettleT1:    true,
+			LimitPct:    0.1,
+			ShortMode:   ShortBorrow,
+			BorrowRate:  0.08},
 		TickerLen: 8,
 		DateLen:   0,
 		USticker:  false,
@@ -322,12 +428,17 @@ var initTemp = symbolTemps{
 	{TickerPrefix: "sh5",
 		Name: "Shanghai ETF",
 		Base: symbolBase{Market: "SHSE",
+			CurrencySym: "CNY",
 			VolMin:      100,
 			VolMax:      1000000,
 			VolStep:     100,
 			PriceStep:   0.001,
 			PriceDigits: 3,
-			VolDigits:   0},
+			VolDigits:   0,
+			SettleT1:    true,
+			LimitPct:    0.1,
+			ShortMode:   ShortBorrow,
+			BorrowRate:  0.08},
 		TickerLen: 8,
 		DateLen:   0,
 		USticker:  false,
@@ -335,12 +446,14 @@ var initTemp = symbolTemps{
 	{TickerPrefix: "sh204",
 		Name: "Shanghai Repo",
 		Base: symbolBase{Market: "SHSE",
+			CurrencySym: "CNY",
 			VolMin:      10,
 			VolMax:      100000,
 			VolStep:     10,
 			PriceStep:   0.001,
 			PriceDigits: 3,
-			VolDigits:   0},
+			VolDigits:   0,
+			ShortMode:   ShortNone},
 		TickerLen: 8,
 		DateLen:   0,
 		USticker:  false,
@@ -348,13 +461,17 @@ var initTemp = symbolTemps{
 }
 
 var symInfos = map[string]*SymbolInfo{}
-var symInfoCaches = []SymbolInfo{}
+
+// capacity of maxInstruments, pointers of symInfos never moved
+var symInfoCaches = make([]SymbolInfo, 0, maxInstruments)
 var usDeliverMonth = " FGHJKMNQUVXZ"
 var errNoSuchSymbol = errors.New("no such symbol")
 var initTicks = map[string]tickConf{}
 
 func GetSymbolInfo(sym string) (SymbolInfo, error) {
 	if res, ok := symInfos[sym]; ok {
+		limitLock.RLock()
+		defer limitLock.RUnlock()
 		return *res, nil
 	}
 	return SymbolInfo{}, errNoSuchSymbol
@@ -370,6 +487,9 @@ func (fkey SymbolKey) SymbolInfo() (*SymbolInfo, error) {
 
 var nInstruments int
 var instRWlock sync.RWMutex
+
+// limitLock ... Upper/Lower of SymbolInfo updated by day rotation
+var limitLock sync.RWMutex
 var jpySymbolBasePtr *symbolBase
 
 func newSymbolInfo(sym string) {
@@ -388,6 +508,19 @@ func newSymbolInfo(sym string) {
 	}
 	instRWlock.RUnlock()
 	var symInfo = SymbolInfo{}
+	if i := strings.IndexByte(sym, '@'); i > 0 {
+		// continuous futures like cu@main, base of contracts
+		for j := range initTemp {
+			if !initTemp[j].Bregexp && initTemp[j].DateLen > 0 &&
+				initTemp[j].TickerPrefix == sym[:i] {
+				symInfo.Ticker = sym
+				symInfo.symbolBase = &initTemp[j].Base
+				addSymbolInfo(&symInfo)
+				return
+			}
+		}
+		return
+	}
 	for i := 0; i < len(initTemp); i++ {
 		if sLen > initTemp[i].TickerLen {
 			continue
@@ -458,20 +591,25 @@ func newSymbolInfo(sym string) {
 			}
 			symInfo.symbolBase = jpySymbolBasePtr
 		}
-		instRWlock.Lock()
-		defer instRWlock.Unlock()
-
-		symIdx := nInstruments
-		nInstruments++
-		symInfo.fKey = SymbolKey(nInstruments)
-
-		symInfoCaches = append(symInfoCaches, symInfo)
-		symInfos[sym] = &symInfoCaches[symIdx]
-		//symInfos[sym] = &symInfo
+		addSymbolInfo(&symInfo)
 		return
 	}
 }
 
+func addSymbolInfo(symInfo *SymbolInfo) {
+	instRWlock.Lock()
+	defer instRWlock.Unlock()
+
+	symIdx := nInstruments
+	nInstruments++
+	symInfo.fKey = SymbolKey(nInstruments)
+	symInfo.quote = &QuoteSnap{}
+
+	symInfoCaches = append(symInfoCaches, *symInfo)
+	symInfos[symInfo.Ticker] = &symInfoCaches[symIdx]
+	//symInfos[sym] = &symInfo
+}
+
 var symbolTempOnce sync.Once
 
 func initSymbols() {
@@ -503,6 +641,23 @@ func initSymbols() {
 			if initTemp[i].Base.VolStep <= 0 {
 				initTemp[i].Base.VolStep = 1
 			}
+			bp := &initTemp[i].Base
+			bp.loc = time.UTC
+			if bp.TimeZone != "" {
+				if loc, err := time.LoadLocation(bp.TimeZone); err != nil {
+					log.Warning("TimeZone of", initTemp[i].TickerPrefix, err)
+				} else {
+					bp.loc = loc
+				}
+			}
+			if ms, err := newMarketSessions(bp.TimeZone, bp.Sessions); err != nil {
+				log.Warning("Sessions of", initTemp[i].TickerPrefix, err)
+			} else {
+				if ms != nil {
+					ms.market = bp.Market
+				}
+				bp.sess = ms
+			}
 			if initTemp[i].Base.PriceStep <= 0 {
 				initTemp[i].Base.PriceStep = 1
 			}
@@ -309,12 +309,15 @@ func OpenTickFX(pair string, startD, endD julian.JulianDay, maxCnt int) (res *ti
 		}
 	}
 	startD = startD.Weekbase()
+	cid := cacheID{kind: cacheKindTickDB, name: pair}
 	tDB := tickDbMap[pair]
 	if tDB.pair == pair && tDB.startD <= startD && tDB.endD >= endD {
 		res = &tDB
+		cacheHit(cid)
 		log.Info("OpenTickFX using cache, startD ", startD)
 		return
 	}
+	cacheMiss(cacheKindTickDB)
 	tCnt := 0
 	tOff := 0
 	var ticks []tickDT
@@ -332,6 +335,7 @@ func OpenTickFX(pair string, startD, endD julian.JulianDay, maxCnt int) (res *ti
 			}
 			if err == nil {
 				tickDbMap[pair] = *res
+				cacheAdd(cid, tickDBSize(res))
 			}
 			return
 		}
@@ -357,6 +361,7 @@ func OpenTickFX(pair string, startD, endD julian.JulianDay, maxCnt int) (res *ti
 		startD += 7
 	}
 	tickDbMap[pair] = *res
+	cacheAdd(cid, tickDBSize(res))
 	return
 }
 
@@ -609,7 +609,7 @@ func (tickHd *TickHead) DecodeTickExt(buf []byte) (ticks []TickExt, err error) {
 		var pDep int32
 		errS = "Empty after rec.Bid"
 		if (fl & 0x40) == 0 {
-			if err = ckBufLen(off, 2, bLen, errS); err != nil {
+			if err = ckBufLen(off, 1, bLen, errS); err != nil {
 				return
 			}
 			lastDelta = int32(int8(buf[off]))
@@ -617,7 +617,7 @@ func (tickHd *TickHead) DecodeTickExt(buf []byte) (ticks []TickExt, err error) {
 			pDep = int32(buf[off])
 			off++
 		} else {
-			if err = ckBufLen(off, 4, bLen, errS); err != nil {
+			if err = ckBufLen(off, 3, bLen, errS); err != nil {
 				return
 			}
 			lastDelta = int32(int16(getUint16(buf[off:])))
@@ -629,7 +629,7 @@ func (tickHd *TickHead) DecodeTickExt(buf []byte) (ticks []TickExt, err error) {
 		tp.BidDepth = tp.Bid - pDep
 		errS = "Empty after rec.Ask"
 		if (fl & 0x20) == 0 {
-			if err = ckBufLen(off, 2, bLen, errS); err != nil {
+			if err = ckBufLen(off, 1, bLen, errS); err != nil {
 				return
 			}
 			lastDelta = int32(int8(buf[off]))
@@ -637,7 +637,7 @@ func (tickHd *TickHead) DecodeTickExt(buf []byte) (ticks []TickExt, err error) {
 			pDep = int32(buf[off])
 			off++
 		} else {
-			if err = ckBufLen(off, 4, bLen, errS); err != nil {
+			if err = ckBufLen(off, 3, bLen, errS); err != nil {
 				return
 			}
 			lastDelta = int32(int16(getUint16(buf[off:])))
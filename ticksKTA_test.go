@@ -129,6 +129,40 @@ func TestTickExtCodec(t *testing.T) {
 	}
 }
 
+func TestTickExtCodecEndAsk(t *testing.T) {
+	// no volume of final tick, record ends on Ask field
+	base := TickExt{Time: 1552000000, Bid: 10000, BidDepth: 9990, Ask: 10002,
+		AskDepth: 10010, BidVol: 5, BidsVol: 50, AskVol: 6, AsksVol: 60}
+	tests := []struct {
+		name string
+		last TickExt
+	}{
+		{"short Ask", TickExt{Time: 1552000003, Bid: 10001, BidDepth: 9991,
+			Ask: 10003, AskDepth: 10011}},
+		{"long Ask", TickExt{Time: 1552000003, Bid: 10001, BidDepth: 9991,
+			Ask: 10500, AskDepth: 10600}},
+		{"long Bid and Ask", TickExt{Time: 1552000400, Bid: 9000, BidDepth: 8000,
+			Ask: 11000, AskDepth: 12000}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ticks := []TickExt{base, tt.last}
+			var tickHd = &TickHead{}
+			buf, err := tickHd.EncodeTickExt(ticks)
+			if err != nil {
+				t.Fatal(err)
+			}
+			res, err := tickHd.DecodeTickExt(buf)
+			if err != nil {
+				t.Fatal("DecodeTickExt", err)
+			}
+			if len(res) != 2 || res[1] != tt.last {
+				t.Errorf("DecodeTickExt() = %v, want %v", res, tt.last)
+			}
+		})
+	}
+}
+
 func TestMinTACodec(t *testing.T) {
 	ticks := make([]MinTA, 32)
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
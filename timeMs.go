@@ -60,3 +60,33 @@ func JulianToDateTimeMs(jDN julian.JulianDay) DateTimeMs {
 	sec := jDN.UTC().Unix() * 1000
 	return DateTimeMs(sec)
 }
+
+// JulianDay ... return UTC julian Day of DateTimeMs
+func (dtMs DateTimeMs) JulianDay() julian.JulianDay {
+	y, m, d := dtMs.Time().Date()
+	return julian.NewJulianDay(y, int(m), d)
+}
+
+// In ... Time of DateTimeMs in location loc
+func (dtMs DateTimeMs) In(loc *time.Location) time.Time {
+	return dtMs.Time().In(loc)
+}
+
+// LocalJulianDay ... return julian Day of DateTimeMs in location loc
+func (dtMs DateTimeMs) LocalJulianDay(loc *time.Location) julian.JulianDay {
+	y, m, d := dtMs.In(loc).Date()
+	return julian.NewJulianDay(y, int(m), d)
+}
+
+// StringIn ... format as String in location loc
+func (dtMs DateTimeMs) StringIn(loc *time.Location) string {
+	return dtMs.In(loc).Format("06-01-02 15:04:05.000")
+}
+
+// LocalToDateTimeMs ... convert seconds tod from local midnight of julian
+//		Day in location loc to DateTimeMs
+func LocalToDateTimeMs(jDN julian.JulianDay, tod int64, loc *time.Location) DateTimeMs {
+	y, m, d := jDN.Date()
+	sec := time.Date(y, time.Month(m), d, 0, 0, 0, 0, loc).Unix() + tod
+	return DateTimeMs(sec * 1000)
+}
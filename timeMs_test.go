@@ -3,6 +3,8 @@ package ats
 import (
 	"testing"
 	"time"
+
+	"github.com/kjx98/golib/julian"
 )
 
 func TestDateTimeMs(t *testing.T) {
@@ -13,6 +15,27 @@ func TestDateTimeMs(t *testing.T) {
 	}
 }
 
+func TestDateTimeMs_Local(t *testing.T) {
+	sh, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		t.Skip("LoadLocation", err)
+	}
+	// 2019-03-08 17:30 UTC, 2019-03-09 01:30 Shanghai
+	ms := TimeToDateTimeMs(time.Date(2019, 3, 8, 17, 30, 0, 0, time.UTC))
+	if jd := ms.LocalJulianDay(sh); jd != julian.NewJulianDay(2019, 3, 9) {
+		t.Error("LocalJulianDay diff", jd)
+	}
+	if jd := ms.JulianDay(); jd != julian.NewJulianDay(2019, 3, 8) {
+		t.Error("JulianDay diff", jd)
+	}
+	if s := ms.StringIn(sh); s != "19-03-09 01:30:00.000" {
+		t.Error("StringIn diff", s)
+	}
+	if got := LocalToDateTimeMs(julian.NewJulianDay(2019, 3, 9), 5400, sh); got != ms {
+		t.Error("LocalToDateTimeMs diff", got)
+	}
+}
+
 func BenchmarkDateTimeMs(b *testing.B) {
 	t1 := time.Now()
 	for i := 0; i < b.N; i++ {